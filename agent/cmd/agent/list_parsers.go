@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"siem-project/agent/pkg/collector"
+)
+
+// runListParsers выводит зарегистрированные типы источников и их опции
+func runListParsers() int {
+	for _, factory := range collector.Factories() {
+		fmt.Printf("%s - %s\n", factory.Type, factory.Description)
+
+		names := make([]string, 0, len(factory.Options))
+		for name := range factory.Options {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			spec := factory.Options[name]
+			line := fmt.Sprintf("    %s (%s): %s", name, spec.Type, spec.Description)
+			if spec.Default != nil {
+				line += fmt.Sprintf(" [по умолчанию: %v]", spec.Default)
+			}
+			if spec.Required {
+				line += " [обязательная]"
+			}
+			fmt.Println(line)
+		}
+	}
+	return 0
+}
@@ -12,6 +12,15 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "test-parser":
+			os.Exit(runTestParser(os.Args[2:]))
+		case "list-parsers":
+			os.Exit(runListParsers())
+		}
+	}
+
 	configPath := flag.String("config", "configs/agent.yaml", "Путь к конфигурационному файлу")
 	serverHost := flag.String("server-host", "", "Адрес сервера (переопределяет config)")
 	serverPort := flag.Int("server-port", 0, "Порт сервера (переопределяет config)")
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"siem-project/agent/pkg/collector"
+	"siem-project/agent/pkg/config"
+)
+
+// runTestParser проверяет custom парсер на примерах строк:
+//
+//	siem-agent test-parser -config configs/agent.yaml -source myapp -file sample.log
+//	echo "user=bob" | siem-agent test-parser -pattern 'user=%{USERNAME:user}'
+func runTestParser(args []string) int {
+	fs := flag.NewFlagSet("test-parser", flag.ExitOnError)
+	configPath := fs.String("config", "configs/agent.yaml", "Путь к конфигурационному файлу")
+	sourceName := fs.String("source", "", "Имя custom парсера (parser.name) из конфига")
+	pattern := fs.String("pattern", "", "Шаблон grok/regex для проверки без конфига")
+	samplePath := fs.String("file", "", "Файл с примерами строк (по умолчанию stdin)")
+	fs.Parse(args)
+
+	parserCfg, err := testParserConfig(*configPath, *sourceName, *pattern)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка: %v\n", err)
+		return 1
+	}
+
+	parser, err := collector.NewCustomParser(*parserCfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка компиляции парсера: %v\n", err)
+		return 1
+	}
+
+	var input io.Reader = os.Stdin
+	if *samplePath != "" {
+		file, err := os.Open(*samplePath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Ошибка: %v\n", err)
+			return 1
+		}
+		defer file.Close()
+		input = file
+	}
+
+	failed := 0
+	lineNum := 0
+	scanner := bufio.NewScanner(input)
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+
+		_, idx, ok := parser.Match(line)
+		if !ok {
+			failed++
+			fmt.Printf("%d: нет совпадений\n    %s\n", lineNum, line)
+			continue
+		}
+
+		event, err := parser.Parse(line, "test")
+		if err != nil {
+			failed++
+			fmt.Printf("%d: ошибка: %v\n", lineNum, err)
+			continue
+		}
+		data, _ := json.MarshalIndent(event, "    ", "  ")
+		fmt.Printf("%d: шаблон #%d\n    %s\n", lineNum, idx, data)
+	}
+
+	if failed > 0 {
+		return 2
+	}
+	return 0
+}
+
+func testParserConfig(configPath, sourceName, pattern string) (*config.CustomParserConfig, error) {
+	if pattern != "" {
+		return &config.CustomParserConfig{Name: "test", Patterns: []string{pattern}}, nil
+	}
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, source := range cfg.Sources {
+		if source.Type != "custom" || source.Parser == nil {
+			continue
+		}
+		if sourceName == "" || source.Parser.Name == sourceName {
+			return source.Parser, nil
+		}
+	}
+	return nil, fmt.Errorf("custom парсер %q не найден в %s", sourceName, configPath)
+}
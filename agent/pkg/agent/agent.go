@@ -12,13 +12,16 @@ import (
 	"siem-project/agent/pkg/buffer"
 	"siem-project/agent/pkg/collector"
 	"siem-project/agent/pkg/config"
+	"siem-project/agent/pkg/pipeline"
 	"siem-project/agent/pkg/sender"
 	"siem-project/agent/pkg/types"
 )
 
 type Agent struct {
 	cfg        *config.Config
-	collectors []*collector.LogCollector
+	collectors []collector.Collector
+	pipeline   *pipeline.Pipeline
+	host       *hostContext // nil, если обогащение отключено
 	buffer     *buffer.RingBuffer
 	sender     *sender.Sender
 	stopCh     chan struct{}
@@ -32,6 +35,20 @@ func NewAgent(cfg *config.Config) (*Agent, error) {
 		return nil, fmt.Errorf("failed to setup logging: %w", err)
 	}
 
+	// фильтрация и выборка перед буфером
+	pipe, err := pipeline.New(cfg.Pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create pipeline: %w", err)
+	}
+
+	var host *hostContext
+	if !cfg.Enrichment.Disable {
+		host, err = newHostContext(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create host context: %w", err)
+		}
+	}
+
 	// буфер
 	buf := buffer.NewRingBuffer(cfg.Buffer.MemorySize, cfg.Buffer.DiskPath)
 
@@ -39,7 +56,9 @@ func NewAgent(cfg *config.Config) (*Agent, error) {
 
 	agent := &Agent{
 		cfg:        cfg,
-		collectors: make([]*collector.LogCollector, 0),
+		collectors: make([]collector.Collector, 0),
+		pipeline:   pipe,
+		host:       host,
 		buffer:     buf,
 		sender:     snd,
 		stopCh:     make(chan struct{}),
@@ -61,22 +80,7 @@ func (a *Agent) initCollectors() error {
 			continue
 		}
 
-		var parser collector.LogParser
-		switch source.Type {
-		case "bash_history":
-			parser = collector.NewBashHistoryParser()
-		case "syslog":
-			parser = collector.NewSyslogParser("syslog")
-		case "auth":
-			parser = collector.NewSyslogParser("auth")
-		case "auditd":
-			parser = collector.NewAuditdParser()
-		default:
-			log.Printf("Неизвестный тип источника: %s, пропускаем", source.Type)
-			continue
-		}
-
-		coll, err := collector.NewCollector(source, parser, a.cfg.Agent.Hostname)
+		coll, err := collector.NewSourceCollector(source, a.cfg.Agent.Hostname)
 		if err != nil {
 			log.Printf("Не удалось создать коллектор для %s: %v", source.Type, err)
 			continue
@@ -139,42 +143,74 @@ func (a *Agent) processEvents() {
 
 	eventCh := make(chan *types.Event, 100)
 
+	// каналы читаются до закрытия: при остановке коллекторы отдают
+	// незавершенные группы (auditd, apt), eventCh закрывается последним
+	var readers sync.WaitGroup
 	for _, coll := range a.collectors {
-		a.wg.Add(1)
-		go func(c *collector.LogCollector) {
-			defer a.wg.Done()
-			for {
-				select {
-				case event, ok := <-c.Events():
-					if !ok {
-						return
-					}
-					select {
-					case eventCh <- event:
-					case <-a.stopCh:
-						return
-					}
-				case <-a.stopCh:
-					return
-				}
+		readers.Add(1)
+		go func(c collector.Collector) {
+			defer readers.Done()
+			for event := range c.Events() {
+				eventCh <- event
 			}
 		}(coll)
 	}
+	go func() {
+		readers.Wait()
+		close(eventCh)
+	}()
+
+	// счетчики отброшенных событий уходят на сервер обычным событием
+	statsTicker := time.NewTicker(a.pipeline.StatsInterval())
+	defer statsTicker.Stop()
+
+	// агрегированные события отправляются по истечении окна
+	flushTicker := time.NewTicker(time.Second)
+	defer flushTicker.Stop()
 
 	for {
 		select {
-		case event := <-eventCh:
-			if err := a.buffer.Add(event); err != nil {
-				log.Printf("Ошибка добавления события в буфер: %v", err)
+		case event, ok := <-eventCh:
+			if !ok {
+				log.Printf("Остановка обработки событий")
+				a.addEvents(a.pipeline.Flush(true))
+				return
+			}
+			if !a.pipeline.Process(event) {
+				continue
 			}
+			a.addEvent(event)
 
-		case <-a.stopCh:
-			log.Printf("Остановка обработки событий")
-			return
+		case <-flushTicker.C:
+			a.addEvents(a.pipeline.Flush(false))
+
+		case <-statsTicker.C:
+			stats := a.pipeline.StatsEvent(a.cfg.Agent.Hostname)
+			if stats == nil {
+				continue
+			}
+			log.Printf("Конвейер отбросил %s и схлопнул %s из %s событий", stats.Fields["dropped"], stats.Fields["aggregated"], stats.Fields["processed"])
+			a.addEvent(stats)
 		}
 	}
 }
 
+func (a *Agent) addEvents(events []*types.Event) {
+	for _, event := range events {
+		a.addEvent(event)
+	}
+}
+
+// addEvent добавляет к событию сведения о хосте и кладет его в буфер
+func (a *Agent) addEvent(event *types.Event) {
+	if a.host != nil {
+		a.host.enrich(event, time.Now())
+	}
+	if err := a.buffer.Add(event); err != nil {
+		log.Printf("Ошибка добавления события в буфер: %v", err)
+	}
+}
+
 // периодически отправляет события из буфера
 func (a *Agent) periodicSend() {
 	defer a.wg.Done()
@@ -222,13 +258,13 @@ func (a *Agent) sendBatch() {
 func (a *Agent) Stop() {
 	log.Printf("Остановка агента...")
 
-	close(a.stopCh)
-
-	// останавливаем коллекторы
+	// коллекторы останавливаются первыми, processEvents тем временем
+	// дочитывает их каналы и завершается, когда все они закрыты
 	for _, coll := range a.collectors {
 		coll.Stop()
 	}
 
+	close(a.stopCh)
 	a.wg.Wait()
 
 	log.Printf("Сохранение буфера на диск...")
@@ -0,0 +1,354 @@
+package agent
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"siem-project/agent/pkg/config"
+	"siem-project/agent/pkg/types"
+)
+
+// Version задается при сборке:
+// go build -ldflags "-X siem-project/agent/pkg/agent.Version=1.4.0"
+var Version = "dev"
+
+// сведения о хосте перечитываются раз в 5 минут, если в конфиге не задано иное
+const defaultHostRefreshInterval = 5 * time.Minute
+
+var osReleasePaths = []string{"/etc/os-release", "/usr/lib/os-release"}
+
+const (
+	kernelReleasePath = "/proc/sys/kernel/osrelease"
+	dmiPath           = "/sys/class/dmi/id"
+	sysNetPath        = "/sys/class/net"
+)
+
+// сетевое пространство init: при pid: host это сеть хоста, а не контейнера
+const defaultHostNetPath = "/proc/1/net"
+
+// признаки облака в DMI: файл -> подстрока -> провайдер
+var cloudDMIHints = []struct {
+	file, contains, provider string
+}{
+	{"sys_vendor", "Amazon EC2", "aws"},
+	{"bios_vendor", "Amazon EC2", "aws"},
+	{"bios_version", "amazon", "aws"},
+	{"product_name", "Google Compute Engine", "gcp"},
+	{"chassis_asset_tag", "7783-7084-3265-9085-8269-3286-77", "azure"},
+	{"chassis_asset_tag", "OracleCloud.com", "oracle"},
+	{"sys_vendor", "DigitalOcean", "digitalocean"},
+	{"sys_vendor", "Hetzner", "hetzner"},
+	{"sys_vendor", "Alibaba Cloud", "alibaba"},
+	{"sys_vendor", "Yandex", "yandex"},
+	{"product_name", "OpenStack", "openstack"},
+}
+
+// признаки гипервизора в sys_vendor и product_name
+var virtualizationHints = []struct {
+	contains, name string
+}{
+	{"VMware", "vmware"},
+	{"VirtualBox", "virtualbox"},
+	{"KVM", "kvm"},
+	{"QEMU", "qemu"},
+	{"Xen", "xen"},
+	{"Virtual Machine", "hyperv"},
+	{"Parallels", "parallels"},
+	{"Bochs", "bochs"},
+	{"Amazon EC2", "kvm"},
+	{"Google Compute Engine", "kvm"},
+}
+
+// hostContext - поля, которые добавляются к каждому событию агента.
+// Используется из одной горутины (Agent.processEvents)
+type hostContext struct {
+	rootDir  string
+	netPath  string
+	interval time.Duration
+	static   map[string]string // agent_id, agent_version, tag_*
+	fields   map[string]string // static + сведения о хосте
+	updated  time.Time
+}
+
+func newHostContext(cfg *config.Config) (*hostContext, error) {
+	h := &hostContext{
+		rootDir:  cfg.Enrichment.RootDir,
+		netPath:  cfg.Enrichment.NetPath,
+		interval: defaultHostRefreshInterval,
+		static: map[string]string{
+			"agent_id":      cfg.Agent.ID,
+			"agent_version": Version,
+		},
+	}
+	if h.netPath == "" {
+		h.netPath = defaultHostNetPath
+	}
+	if cfg.Enrichment.RefreshInterval != "" {
+		interval, err := time.ParseDuration(cfg.Enrichment.RefreshInterval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid refresh_interval: %w", err)
+		}
+		h.interval = interval
+	}
+	for name, value := range cfg.Enrichment.Tags {
+		h.static["tag_"+name] = value
+	}
+
+	h.refresh()
+	return h, nil
+}
+
+// enrich добавляет поля хоста; поля, уже выставленные парсером, не меняются
+func (h *hostContext) enrich(event *types.Event, now time.Time) {
+	if now.Sub(h.updated) >= h.interval {
+		h.refresh()
+	}
+	if event.Fields == nil {
+		event.Fields = make(map[string]string, len(h.fields))
+	}
+	for name, value := range h.fields {
+		if _, ok := event.Fields[name]; !ok {
+			event.Fields[name] = value
+		}
+	}
+}
+
+// refresh перечитывает адреса, ОС и DMI. Ошибки чтения не фатальны:
+// соответствующие поля просто не попадают в событие
+func (h *hostContext) refresh() {
+	fields := make(map[string]string, len(h.static)+12)
+	for name, value := range h.static {
+		fields[name] = value
+	}
+	set := func(name, value string) {
+		if value != "" {
+			fields[name] = value
+		}
+	}
+
+	ips, mac := h.hostAddresses()
+	set("host_ips", strings.Join(ips, ","))
+	set("host_mac", mac)
+
+	osRelease := h.readOSRelease()
+	set("host_os", osRelease["PRETTY_NAME"])
+	set("host_os_id", osRelease["ID"])
+	set("host_os_version", osRelease["VERSION_ID"])
+
+	if data, err := os.ReadFile(kernelReleasePath); err == nil {
+		set("host_kernel", strings.TrimSpace(string(data)))
+	}
+
+	dmi := h.readDMI()
+	set("host_cloud", detectCloud(dmi))
+	set("host_virtualization", detectVirtualization(dmi))
+	set("host_container", detectContainer())
+
+	h.fields = fields
+	h.updated = time.Now()
+}
+
+// hostAddresses читает адреса из таблиц ядра netPath (сеть хоста и из
+// контейнера), MAC - интерфейса маршрута по умолчанию из sysfs хоста.
+// Если таблицы недоступны, берутся интерфейсы самого процесса
+func (h *hostContext) hostAddresses() ([]string, string) {
+	ips := readLocalIPv4(filepath.Join(h.netPath, "fib_trie"))
+	ips = append(ips, readGlobalIPv6(filepath.Join(h.netPath, "if_inet6"))...)
+	if len(ips) == 0 {
+		return interfaceAddresses()
+	}
+
+	mac := ""
+	if iface := defaultRouteInterface(filepath.Join(h.netPath, "route")); iface != "" {
+		if data, err := os.ReadFile(filepath.Join(h.rootDir, sysNetPath, iface, "address")); err == nil {
+			mac = strings.TrimSpace(string(data))
+		}
+	}
+	return ips, mac
+}
+
+// readLocalIPv4 собирает адреса "host LOCAL" из fib_trie, кроме 127.0.0.0/8:
+//
+//	|-- 192.168.1.10
+//	   /32 host LOCAL
+func readLocalIPv4(path string) []string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	var ips []string
+	seen := make(map[string]bool)
+	last := ""
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "|-- ") {
+			last = strings.TrimPrefix(line, "|-- ")
+			continue
+		}
+		if !strings.HasSuffix(line, "host LOCAL") || last == "" {
+			continue
+		}
+		ip := net.ParseIP(last)
+		if ip != nil && !ip.IsLoopback() && !seen[last] {
+			seen[last] = true
+			ips = append(ips, last)
+		}
+	}
+	return ips
+}
+
+// readGlobalIPv6 разбирает if_inet6: адрес, индекс, префикс, scope, флаги,
+// интерфейс. Берутся только глобальные адреса (scope 00)
+func readGlobalIPv6(path string) []string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	var ips []string
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 6 || fields[3] != "00" || len(fields[0]) != 32 {
+			continue
+		}
+		raw, err := hex.DecodeString(fields[0])
+		if err != nil {
+			continue
+		}
+		ips = append(ips, net.IP(raw).String())
+	}
+	return ips
+}
+
+// defaultRouteInterface возвращает интерфейс маршрута 0.0.0.0/0 из route
+func defaultRouteInterface(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 8 && fields[1] == "00000000" && fields[7] == "00000000" {
+			return fields[0]
+		}
+	}
+	return ""
+}
+
+// interfaceAddresses возвращает адреса поднятых интерфейсов без loopback и
+// link-local, а также MAC первого интерфейса с адресом (по имени)
+func interfaceAddresses() ([]string, string) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, ""
+	}
+	sort.Slice(ifaces, func(i, j int) bool { return ifaces[i].Name < ifaces[j].Name })
+
+	var ips []string
+	mac := ""
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		hasAddr := false
+		for _, addr := range addrs {
+			ipnet, ok := addr.(*net.IPNet)
+			if !ok || ipnet.IP.IsLoopback() || ipnet.IP.IsLinkLocalUnicast() {
+				continue
+			}
+			ips = append(ips, ipnet.IP.String())
+			hasAddr = true
+		}
+		if hasAddr && mac == "" && len(iface.HardwareAddr) > 0 {
+			mac = iface.HardwareAddr.String()
+		}
+	}
+	return ips, mac
+}
+
+// readOSRelease разбирает KEY=value из /etc/os-release
+func (h *hostContext) readOSRelease() map[string]string {
+	values := make(map[string]string)
+	for _, path := range osReleasePaths {
+		path = filepath.Join(h.rootDir, path)
+		// абсолютная ссылка (/etc/os-release -> /usr/lib/os-release)
+		// указывает на файл хоста, а не контейнера
+		if target, err := os.Readlink(path); err == nil && filepath.IsAbs(target) {
+			path = filepath.Join(h.rootDir, target)
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			key, value, ok := strings.Cut(line, "=")
+			if !ok {
+				continue
+			}
+			values[key] = strings.Trim(value, `"'`)
+		}
+		file.Close()
+		break
+	}
+	return values
+}
+
+func (h *hostContext) readDMI() map[string]string {
+	dmi := make(map[string]string)
+	for _, name := range []string{"sys_vendor", "product_name", "bios_vendor", "bios_version", "chassis_asset_tag"} {
+		data, err := os.ReadFile(filepath.Join(h.rootDir, dmiPath, name))
+		if err != nil {
+			continue
+		}
+		dmi[name] = strings.TrimSpace(string(data))
+	}
+	return dmi
+}
+
+func detectCloud(dmi map[string]string) string {
+	for _, hint := range cloudDMIHints {
+		if strings.Contains(dmi[hint.file], hint.contains) {
+			return hint.provider
+		}
+	}
+	return ""
+}
+
+func detectVirtualization(dmi map[string]string) string {
+	product := dmi["sys_vendor"] + " " + dmi["product_name"]
+	for _, hint := range virtualizationHints {
+		if strings.Contains(product, hint.contains) {
+			return hint.name
+		}
+	}
+	return ""
+}
+
+// detectContainer: агент сам запущен в контейнере (без root_dir сведения
+// об ОС относятся к образу, а не к хосту)
+func detectContainer() string {
+	if _, err := os.Stat("/.dockerenv"); err == nil {
+		return "docker"
+	}
+	if _, err := os.Stat("/run/.containerenv"); err == nil {
+		return "podman"
+	}
+	return ""
+}
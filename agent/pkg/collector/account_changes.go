@@ -0,0 +1,480 @@
+package collector
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"siem-project/agent/pkg/config"
+	"siem-project/agent/pkg/types"
+)
+
+func init() {
+	Register(ParserFactory{
+		Type:        "accounts",
+		Description: "изменения учетных записей, групп, паролей и sudoers по снимкам /etc",
+		Options: map[string]OptionSpec{
+			"root_dir": {Type: OptionString, Description: "корень файловой системы хоста (/host в контейнере)"},
+			"interval": {Type: OptionDuration, Description: "период проверки файлов", Default: "5s"},
+		},
+		NewCollector: func(source config.SourceConfig, opts Options, hostname string) (Collector, error) {
+			return NewAccountChangeCollector(opts.String("root_dir"), opts.Duration("interval"), hostname), nil
+		},
+	})
+}
+
+// AccountChangeCollector сравнивает снимки passwd, shadow, group и sudoers.
+// Из shadow хранится только отпечаток хеша пароля, сам хеш не сохраняется
+type AccountChangeCollector struct {
+	rootDir      string
+	interval     time.Duration
+	hostname     string
+	snapshotFile string
+
+	snapshot *accountSnapshot
+
+	events chan *types.Event
+	wg     sync.WaitGroup
+	stopCh chan struct{}
+}
+
+type accountSnapshot struct {
+	Users   map[string]passwdEntry `json:"users"`
+	Shadow  map[string]shadowMeta  `json:"shadow"`
+	Groups  map[string]groupEntry  `json:"groups"`
+	Sudoers map[string]string      `json:"sudoers"` // путь -> содержимое
+	// файлы, которые удалось прочитать: нечитаемый файл не означает удаление записей
+	Read map[string]bool `json:"read"`
+}
+
+type shadowMeta struct {
+	Digest     string `json:"digest"`
+	LastChange string `json:"last_change"`
+	Locked     bool   `json:"locked"`
+	Empty      bool   `json:"empty"`
+}
+
+type groupEntry struct {
+	GID     string   `json:"gid"`
+	Members []string `json:"members"`
+}
+
+func NewAccountChangeCollector(rootDir string, interval time.Duration, hostname string) *AccountChangeCollector {
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	// у источников с разными root_dir свои снимки
+	rootDir = strings.TrimSuffix(rootDir, "/")
+	sum := sha256.Sum256([]byte(rootDir))
+	os.MkdirAll(".offsets", 0755)
+
+	return &AccountChangeCollector{
+		rootDir:      rootDir,
+		interval:     interval,
+		hostname:     hostname,
+		snapshotFile: filepath.Join(".offsets", "accounts_"+hex.EncodeToString(sum[:6])+".json"),
+		events:       make(chan *types.Event, 100),
+		stopCh:       make(chan struct{}),
+	}
+}
+
+func (c *AccountChangeCollector) Start() error {
+	if _, err := os.Stat(c.path("/etc/passwd")); err != nil {
+		return fmt.Errorf("failed to read accounts: %w", err)
+	}
+
+	// сохраненный снимок позволяет заметить изменения, пока агент не работал
+	if data, err := os.ReadFile(c.snapshotFile); err == nil {
+		var snapshot accountSnapshot
+		if json.Unmarshal(data, &snapshot) == nil {
+			c.snapshot = &snapshot
+		}
+	}
+
+	c.wg.Add(1)
+	go c.pollLoop()
+
+	return nil
+}
+
+func (c *AccountChangeCollector) Stop() {
+	close(c.stopCh)
+	c.wg.Wait()
+	close(c.events)
+}
+
+func (c *AccountChangeCollector) Events() <-chan *types.Event {
+	return c.events
+}
+
+func (c *AccountChangeCollector) pollLoop() {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	c.poll()
+	for {
+		select {
+		case <-ticker.C:
+			c.poll()
+		case <-c.stopCh:
+			return
+		}
+	}
+}
+
+func (c *AccountChangeCollector) poll() {
+	current := c.takeSnapshot()
+
+	prev := c.snapshot
+	c.snapshot = current
+	if prev == nil {
+		c.saveSnapshot()
+		return
+	}
+
+	events := c.diff(prev, current)
+	if len(events) == 0 {
+		return
+	}
+	c.saveSnapshot()
+
+	for _, event := range events {
+		select {
+		case c.events <- event:
+		case <-c.stopCh:
+			return
+		}
+	}
+}
+
+func (c *AccountChangeCollector) takeSnapshot() *accountSnapshot {
+	snapshot := &accountSnapshot{
+		Users:   make(map[string]passwdEntry),
+		Shadow:  make(map[string]shadowMeta),
+		Groups:  make(map[string]groupEntry),
+		Sudoers: make(map[string]string),
+		Read:    make(map[string]bool),
+	}
+
+	if entries, err := readPasswd(c.path("/etc/passwd")); err == nil {
+		snapshot.Read["passwd"] = true
+		for _, entry := range entries {
+			snapshot.Users[entry.Name] = entry
+		}
+	}
+
+	if records, err := readColonFile(c.path("/etc/shadow")); err == nil {
+		snapshot.Read["shadow"] = true
+		for _, rec := range records {
+			if len(rec) < 3 {
+				continue
+			}
+			hash := sha256.Sum256([]byte(rec[1]))
+			snapshot.Shadow[rec[0]] = shadowMeta{
+				Digest:     hex.EncodeToString(hash[:8]),
+				LastChange: rec[2],
+				Locked:     strings.HasPrefix(rec[1], "!"),
+				Empty:      rec[1] == "",
+			}
+		}
+	}
+
+	if records, err := readColonFile(c.path("/etc/group")); err == nil {
+		snapshot.Read["group"] = true
+		for _, rec := range records {
+			if len(rec) < 4 {
+				continue
+			}
+			var members []string
+			for _, member := range strings.Split(rec[3], ",") {
+				if member = strings.TrimSpace(member); member != "" {
+					members = append(members, member)
+				}
+			}
+			snapshot.Groups[rec[0]] = groupEntry{GID: rec[2], Members: members}
+		}
+	}
+
+	sudoers := []string{c.path("/etc/sudoers")}
+	if entries, err := os.ReadDir(c.path("/etc/sudoers.d")); err == nil {
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				sudoers = append(sudoers, filepath.Join(c.path("/etc/sudoers.d"), entry.Name()))
+			}
+		}
+	}
+	for _, path := range sudoers {
+		if data, err := os.ReadFile(path); err == nil {
+			snapshot.Read["sudoers"] = true
+			snapshot.Sudoers[path] = string(data)
+		}
+	}
+
+	return snapshot
+}
+
+// diff сравнивает снимки; разделы, которые не удалось прочитать сейчас
+// или в прошлый раз, пропускаются
+func (c *AccountChangeCollector) diff(prev, cur *accountSnapshot) []*types.Event {
+	var events []*types.Event
+	both := func(name string) bool {
+		return prev.Read[name] && cur.Read[name]
+	}
+
+	if both("passwd") {
+		for _, name := range sortedKeys(cur.Users) {
+			user := cur.Users[name]
+			old, existed := prev.Users[name]
+			switch {
+			case !existed && user.UID == "0":
+				events = append(events, c.userEvent("uid0_account_added", "critical", user, "new account with UID 0"))
+			case !existed:
+				events = append(events, c.userEvent("user_created", "medium", user, "new account"))
+			case user.UID == "0" && old.UID != "0":
+				event := c.userEvent("uid0_account_added", "critical", user, "UID changed to 0")
+				event.SetField("old_uid", old.UID)
+				events = append(events, event)
+			case user != old:
+				events = append(events, c.userModified(old, user))
+			}
+		}
+		for _, name := range sortedKeys(prev.Users) {
+			if _, ok := cur.Users[name]; !ok {
+				severity := "medium"
+				if prev.Users[name].UID == "0" {
+					severity = "high"
+				}
+				events = append(events, c.userEvent("user_deleted", severity, prev.Users[name], "account removed"))
+			}
+		}
+	}
+
+	if both("shadow") {
+		for _, name := range sortedKeys(cur.Shadow) {
+			meta := cur.Shadow[name]
+			old, existed := prev.Shadow[name]
+			if !existed || old.Digest == meta.Digest {
+				continue
+			}
+			events = append(events, c.passwordEvent(name, old, meta))
+		}
+	}
+
+	if both("group") {
+		events = append(events, c.groupEvents(prev.Groups, cur.Groups)...)
+	}
+
+	if both("sudoers") {
+		events = append(events, c.sudoersEvents(prev.Sudoers, cur.Sudoers)...)
+	}
+
+	return events
+}
+
+func (c *AccountChangeCollector) userEvent(eventType, severity string, user passwdEntry, summary string) *types.Event {
+	raw := fmt.Sprintf("%s: %s:%s:%s:%s:%s", summary, user.Name, user.UID, user.GID, user.Home, user.Shell)
+	event := types.NewEvent("accounts", eventType, severity, raw)
+	event.SetHostname(c.hostname)
+	event.User = user.Name
+	event.SetField("target_user", user.Name)
+	event.SetField("uid", user.UID)
+	event.SetField("gid", user.GID)
+	event.SetField("home", user.Home)
+	event.SetField("shell", user.Shell)
+	return event
+}
+
+func (c *AccountChangeCollector) userModified(old, user passwdEntry) *types.Event {
+	event := c.userEvent("user_modified", "medium", user, "account changed")
+
+	var changed []string
+	compare := func(field, before, after string) {
+		if before != after {
+			changed = append(changed, field)
+			event.SetField("old_"+field, before)
+		}
+	}
+	compare("uid", old.UID, user.UID)
+	compare("gid", old.GID, user.GID)
+	compare("home", old.Home, user.Home)
+	compare("shell", old.Shell, user.Shell)
+	event.SetField("changed", strings.Join(changed, ","))
+
+	// системной учетной записи дали shell для входа
+	if old.Shell != user.Shell && isNologinShell(old.Shell) && !isNologinShell(user.Shell) {
+		event.Severity = "high"
+	}
+	return event
+}
+
+func (c *AccountChangeCollector) passwordEvent(name string, old, meta shadowMeta) *types.Event {
+	event := types.NewEvent("accounts", "password_changed", "medium", "password changed for "+name)
+	event.SetHostname(c.hostname)
+	event.User = name
+	event.SetField("target_user", name)
+	event.SetField("last_change", meta.LastChange)
+
+	switch {
+	case meta.Empty:
+		event.Severity = "high"
+		event.SetField("empty_password", "true")
+	case meta.Locked && !old.Locked:
+		event.SetField("account_locked", "true")
+	case !meta.Locked && old.Locked:
+		event.SetField("account_unlocked", "true")
+	}
+	if c.snapshot.Users[name].UID == "0" && !meta.Locked {
+		event.Severity = "high"
+	}
+	return event
+}
+
+func (c *AccountChangeCollector) groupEvents(prev, cur map[string]groupEntry) []*types.Event {
+	var events []*types.Event
+
+	for _, name := range sortedKeys(cur) {
+		group := cur[name]
+		old, existed := prev[name]
+		if !existed {
+			event := c.groupEvent("group_created", "low", name, group, "new group")
+			if group.GID == "0" {
+				event.Severity = "high"
+			}
+			events = append(events, event)
+			if len(group.Members) == 0 {
+				continue
+			}
+		}
+
+		added, removed := diffMembers(old.Members, group.Members)
+		if len(added) == 0 && len(removed) == 0 {
+			continue
+		}
+
+		severity := "medium"
+		if len(added) > 0 && (privilegedGroups[name] || group.GID == "0") {
+			severity = "high"
+		}
+		event := c.groupEvent("group_membership_changed", severity, name, group, "group members changed")
+		event.SetField("added_members", strings.Join(added, ","))
+		event.SetField("removed_members", strings.Join(removed, ","))
+		if len(added) == 1 {
+			event.User = added[0]
+			event.SetField("target_user", added[0])
+		}
+		events = append(events, event)
+	}
+
+	for _, name := range sortedKeys(prev) {
+		if _, ok := cur[name]; !ok {
+			events = append(events, c.groupEvent("group_deleted", "low", name, prev[name], "group removed"))
+		}
+	}
+	return events
+}
+
+func (c *AccountChangeCollector) groupEvent(eventType, severity, name string, group groupEntry, summary string) *types.Event {
+	raw := fmt.Sprintf("%s: %s:%s:%s", summary, name, group.GID, strings.Join(group.Members, ","))
+	event := types.NewEvent("accounts", eventType, severity, raw)
+	event.SetHostname(c.hostname)
+	event.SetField("group", name)
+	event.SetField("gid", group.GID)
+	event.SetField("members", strings.Join(group.Members, ","))
+	return event
+}
+
+func (c *AccountChangeCollector) sudoersEvents(prev, cur map[string]string) []*types.Event {
+	var events []*types.Event
+
+	for _, path := range sortedKeys(cur) {
+		old, existed := prev[path]
+		switch {
+		case !existed:
+			events = append(events, c.sudoersEvent(path, "created", "", cur[path]))
+		case old != cur[path]:
+			events = append(events, c.sudoersEvent(path, "modified", old, cur[path]))
+		}
+	}
+	for _, path := range sortedKeys(prev) {
+		if _, ok := cur[path]; !ok {
+			events = append(events, c.sudoersEvent(path, "deleted", prev[path], ""))
+		}
+	}
+	return events
+}
+
+func (c *AccountChangeCollector) sudoersEvent(path, change, before, after string) *types.Event {
+	event := types.NewEvent("accounts", "sudoers_modified", "high", fmt.Sprintf("sudoers %s: %s", change, path))
+	event.SetHostname(c.hostname)
+	event.SetField("path", strings.TrimPrefix(path, c.rootDir))
+	event.SetField("change", change)
+	event.SetField("diff", textDiff(before, after))
+
+	// появилось правило, разрешающее sudo без пароля
+	if strings.Count(after, "NOPASSWD") > strings.Count(before, "NOPASSWD") {
+		event.Severity = "critical"
+		event.SetField("nopasswd_added", "true")
+	}
+	return event
+}
+
+func (c *AccountChangeCollector) saveSnapshot() {
+	data, err := json.Marshal(c.snapshot)
+	if err != nil {
+		return
+	}
+	if err := os.WriteFile(c.snapshotFile, data, 0600); err != nil {
+		log.Printf("Не удалось сохранить снимок учетных записей: %v", err)
+	}
+}
+
+func (c *AccountChangeCollector) path(name string) string {
+	return filepath.Join(c.rootDir, name)
+}
+
+func diffMembers(before, after []string) ([]string, []string) {
+	had := make(map[string]bool, len(before))
+	for _, m := range before {
+		had[m] = true
+	}
+	has := make(map[string]bool, len(after))
+	for _, m := range after {
+		has[m] = true
+	}
+
+	var added, removed []string
+	for _, m := range after {
+		if !had[m] {
+			added = append(added, m)
+		}
+	}
+	for _, m := range before {
+		if !has[m] {
+			removed = append(removed, m)
+		}
+	}
+	return added, removed
+}
+
+func isNologinShell(shell string) bool {
+	return shell == "" || strings.HasSuffix(shell, "/nologin") || strings.HasSuffix(shell, "/false")
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
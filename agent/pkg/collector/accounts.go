@@ -0,0 +1,147 @@
+package collector
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultPasswdPath = "/etc/passwd"
+	defaultGroupPath  = "/etc/group"
+
+	// как часто проверять mtime файлов учетных записей
+	accountsCheckInterval = 5 * time.Second
+)
+
+// строка /etc/passwd
+type passwdEntry struct {
+	Name  string
+	UID   string
+	GID   string
+	Home  string
+	Shell string
+}
+
+// idResolver переводит uid/gid в имена по /etc/passwd и /etc/group,
+// кеш перечитывается при изменении файлов
+type idResolver struct {
+	passwdPath string
+	groupPath  string
+
+	mu          sync.Mutex
+	users       map[string]string
+	groups      map[string]string
+	passwdMtime time.Time
+	groupMtime  time.Time
+	lastCheck   time.Time
+}
+
+func newIDResolver(passwdPath, groupPath string) *idResolver {
+	return &idResolver{
+		passwdPath: passwdPath,
+		groupPath:  groupPath,
+		users:      make(map[string]string),
+		groups:     make(map[string]string),
+	}
+}
+
+// UserName возвращает имя пользователя или сам uid, если он неизвестен
+func (r *idResolver) UserName(uid string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.refresh()
+	if name, ok := r.users[uid]; ok {
+		return name
+	}
+	return uid
+}
+
+// GroupName возвращает имя группы или сам gid, если он неизвестен
+func (r *idResolver) GroupName(gid string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.refresh()
+	if name, ok := r.groups[gid]; ok {
+		return name
+	}
+	return gid
+}
+
+func (r *idResolver) refresh() {
+	if time.Since(r.lastCheck) < accountsCheckInterval {
+		return
+	}
+	r.lastCheck = time.Now()
+
+	if stat, err := os.Stat(r.passwdPath); err == nil && !stat.ModTime().Equal(r.passwdMtime) {
+		if entries, err := readPasswd(r.passwdPath); err == nil {
+			users := make(map[string]string, len(entries))
+			for _, entry := range entries {
+				users[entry.UID] = entry.Name
+			}
+			r.users = users
+			r.passwdMtime = stat.ModTime()
+		}
+	}
+
+	if stat, err := os.Stat(r.groupPath); err == nil && !stat.ModTime().Equal(r.groupMtime) {
+		if records, err := readColonFile(r.groupPath); err == nil {
+			groups := make(map[string]string, len(records))
+			for _, rec := range records {
+				if len(rec) >= 3 {
+					groups[rec[2]] = rec[0]
+				}
+			}
+			r.groups = groups
+			r.groupMtime = stat.ModTime()
+		}
+	}
+}
+
+// readPasswd читает файл формата /etc/passwd
+func readPasswd(path string) ([]passwdEntry, error) {
+	records, err := readColonFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]passwdEntry, 0, len(records))
+	for _, rec := range records {
+		if len(rec) < 7 {
+			continue
+		}
+		entries = append(entries, passwdEntry{
+			Name:  rec[0],
+			UID:   rec[2],
+			GID:   rec[3],
+			Home:  rec[5],
+			Shell: rec[6],
+		})
+	}
+	return entries, nil
+}
+
+// readColonFile читает файлы вида name:x:1000:... пропуская комментарии
+func readColonFile(path string) ([][]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var records [][]string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		records = append(records, strings.Split(line, ":"))
+	}
+	return records, scanner.Err()
+}
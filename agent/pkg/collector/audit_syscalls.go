@@ -0,0 +1,54 @@
+package collector
+
+// названия архитектур из поля arch= записей SYSCALL
+var auditArchNames = map[string]string{
+	"c000003e": "x86_64",
+	"40000003": "i386",
+	"c00000b7": "aarch64",
+}
+
+// номера syscall, важные для безопасности, по архитектурам
+var auditSyscallNames = map[string]map[string]string{
+	"x86_64": {
+		"0": "read", "1": "write", "2": "open", "3": "close", "4": "stat",
+		"9": "mmap", "10": "mprotect", "21": "access", "32": "dup", "33": "dup2",
+		"41": "socket", "42": "connect", "43": "accept", "44": "sendto", "45": "recvfrom",
+		"49": "bind", "50": "listen", "56": "clone", "57": "fork", "58": "vfork",
+		"59": "execve", "60": "exit", "62": "kill", "82": "rename", "83": "mkdir",
+		"84": "rmdir", "85": "creat", "86": "link", "87": "unlink", "88": "symlink",
+		"90": "chmod", "91": "fchmod", "92": "chown", "93": "fchown", "94": "lchown",
+		"101": "ptrace", "105": "setuid", "106": "setgid", "113": "setreuid", "114": "setregid",
+		"117": "setresuid", "119": "setresgid", "161": "chroot", "165": "mount", "166": "umount2",
+		"169": "reboot", "175": "init_module", "176": "delete_module", "231": "exit_group",
+		"257": "openat", "258": "mkdirat", "260": "fchownat", "263": "unlinkat", "264": "renameat",
+		"268": "fchmodat", "272": "unshare", "288": "accept4", "308": "setns", "313": "finit_module",
+		"316": "renameat2", "322": "execveat", "435": "clone3", "437": "openat2",
+	},
+	"i386": {
+		"1": "exit", "2": "fork", "3": "read", "4": "write", "5": "open",
+		"6": "close", "9": "link", "10": "unlink", "11": "execve", "15": "chmod",
+		"16": "lchown", "21": "mount", "23": "setuid", "26": "ptrace", "37": "kill",
+		"38": "rename", "39": "mkdir", "40": "rmdir", "46": "setgid", "52": "umount2",
+		"61": "chroot", "88": "reboot", "94": "fchmod", "102": "socketcall", "120": "clone",
+		"128": "init_module", "129": "delete_module", "190": "vfork", "212": "chown32",
+		"213": "setuid32", "214": "setgid32", "295": "openat", "301": "unlinkat",
+		"306": "fchmodat", "350": "finit_module", "358": "execveat",
+	},
+	"aarch64": {
+		"23": "dup", "24": "dup3", "34": "mkdirat", "35": "unlinkat", "37": "linkat",
+		"38": "renameat", "39": "umount2", "40": "mount", "51": "chroot", "52": "fchmod",
+		"53": "fchmodat", "54": "fchownat", "55": "fchown", "56": "openat", "57": "close",
+		"63": "read", "64": "write", "93": "exit", "94": "exit_group", "97": "unshare",
+		"105": "init_module", "106": "delete_module", "117": "ptrace", "129": "kill",
+		"142": "reboot", "144": "setgid", "146": "setuid", "147": "setresuid", "149": "setresgid",
+		"198": "socket", "200": "bind", "201": "listen", "202": "accept", "203": "connect",
+		"206": "sendto", "207": "recvfrom", "220": "clone", "221": "execve", "242": "accept4",
+		"268": "setns", "273": "finit_module", "276": "renameat2", "281": "execveat",
+		"435": "clone3", "437": "openat2",
+	},
+}
+
+// syscallName возвращает имя syscall для arch= и syscall= из записи
+func syscallName(arch, number string) string {
+	return auditSyscallNames[auditArchNames[arch]][number]
+}
@@ -1,22 +1,108 @@
 package collector
 
 import (
+	"encoding/hex"
+	"fmt"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
+	"siem-project/agent/pkg/config"
 	"siem-project/agent/pkg/types"
 )
 
+// сколько ждать недостающие записи события, если EOE так и не пришел
+const auditFlushTimeout = 2 * time.Second
+
+// записи ядра, которые относятся к одному syscall и собираются в одно событие
+var auditKernelRecordTypes = map[string]bool{
+	"SYSCALL":    true,
+	"EXECVE":     true,
+	"CWD":        true,
+	"PATH":       true,
+	"PROCTITLE":  true,
+	"SOCKADDR":   true,
+	"OBJ_PID":    true,
+	"MMAP":       true,
+	"BPRM_FCAPS": true,
+	"FD_PAIR":    true,
+}
+
+// значение uid/ses, означающее "не задано" ((uint32)-1)
+const auditUnsetID = "4294967295"
+
+// поля, которые auditd пишет в hex, если в значении есть пробелы или спецсимволы
+var auditEncodedFields = map[string]bool{
+	"proctitle": true,
+	"name":      true,
+	"cwd":       true,
+	"comm":      true,
+	"exe":       true,
+	"acct":      true,
+	"path":      true,
+	"data":      true,
+	"cmd":       true,
+}
+
+// поля с uid, которые переводятся в имена пользователей
+var auditUIDFields = []string{"uid", "auid", "euid", "suid", "fsuid", "ouid"}
+
+func init() {
+	Register(ParserFactory{
+		Type:        "auditd",
+		Description: "/var/log/audit/audit.log, записи собираются в события по audit ID",
+		Options: map[string]OptionSpec{
+			"flush_timeout": {Type: OptionDuration, Description: "ожидание недостающих записей события", Default: "2s"},
+			"passwd_path":   {Type: OptionString, Description: "файл для имен пользователей", Default: defaultPasswdPath},
+			"group_path":    {Type: OptionString, Description: "файл для имен групп", Default: defaultGroupPath},
+		},
+		NewParser: func(source config.SourceConfig, opts Options) (LogParser, error) {
+			parser := NewAuditdParser()
+			parser.flushTimeout = opts.Duration("flush_timeout")
+			parser.ids = newIDResolver(opts.String("passwd_path"), opts.String("group_path"))
+			return parser, nil
+		},
+	})
+}
+
 // /var/log/audit/audit.log
 type AuditdParser struct {
-	typeRegex  *regexp.Regexp
-	fieldRegex *regexp.Regexp
+	typeRegex    *regexp.Regexp
+	fieldRegex   *regexp.Regexp
+	idRegex      *regexp.Regexp
+	argRegex     *regexp.Regexp
+	hexRegex     *regexp.Regexp
+	flushTimeout time.Duration
+	groups       map[string]*auditGroup
+	ids          *idResolver
+}
+
+// записи одного события audit(ts:serial)
+type auditGroup struct {
+	id       string
+	ts       time.Time
+	records  []auditRecord
+	received time.Time
+}
+
+type auditRecord struct {
+	auditType string
+	line      string
+	fields    map[string]string
 }
 
 func NewAuditdParser() *AuditdParser {
 	return &AuditdParser{
-		typeRegex:  regexp.MustCompile(`type=(\w+)`),
-		fieldRegex: regexp.MustCompile(`(\w+)=([^\s]+)`),
+		typeRegex:    regexp.MustCompile(`type=(\w+)`),
+		fieldRegex:   regexp.MustCompile(`(\w+)=("[^"]*"|'[^']*'|[^\s]+)`),
+		idRegex:      regexp.MustCompile(`msg=audit\((\d+)\.(\d+):(\d+)\)`),
+		argRegex:     regexp.MustCompile(`^a\d+$`),
+		hexRegex:     regexp.MustCompile(`^(?:[0-9A-F]{2})+$`),
+		flushTimeout: auditFlushTimeout,
+		groups:       make(map[string]*auditGroup),
+		ids:          newIDResolver(defaultPasswdPath, defaultGroupPath),
 	}
 }
 
@@ -24,6 +110,9 @@ func (p *AuditdParser) GetSourceType() string {
 	return "auditd"
 }
 
+// Parse накапливает записи ядра по ID audit(ts:serial) и возвращает
+// составное событие, когда приходит EOE. Одиночные записи (USER_*, CRED_*
+// и т.д.) возвращаются сразу. Пока событие не собрано, возвращается nil
 func (p *AuditdParser) Parse(line string, hostname string) (*types.Event, error) {
 	// type=SYSCALL msg=audit(1234567890.123:456): arch=c000003e syscall=59 success=yes
 	line = strings.TrimSpace(line)
@@ -32,34 +121,246 @@ func (p *AuditdParser) Parse(line string, hostname string) (*types.Event, error)
 	}
 
 	auditType := p.extractType(line)
-	eventType := p.mapAuditType(auditType)
-	severity := p.determineSeverity(auditType, line)
+	record := auditRecord{
+		auditType: auditType,
+		line:      line,
+		fields:    p.decodeFields(auditType, p.extractFields(line)),
+	}
+
+	id, ts, ok := p.extractID(line)
+	if !ok {
+		return p.buildEvent(hostname, time.Time{}, "", []auditRecord{record}), nil
+	}
+
+	group, exists := p.groups[id]
+	if record.auditType == "EOE" {
+		if !exists {
+			return nil, nil
+		}
+		delete(p.groups, id)
+		return p.buildEvent(hostname, group.ts, group.id, group.records), nil
+	}
+
+	if !exists && !auditKernelRecordTypes[record.auditType] {
+		return p.buildEvent(hostname, ts, id, []auditRecord{record}), nil
+	}
+
+	if !exists {
+		group = &auditGroup{id: id, ts: ts}
+		p.groups[id] = group
+	}
+	group.records = append(group.records, record)
+	group.received = time.Now()
+
+	return nil, nil
+}
+
+// Flush возвращает группы, которые не получили EOE за flushTimeout
+// (у одиночных записей ядра EOE не бывает). force сбрасывает все группы
+func (p *AuditdParser) Flush(hostname string, force bool) []*types.Event {
+	var expired []*auditGroup
+	for id, group := range p.groups {
+		if force || time.Since(group.received) >= p.flushTimeout {
+			expired = append(expired, group)
+			delete(p.groups, id)
+		}
+	}
+
+	sort.Slice(expired, func(i, j int) bool {
+		return expired[i].ts.Before(expired[j].ts)
+	})
+
+	events := make([]*types.Event, 0, len(expired))
+	for _, group := range expired {
+		events = append(events, p.buildEvent(hostname, group.ts, group.id, group.records))
+	}
+	return events
+}
+
+// buildEvent собирает одно событие из всех записей группы
+func (p *AuditdParser) buildEvent(hostname string, ts time.Time, id string, records []auditRecord) *types.Event {
+	primary := records[0]
+	var syscall *auditRecord
+	var execve *auditRecord
+	var cwd string
+	var paths []string
+	var proctitle string
+	rawLines := make([]string, 0, len(records))
+	recordTypes := make([]string, 0, len(records))
+
+	for i := range records {
+		rec := &records[i]
+		rawLines = append(rawLines, rec.line)
+		recordTypes = append(recordTypes, rec.auditType)
+
+		switch rec.auditType {
+		case "SYSCALL":
+			syscall = rec
+		case "EXECVE":
+			execve = rec
+		case "CWD":
+			cwd = rec.fields["cwd"]
+		case "PATH":
+			if name, ok := rec.fields["name"]; ok {
+				paths = append(paths, name)
+			}
+		case "PROCTITLE":
+			proctitle = rec.fields["proctitle"]
+		}
+	}
+
+	// тип события определяется главной записью: EXECVE важнее SYSCALL
+	auditType := primary.auditType
+	severityLine := primary.line
+	if syscall != nil {
+		auditType = "SYSCALL"
+		severityLine = syscall.line
+	}
+	if execve != nil {
+		auditType = "EXECVE"
+	}
 
-	event := types.NewEvent("auditd", eventType, severity, line)
+	event := types.NewEvent("auditd", p.mapAuditType(auditType), p.determineSeverity(auditType, severityLine, syscallNameOf(syscall)), strings.Join(rawLines, "\n"))
 	event.SetHostname(hostname)
+	if !ts.IsZero() {
+		event.SetTimestamp(ts)
+	}
+	event.SetField("audit_id", id)
+	if len(records) > 1 {
+		event.SetField("record_types", strings.Join(recordTypes, ","))
+	}
 
-	fields := p.extractFields(line)
+	// поля процесса берем из SYSCALL, если он есть
+	fields := primary.fields
+	if syscall != nil {
+		fields = syscall.fields
+	}
 
-	if uid, ok := fields["uid"]; ok {
-		event.User = uid
-	} else if auid, ok := fields["auid"]; ok {
-		event.User = auid
+	for _, key := range auditUIDFields {
+		if uid := fields[key]; uid != "" && uid != "unset" {
+			event.SetField(key+"_name", p.ids.UserName(uid))
+		}
+	}
+	if gid := fields["gid"]; gid != "" {
+		event.SetField("gid_name", p.ids.GroupName(gid))
+	}
+
+	if uid := fields["uid"]; uid != "" && uid != "unset" {
+		event.User = p.ids.UserName(uid)
+	} else if auid := fields["auid"]; auid != "" && auid != "unset" {
+		event.User = p.ids.UserName(auid)
 	}
 
 	// comm/exe
 	if comm, ok := fields["comm"]; ok {
-		event.Process = strings.Trim(comm, `"`)
+		event.Process = comm
 	} else if exe, ok := fields["exe"]; ok {
-		event.Process = strings.Trim(exe, `"`)
+		event.Process = exe
+	}
+
+	for _, key := range []string{"uid", "auid", "euid", "gid", "pid", "ppid", "ses", "syscall", "success", "exit", "tty", "key", "acct", "res", "addr", "terminal"} {
+		event.SetField(key, fields[key])
+	}
+	if arch, ok := auditArchNames[fields["arch"]]; ok {
+		event.SetField("arch", arch)
+		event.SetField("syscall_name", syscallName(fields["arch"], fields["syscall"]))
+	}
+	event.SetField("exe", fields["exe"])
+	if cwd == "" {
+		cwd = fields["cwd"]
 	}
+	event.SetField("cwd", cwd)
+	event.SetField("paths", strings.Join(paths, ","))
+	event.SetField("proctitle", proctitle)
 
-	if auditType == "EXECVE" {
-		if a0, ok := fields["a0"]; ok {
-			event.Command = strings.Trim(a0, `"`)
+	if execve != nil {
+		argv := p.execveArgs(execve.fields)
+		event.Command = strings.Join(argv, " ")
+		event.SetField("argc", strconv.Itoa(len(argv)))
+	} else if cmd := fields["cmd"]; cmd != "" {
+		// USER_CMD от sudo
+		event.Command = cmd
+	}
+
+	return event
+}
+
+func syscallNameOf(rec *auditRecord) string {
+	if rec == nil {
+		return ""
+	}
+	return syscallName(rec.fields["arch"], rec.fields["syscall"])
+}
+
+// execveArgs собирает argv из полей a0..aN записи EXECVE
+func (p *AuditdParser) execveArgs(fields map[string]string) []string {
+	argc, err := strconv.Atoi(fields["argc"])
+	if err != nil {
+		argc = 0
+		for {
+			if _, ok := fields[fmt.Sprintf("a%d", argc)]; !ok {
+				break
+			}
+			argc++
 		}
 	}
 
-	return event, nil
+	args := make([]string, 0, argc)
+	for i := 0; i < argc; i++ {
+		if arg, ok := fields[fmt.Sprintf("a%d", i)]; ok {
+			args = append(args, arg)
+		}
+	}
+	return args
+}
+
+// extractID возвращает ID события и время из msg=audit(1234567890.123:456)
+func (p *AuditdParser) extractID(line string) (string, time.Time, bool) {
+	m := p.idRegex.FindStringSubmatch(line)
+	if m == nil {
+		return "", time.Time{}, false
+	}
+
+	sec, _ := strconv.ParseInt(m[1], 10, 64)
+	frac := m[2]
+	for len(frac) < 9 {
+		frac += "0"
+	}
+	nsec, _ := strconv.ParseInt(frac[:9], 10, 64)
+
+	return m[1] + "." + m[2] + ":" + m[3], time.Unix(sec, nsec), true
+}
+
+// decodeFields снимает кавычки, декодирует hex-значения (argv EXECVE,
+// proctitle и т.д.) и помечает uid=4294967295 как unset
+func (p *AuditdParser) decodeFields(auditType string, fields map[string]string) map[string]string {
+	for key, value := range fields {
+		switch {
+		case strings.HasPrefix(value, `"`):
+			fields[key] = strings.Trim(value, `"`)
+		case value == "(null)" || value == "(none)":
+			fields[key] = ""
+		case auditEncodedFields[key] || (auditType == "EXECVE" && p.argRegex.MatchString(key)):
+			if p.hexRegex.MatchString(value) {
+				decoded, err := hex.DecodeString(value)
+				if err == nil {
+					fields[key] = strings.TrimSpace(strings.ReplaceAll(string(decoded), "\x00", " "))
+				}
+			}
+		case value == auditUnsetID && (key == "ses" || isAuditUIDField(key)):
+			fields[key] = "unset"
+		}
+	}
+	return fields
+}
+
+func isAuditUIDField(key string) bool {
+	for _, f := range auditUIDFields {
+		if f == key {
+			return true
+		}
+	}
+	return false
 }
 
 func (p *AuditdParser) extractType(line string) string {
@@ -78,6 +379,15 @@ func (p *AuditdParser) extractFields(line string) map[string]string {
 			fields[match[1]] = match[2]
 		}
 	}
+
+	// у пользовательских записей поля вложены в msg='op=login acct="root" ...'
+	if msg, ok := fields["msg"]; ok && strings.HasPrefix(msg, "'") {
+		for _, match := range p.fieldRegex.FindAllStringSubmatch(strings.Trim(msg, "'"), -1) {
+			if _, exists := fields[match[1]]; !exists {
+				fields[match[1]] = match[2]
+			}
+		}
+	}
 	return fields
 }
 
@@ -116,7 +426,7 @@ func (p *AuditdParser) mapAuditType(auditType string) string {
 	}
 }
 
-func (p *AuditdParser) determineSeverity(auditType, line string) string {
+func (p *AuditdParser) determineSeverity(auditType, line, syscall string) string {
 	highPriorityTypes := []string{
 		"USER_LOGIN", "USER_AUTH", "CRED_ACQ", "CRED_DISP",
 		"USER_CMD", "EXECVE",
@@ -133,9 +443,8 @@ func (p *AuditdParser) determineSeverity(auditType, line string) string {
 	}
 
 	if auditType == "SYSCALL" {
-		if strings.Contains(line, "syscall=59") || // execve
-			strings.Contains(line, "syscall=322") || // execveat
-			strings.Contains(line, "syscall=2") { // open
+		switch syscall {
+		case "execve", "execveat", "open", "openat", "init_module", "finit_module", "ptrace", "setuid", "mount":
 			return "medium"
 		}
 	}
@@ -0,0 +1,265 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestAuditdParser(t *testing.T) *AuditdParser {
+	t.Helper()
+	dir := t.TempDir()
+	passwd := filepath.Join(dir, "passwd")
+	group := filepath.Join(dir, "group")
+	if err := os.WriteFile(passwd, []byte("root:x:0:0:root:/root:/bin/bash\nalice:x:1000:1000::/home/alice:/bin/bash\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(group, []byte("root:x:0:\nalice:x:1000:\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewAuditdParser()
+	p.ids = newIDResolver(passwd, group)
+	return p
+}
+
+func TestAuditdGroupsRecordsByID(t *testing.T) {
+	p := newTestAuditdParser(t)
+
+	lines := []string{
+		`type=SYSCALL msg=audit(1700000000.123:456): arch=c000003e syscall=59 success=yes exit=0 a0=55d0 ppid=1200 pid=1234 auid=1000 uid=0 gid=0 euid=0 ses=3 tty=pts0 comm="cat" exe="/usr/bin/cat" key="shadow"`,
+		`type=EXECVE msg=audit(1700000000.123:456): argc=2 a0="cat" a1="/etc/shadow"`,
+		`type=CWD msg=audit(1700000000.123:456): cwd="/root"`,
+		`type=PATH msg=audit(1700000000.123:456): item=0 name="/usr/bin/cat" inode=1 nametype=NORMAL`,
+		`type=PATH msg=audit(1700000000.123:456): item=1 name="/etc/shadow" inode=2 nametype=NORMAL`,
+	}
+	for _, line := range lines {
+		event, err := p.Parse(line, "web01")
+		if err != nil || event != nil {
+			t.Fatalf("Parse(%q) = %v, %v; want nil until EOE", line, event, err)
+		}
+	}
+
+	event, err := p.Parse(`type=EOE msg=audit(1700000000.123:456):`, "web01")
+	if err != nil || event == nil {
+		t.Fatalf("Parse(EOE) = %v, %v; want assembled event", event, err)
+	}
+	if len(p.groups) != 0 {
+		t.Errorf("%d groups left after EOE", len(p.groups))
+	}
+
+	if event.EventType != "process_execution" || event.Severity != "medium" {
+		t.Errorf("type/severity = %s/%s, want process_execution/medium", event.EventType, event.Severity)
+	}
+	if event.Command != "cat /etc/shadow" || event.Process != "cat" || event.User != "root" {
+		t.Errorf("command/process/user = %q/%q/%q", event.Command, event.Process, event.User)
+	}
+	if event.Timestamp != "2023-11-14T22:13:20Z" || event.Fields["timestamp_ns"] != "1700000000123000000" {
+		t.Errorf("timestamp = %s (%s ns), want 2023-11-14T22:13:20Z with .123", event.Timestamp, event.Fields["timestamp_ns"])
+	}
+
+	want := map[string]string{
+		"audit_id":     "1700000000.123:456",
+		"record_types": "SYSCALL,EXECVE,CWD,PATH,PATH",
+		"cwd":          "/root",
+		"paths":        "/usr/bin/cat,/etc/shadow",
+		"argc":         "2",
+		"auid_name":    "alice",
+		"syscall_name": "execve",
+		"arch":         "x86_64",
+		"key":          "shadow",
+	}
+	for key, value := range want {
+		if event.Fields[key] != value {
+			t.Errorf("%s = %q, want %q", key, event.Fields[key], value)
+		}
+	}
+}
+
+func TestAuditdInterleavedGroups(t *testing.T) {
+	p := newTestAuditdParser(t)
+
+	lines := []string{
+		`type=SYSCALL msg=audit(1700000000.100:1): arch=c000003e syscall=257 success=yes uid=1000 comm="vim"`,
+		`type=SYSCALL msg=audit(1700000000.200:2): arch=c000003e syscall=59 success=no uid=0 comm="sh"`,
+		`type=PATH msg=audit(1700000000.100:1): item=0 name="/etc/hosts"`,
+		`type=EXECVE msg=audit(1700000000.200:2): argc=1 a0="id"`,
+	}
+	for _, line := range lines {
+		if event, _ := p.Parse(line, "web01"); event != nil {
+			t.Fatalf("Parse(%q) returned event before EOE", line)
+		}
+	}
+
+	second, _ := p.Parse(`type=EOE msg=audit(1700000000.200:2):`, "web01")
+	first, _ := p.Parse(`type=EOE msg=audit(1700000000.100:1):`, "web01")
+	if first == nil || second == nil {
+		t.Fatalf("events = %v, %v; want both", first, second)
+	}
+
+	if first.EventType != "system_call" || first.Fields["syscall_name"] != "openat" || first.Fields["paths"] != "/etc/hosts" || first.User != "alice" {
+		t.Errorf("first event = %s %v user %s", first.EventType, first.Fields, first.User)
+	}
+	if second.EventType != "process_execution" || second.Severity != "high" || second.Command != "id" {
+		t.Errorf("second event = %s/%s %q, want failed execve", second.EventType, second.Severity, second.Command)
+	}
+}
+
+func TestAuditdStandaloneRecords(t *testing.T) {
+	p := newTestAuditdParser(t)
+
+	tests := []struct {
+		name      string
+		line      string
+		eventType string
+		severity  string
+	}{
+		{
+			name:      "failed login",
+			line:      `type=USER_LOGIN msg=audit(1700000000.500:90): pid=900 uid=0 auid=4294967295 ses=4294967295 msg='op=login acct="bob" exe="/usr/sbin/sshd" addr=192.0.2.1 terminal=ssh res=failed'`,
+			eventType: "user_login",
+			severity:  "high",
+		},
+		{
+			name:      "sudo command",
+			line:      `type=USER_CMD msg=audit(1700000000.600:91): pid=901 uid=1000 auid=1000 ses=3 msg='cwd="/home/alice" cmd=6C73202F726F6F74 exe="/usr/bin/sudo" terminal=pts/0 res=success'`,
+			eventType: "user_command",
+			severity:  "medium",
+		},
+		{
+			name:      "record without audit id",
+			line:      `type=DAEMON_START auditd start, ver=3.0 res=success`,
+			eventType: "audit_event",
+			severity:  "low",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := p.Parse(tt.line, "web01")
+			if err != nil || event == nil {
+				t.Fatalf("Parse() = %v, %v; want event", event, err)
+			}
+			if event.EventType != tt.eventType || event.Severity != tt.severity {
+				t.Errorf("type/severity = %s/%s, want %s/%s", event.EventType, event.Severity, tt.eventType, tt.severity)
+			}
+		})
+	}
+	if len(p.groups) != 0 {
+		t.Errorf("standalone records left %d groups", len(p.groups))
+	}
+
+	if event, _ := p.Parse(`type=EOE msg=audit(1700000000.700:92):`, "web01"); event != nil {
+		t.Errorf("EOE without records produced %+v", event)
+	}
+}
+
+func TestAuditdFlush(t *testing.T) {
+	p := newTestAuditdParser(t)
+	p.flushTimeout = time.Hour
+
+	p.Parse(`type=SYSCALL msg=audit(1700000002.000:20): arch=c000003e syscall=90 success=yes uid=0 comm="chmod"`, "web01")
+	p.Parse(`type=SYSCALL msg=audit(1700000001.000:10): arch=c000003e syscall=101 success=yes uid=0 comm="gdb"`, "web01")
+
+	if events := p.Flush("web01", false); len(events) != 0 {
+		t.Fatalf("Flush before timeout returned %d events", len(events))
+	}
+
+	events := p.Flush("web01", true)
+	if len(events) != 2 {
+		t.Fatalf("Flush(force) returned %d events, want 2", len(events))
+	}
+	if events[0].Fields["syscall_name"] != "ptrace" || events[1].Fields["syscall_name"] != "chmod" {
+		t.Errorf("events not ordered by time: %s, %s", events[0].Fields["syscall_name"], events[1].Fields["syscall_name"])
+	}
+	if len(p.groups) != 0 {
+		t.Errorf("%d groups left after forced flush", len(p.groups))
+	}
+
+	p.flushTimeout = 0
+	p.Parse(`type=SYSCALL msg=audit(1700000003.000:30): arch=c000003e syscall=165 success=yes uid=0 comm="mount"`, "web01")
+	if events := p.Flush("web01", false); len(events) != 1 || events[0].Severity != "medium" {
+		t.Errorf("Flush after timeout = %v, want one mount event", events)
+	}
+}
+
+func TestAuditdDecodeFields(t *testing.T) {
+	p := NewAuditdParser()
+
+	tests := []struct {
+		name      string
+		auditType string
+		key       string
+		value     string
+		want      string
+	}{
+		{"proctitle with nul separators", "PROCTITLE", "proctitle", "6C73002D6C61002F746D70", "ls -la /tmp"},
+		{"path with space", "PATH", "name", "2F746D702F6D7920646972", "/tmp/my dir"},
+		{"quoted path", "PATH", "name", `"/etc/shadow"`, "/etc/shadow"},
+		{"execve argument", "EXECVE", "a1", "2D63206964", "-c id"},
+		{"argument outside execve", "SYSCALL", "a1", "2D63206964", "2D63206964"},
+		{"lowercase hex left as is", "PATH", "name", "cafebabe", "cafebabe"},
+		{"odd length hex left as is", "PATH", "name", "ABC", "ABC"},
+		{"sudo command", "USER_CMD", "cmd", "6C73202F726F6F74", "ls /root"},
+		{"null value", "PATH", "name", "(null)", ""},
+		{"unset auid", "SYSCALL", "auid", "4294967295", "unset"},
+		{"unset session", "SYSCALL", "ses", "4294967295", "unset"},
+		{"pid is not an id", "SYSCALL", "pid", "4294967295", "4294967295"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := p.decodeFields(tt.auditType, map[string]string{tt.key: tt.value})
+			if got[tt.key] != tt.want {
+				t.Errorf("decodeFields(%s=%s) = %q, want %q", tt.key, tt.value, got[tt.key], tt.want)
+			}
+		})
+	}
+}
+
+func TestAuditdHexEncodedEvent(t *testing.T) {
+	p := newTestAuditdParser(t)
+
+	lines := []string{
+		`type=SYSCALL msg=audit(1700000000.001:77): arch=c000003e syscall=59 success=yes uid=1000 comm="bash" exe="/usr/bin/bash"`,
+		`type=EXECVE msg=audit(1700000000.001:77): argc=3 a0="bash" a1="-c" a2=6563686F2068656C6C6F203E202F746D702F6F7574`,
+		`type=CWD msg=audit(1700000000.001:77): cwd=2F686F6D652F616C6963652F6D7920646F6373`,
+		`type=PROCTITLE msg=audit(1700000000.001:77): proctitle=62617368002D63006563686F2068656C6C6F203E202F746D702F6F7574`,
+	}
+	for _, line := range lines {
+		p.Parse(line, "web01")
+	}
+	event, _ := p.Parse(`type=EOE msg=audit(1700000000.001:77):`, "web01")
+	if event == nil {
+		t.Fatal("no event after EOE")
+	}
+
+	if event.Command != "bash -c echo hello > /tmp/out" {
+		t.Errorf("command = %q", event.Command)
+	}
+	if event.Fields["cwd"] != "/home/alice/my docs" {
+		t.Errorf("cwd = %q", event.Fields["cwd"])
+	}
+	if event.Fields["proctitle"] != "bash -c echo hello > /tmp/out" {
+		t.Errorf("proctitle = %q", event.Fields["proctitle"])
+	}
+}
+
+func TestSyscallName(t *testing.T) {
+	tests := []struct {
+		arch, number, want string
+	}{
+		{"c000003e", "59", "execve"},
+		{"c000003e", "257", "openat"},
+		{"40000003", "11", "execve"},
+		{"c00000b7", "221", "execve"},
+		{"c00000b7", "59", ""},
+		{"deadbeef", "59", ""},
+	}
+	for _, tt := range tests {
+		if got := syscallName(tt.arch, tt.number); got != tt.want {
+			t.Errorf("syscallName(%s, %s) = %q, want %q", tt.arch, tt.number, got, tt.want)
+		}
+	}
+}
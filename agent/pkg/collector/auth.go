@@ -0,0 +1,260 @@
+package collector
+
+import (
+	"regexp"
+	"strings"
+
+	"siem-project/agent/pkg/types"
+)
+
+// группы, членство в которых дает повышенные привилегии
+var privilegedGroups = map[string]bool{
+	"root":  true,
+	"sudo":  true,
+	"wheel": true,
+	"admin": true,
+	"adm":   true,
+}
+
+// authExtractor достает структурированные поля из сообщений sshd, pam_unix,
+// su и утилит управления учетными записями
+type authExtractor struct {
+	sshAccepted      *regexp.Regexp
+	sshFailed        *regexp.Regexp
+	sshInvalidUser   *regexp.Regexp
+	sshDisconnected  *regexp.Regexp
+	sshClosed        *regexp.Regexp
+	sshTooMany       *regexp.Regexp
+	sshMaxAttempts   *regexp.Regexp
+	pamAuthFailure   *regexp.Regexp
+	pamSession       *regexp.Regexp
+	pamPasswdChanged *regexp.Regexp
+	keyValue         *regexp.Regexp
+	suSwitch         *regexp.Regexp
+	newUser          *regexp.Regexp
+	newGroup         *regexp.Regexp
+	addToGroup       *regexp.Regexp
+	quotedUser       *regexp.Regexp
+}
+
+func newAuthExtractor() *authExtractor {
+	return &authExtractor{
+		// Accepted publickey for alice from 10.0.0.5 port 52144 ssh2: RSA SHA256:abc
+		sshAccepted: regexp.MustCompile(`^Accepted (\S+) for (\S+) from (\S+) port (\d+)(?: [^\s:]+)?(?:: (\S+) (\S+))?`),
+		// Failed password for invalid user bob from 10.0.0.5 port 2222 ssh2
+		sshFailed: regexp.MustCompile(`^Failed (\S+) for (invalid user )?(\S+) from (\S+) port (\d+)`),
+		// Invalid user bob from 10.0.0.5 port 5555
+		sshInvalidUser: regexp.MustCompile(`^Invalid user (\S*) from (\S+)(?: port (\d+))?`),
+		// Disconnected from invalid user bob 10.0.0.5 port 5555 [preauth]
+		sshDisconnected: regexp.MustCompile(`^(?:Received disconnect|Disconnected) from (?:(?:invalid |authenticating )?user (\S+) )?(\S+) port (\d+)`),
+		// Connection closed by authenticating user root 10.0.0.5 port 5555 [preauth]
+		sshClosed: regexp.MustCompile(`^Connection (?:closed|reset) by (?:(?:invalid |authenticating )?user (\S+) )?(\S+) port (\d+)`),
+		// Disconnecting authenticating user root 10.0.0.5 port 22: Too many authentication failures
+		sshTooMany: regexp.MustCompile(`^Disconnecting (?:(?:invalid |authenticating )?user (\S+) )?(\S+) port (\d+): Too many authentication failures`),
+		// error: maximum authentication attempts exceeded for root from 10.0.0.5 port 5555 ssh2
+		sshMaxAttempts: regexp.MustCompile(`maximum authentication attempts exceeded for (invalid user )?(\S+) from (\S+) port (\d+)`),
+		// pam_unix(sshd:auth): authentication failure; logname= uid=0 euid=0 tty=ssh ruser= rhost=10.0.0.5  user=root
+		pamAuthFailure: regexp.MustCompile(`pam_unix\((\S+?):auth\): authentication failure;`),
+		// pam_unix(su:session): session opened for user root(uid=0) by alice(uid=1000)
+		pamSession: regexp.MustCompile(`pam_unix\((\S+?):session\): session (opened|closed) for user ([^\s(]+)(?:\(uid=\d+\))?(?: by ([^\s(]*))?`),
+		// pam_unix(passwd:chauthtok): password changed for bob
+		pamPasswdChanged: regexp.MustCompile(`pam_unix\(\S+:chauthtok\): password changed for (\S+)`),
+		keyValue:         regexp.MustCompile(`(\w+)=(\S*)`),
+		// (to root) alice on pts/0 / FAILED SU (to root) alice on pts/0
+		suSwitch: regexp.MustCompile(`^(FAILED SU )?\(to (\S+)\) (\S+) on (\S+)`),
+		// new user: name=bob, UID=1001, GID=1001, home=/home/bob, shell=/bin/bash, from=/dev/pts/0
+		newUser: regexp.MustCompile(`^new user: name=([^,]+), UID=(\d+), GID=(\d+), home=([^,]*), shell=([^,]*)`),
+		// new group: name=dev, GID=1002 / group added to /etc/group: name=dev, GID=1002
+		newGroup: regexp.MustCompile(`^(?:new group|group added to /etc/group): name=([^,]+), GID=(\d+)`),
+		// add 'bob' to group 'sudo' / add 'bob' to shadow group 'sudo'
+		addToGroup: regexp.MustCompile(`^add '([^']+)' to (?:shadow )?group '([^']+)'`),
+		// delete user 'bob' / change user 'bob' shell / lock user 'bob' password
+		quotedUser: regexp.MustCompile(`^(delete|change|lock|unlock) user '([^']+)'`),
+	}
+}
+
+// extract дополняет событие полями и уточняет тип, если сообщение распознано
+func (a *authExtractor) extract(event *types.Event, process, message string) {
+	if strings.HasSuffix(message, "[preauth]") {
+		event.SetField("preauth", "true")
+	}
+
+	switch {
+	case strings.HasPrefix(process, "sshd"):
+		a.extractSSH(event, message)
+	case process == "su":
+		a.extractSu(event, message)
+	case process == "useradd", process == "usermod", process == "groupadd", process == "userdel", process == "gpasswd":
+		a.extractAccount(event, message)
+	}
+
+	a.extractPAM(event, message)
+}
+
+func (a *authExtractor) extractSSH(event *types.Event, message string) {
+	if m := a.sshAccepted.FindStringSubmatch(message); m != nil {
+		setAuthEvent(event, "user_login", "medium")
+		event.User = m[2]
+		event.SetField("auth_method", m[1])
+		event.SetField("target_user", m[2])
+		event.SetField("src_ip", m[3])
+		event.SetField("src_port", m[4])
+		event.SetField("key_type", m[5])
+		event.SetField("key_fingerprint", m[6])
+		return
+	}
+
+	if m := a.sshFailed.FindStringSubmatch(message); m != nil {
+		setAuthEvent(event, "login_failed", "high")
+		event.User = m[3]
+		event.SetField("auth_method", m[1])
+		event.SetField("target_user", m[3])
+		event.SetField("src_ip", m[4])
+		event.SetField("src_port", m[5])
+		if m[2] != "" {
+			event.SetField("invalid_user", "true")
+		}
+		return
+	}
+
+	if m := a.sshInvalidUser.FindStringSubmatch(message); m != nil {
+		setAuthEvent(event, "invalid_user", "high")
+		event.User = m[1]
+		event.SetField("target_user", m[1])
+		event.SetField("src_ip", m[2])
+		event.SetField("src_port", m[3])
+		return
+	}
+
+	if m := a.sshMaxAttempts.FindStringSubmatch(message); m != nil {
+		setAuthEvent(event, "too_many_auth_failures", "high")
+		event.User = m[2]
+		event.SetField("target_user", m[2])
+		event.SetField("src_ip", m[3])
+		event.SetField("src_port", m[4])
+		return
+	}
+
+	if m := a.sshTooMany.FindStringSubmatch(message); m != nil {
+		setAuthEvent(event, "too_many_auth_failures", "high")
+		event.User = m[1]
+		event.SetField("target_user", m[1])
+		event.SetField("src_ip", m[2])
+		event.SetField("src_port", m[3])
+		return
+	}
+
+	for _, re := range []*regexp.Regexp{a.sshDisconnected, a.sshClosed} {
+		if m := re.FindStringSubmatch(message); m != nil {
+			setAuthEvent(event, "ssh_disconnect", "low")
+			event.User = m[1]
+			event.SetField("target_user", m[1])
+			event.SetField("src_ip", m[2])
+			event.SetField("src_port", m[3])
+			return
+		}
+	}
+}
+
+func (a *authExtractor) extractSu(event *types.Event, message string) {
+	m := a.suSwitch.FindStringSubmatch(message)
+	if m == nil {
+		return
+	}
+
+	if m[1] != "" {
+		setAuthEvent(event, "su_failed", "high")
+	} else {
+		setAuthEvent(event, "su_session", "medium")
+	}
+	event.User = m[3]
+	event.SetField("target_user", m[2])
+	event.SetField("tty", m[4])
+}
+
+func (a *authExtractor) extractAccount(event *types.Event, message string) {
+	if m := a.newUser.FindStringSubmatch(message); m != nil {
+		setAuthEvent(event, "user_created", "high")
+		event.SetField("target_user", m[1])
+		event.SetField("uid", m[2])
+		event.SetField("gid", m[3])
+		event.SetField("home", m[4])
+		event.SetField("shell", m[5])
+		if m[2] == "0" {
+			event.Severity = "critical"
+		}
+		return
+	}
+
+	if m := a.newGroup.FindStringSubmatch(message); m != nil {
+		setAuthEvent(event, "group_created", "medium")
+		event.SetField("group", m[1])
+		event.SetField("gid", m[2])
+		return
+	}
+
+	if m := a.addToGroup.FindStringSubmatch(message); m != nil {
+		setAuthEvent(event, "user_added_to_group", "medium")
+		event.SetField("target_user", m[1])
+		event.SetField("group", m[2])
+		if privilegedGroups[m[2]] {
+			event.Severity = "high"
+		}
+		return
+	}
+
+	if m := a.quotedUser.FindStringSubmatch(message); m != nil {
+		if m[1] == "delete" {
+			setAuthEvent(event, "user_deleted", "high")
+		} else {
+			setAuthEvent(event, "user_modified", "medium")
+		}
+		event.SetField("target_user", m[2])
+	}
+}
+
+func (a *authExtractor) extractPAM(event *types.Event, message string) {
+	if m := a.pamAuthFailure.FindStringSubmatch(message); m != nil {
+		setAuthEvent(event, "auth_failure", "high")
+		event.SetField("pam_service", m[1])
+		kv := a.keyValues(message)
+		event.User = kv["user"]
+		event.SetField("target_user", kv["user"])
+		event.SetField("ruser", kv["ruser"])
+		event.SetField("src_ip", kv["rhost"])
+		event.SetField("tty", kv["tty"])
+		return
+	}
+
+	if m := a.pamSession.FindStringSubmatch(message); m != nil {
+		if m[2] == "opened" {
+			setAuthEvent(event, "session_opened", "medium")
+		} else {
+			setAuthEvent(event, "session_closed", "low")
+		}
+		event.SetField("pam_service", m[1])
+		event.SetField("target_user", m[3])
+		event.SetField("ruser", m[4])
+		event.User = m[3]
+		return
+	}
+
+	if m := a.pamPasswdChanged.FindStringSubmatch(message); m != nil {
+		setAuthEvent(event, "password_changed", "medium")
+		event.User = m[1]
+		event.SetField("target_user", m[1])
+	}
+}
+
+func (a *authExtractor) keyValues(message string) map[string]string {
+	values := make(map[string]string)
+	for _, m := range a.keyValue.FindAllStringSubmatch(message, -1) {
+		values[m[1]] = m[2]
+	}
+	return values
+}
+
+func setAuthEvent(event *types.Event, eventType, severity string) {
+	event.EventType = eventType
+	event.Severity = severity
+}
@@ -3,16 +3,48 @@ package collector
 
 import (
 	"fmt"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"siem-project/agent/pkg/types"
 )
 
-// парсит ~/.bash_history
-type BashHistoryParser struct{}
+// форматы файлов истории
+const (
+	historyFormatBash = "bash"
+	historyFormatZsh  = "zsh"
+	historyFormatFish = "fish"
+)
+
+var (
+	// #1699999999 - комментарий с временем при заданном HISTTIMEFORMAT
+	bashTimestampRegex = regexp.MustCompile(`^#(\d{9,11})$`)
+	// : 1699999999:0;command - расширенная история zsh
+	zshExtendedRegex = regexp.MustCompile(`^: (\d{9,11}):(\d+);(.*)$`)
+	// - cmd: command / when: 1699999999 - история fish
+	fishCmdRegex  = regexp.MustCompile(`^- cmd: (.*)$`)
+	fishWhenRegex = regexp.MustCompile(`^\s+when: (\d+)$`)
+)
+
+// парсит ~/.bash_history, ~/.zsh_history и fish_history. Парсер хранит
+// состояние между строками (время из комментария, команда fish), поэтому
+// на каждый файл нужен свой экземпляр
+type BashHistoryParser struct {
+	format      string
+	user        string
+	pendingTime time.Time
+	pendingCmd  string
+}
 
 func NewBashHistoryParser() *BashHistoryParser {
-	return &BashHistoryParser{}
+	return &BashHistoryParser{format: historyFormatBash}
+}
+
+// NewShellHistoryParser создает парсер для файла истории пользователя user
+func NewShellHistoryParser(format, user string) *BashHistoryParser {
+	return &BashHistoryParser{format: format, user: user}
 }
 
 func (p *BashHistoryParser) GetSourceType() string {
@@ -20,31 +52,118 @@ func (p *BashHistoryParser) GetSourceType() string {
 }
 
 func (p *BashHistoryParser) Parse(line string, hostname string) (*types.Event, error) {
+	switch p.format {
+	case historyFormatZsh:
+		return p.parseZsh(line, hostname)
+	case historyFormatFish:
+		return p.parseFish(line, hostname)
+	}
+
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return nil, fmt.Errorf("empty line")
+	}
+
+	if m := bashTimestampRegex.FindStringSubmatch(line); m != nil {
+		p.pendingTime = parseUnixTime(m[1])
+		return nil, nil
+	}
+
+	ts := p.pendingTime
+	p.pendingTime = time.Time{}
+	return p.newCommandEvent(line, line, ts, hostname), nil
+}
+
+func (p *BashHistoryParser) parseZsh(line string, hostname string) (*types.Event, error) {
 	line = strings.TrimSpace(line)
 	if line == "" {
 		return nil, fmt.Errorf("empty line")
 	}
 
-	event := types.NewEvent("bash_history", "command_executed", "low", line)
+	if m := zshExtendedRegex.FindStringSubmatch(line); m != nil {
+		event := p.newCommandEvent(m[3], line, parseUnixTime(m[1]), hostname)
+		event.SetField("duration", m[2])
+		return event, nil
+	}
+
+	// обычная история zsh без времени
+	return p.newCommandEvent(line, line, time.Time{}, hostname), nil
+}
+
+// parseFish копит "- cmd:" до строки "when:". Если время не пришло,
+// предыдущая команда отдается при появлении следующей
+func (p *BashHistoryParser) parseFish(line string, hostname string) (*types.Event, error) {
+	if m := fishCmdRegex.FindStringSubmatch(line); m != nil {
+		var prev *types.Event
+		if p.pendingCmd != "" {
+			prev = p.newCommandEvent(p.pendingCmd, p.pendingCmd, time.Time{}, hostname)
+		}
+		p.pendingCmd = unescapeFish(m[1])
+		return prev, nil
+	}
+
+	if m := fishWhenRegex.FindStringSubmatch(line); m != nil && p.pendingCmd != "" {
+		event := p.newCommandEvent(p.pendingCmd, p.pendingCmd, parseUnixTime(m[1]), hostname)
+		p.pendingCmd = ""
+		return event, nil
+	}
+
+	// paths: и прочие служебные строки
+	return nil, nil
+}
+
+func (p *BashHistoryParser) newCommandEvent(command, rawLog string, ts time.Time, hostname string) *types.Event {
+	command = strings.TrimSpace(command)
+
+	event := types.NewEvent("bash_history", "command_executed", "low", rawLog)
 	event.SetHostname(hostname)
-	event.Command = line
+	event.Command = command
+	event.User = p.user
+	event.SetField("shell", p.format)
+	if !ts.IsZero() {
+		event.SetTimestamp(ts)
+	}
 
 	// severity по команде
-	if isSudoCommand(line) {
+	if isSudoCommand(command) {
 		event.Severity = "medium"
 		event.EventType = "privileged_command"
 	}
 
-	if isDangerousCommand(line) {
+	if isDangerousCommand(command) {
 		event.Severity = "high"
 		event.EventType = "dangerous_command"
 	}
 
-	if strings.Contains(line, "sudo su") {
-		event.User = "root"
+	if strings.Contains(command, "sudo su") {
+		event.SetField("target_user", "root")
+	}
+
+	return event
+}
+
+// historyFormat определяет формат по имени файла истории
+func historyFormat(path string) string {
+	switch {
+	case strings.HasSuffix(path, "zsh_history"):
+		return historyFormatZsh
+	case strings.HasSuffix(path, "fish_history"):
+		return historyFormatFish
+	default:
+		return historyFormatBash
 	}
+}
+
+func parseUnixTime(value string) time.Time {
+	sec, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(sec, 0)
+}
 
-	return event, nil
+func unescapeFish(cmd string) string {
+	return strings.NewReplacer(`\\`, `\`, `\n`, "\n").Replace(cmd)
 }
 
 // является ли команда sudo
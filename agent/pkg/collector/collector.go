@@ -2,10 +2,13 @@ package collector
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"io"
+	"log"
 	"os"
 	"path/filepath"
+	"strconv"
 	"sync"
 	"time"
 
@@ -21,6 +24,26 @@ type LogParser interface {
 	GetSourceType() string
 }
 
+// парсер, который собирает событие из нескольких строк и должен
+// периодически сбрасывать незавершенные группы
+type FlushableParser interface {
+	LogParser
+	Flush(hostname string, force bool) []*types.Event
+}
+
+// строки длиннее обрезаются, если в источнике не задан max_line_length
+const defaultMaxLineLength = 64 * 1024
+
+// сколько Stop ждет, пока заберут события, сброшенные при остановке
+const stopFlushTimeout = 5 * time.Second
+
+// общий интерфейс источников событий (файлы, сеть)
+type Collector interface {
+	Start() error
+	Stop()
+	Events() <-chan *types.Event
+}
+
 type LogCollector struct {
 	source     config.SourceConfig
 	parser     LogParser
@@ -32,16 +55,37 @@ type LogCollector struct {
 	events     chan *types.Event
 	mu         sync.Mutex
 	stopCh     chan struct{}
+	wg         sync.WaitGroup
+
+	// чтение по строкам с учетом недописанного хвоста файла
+	reader           *bufio.Reader
+	readOffset       int64
+	lineStart        int64
+	partial          []byte
+	partialTruncated bool
+	maxLineLength    int
+	multiline        *multilineBuffer
 }
 
 // создает новый коллектор
 func NewCollector(source config.SourceConfig, parser LogParser, hostname string) (*LogCollector, error) {
+	offsetKey := source.Type
+	if name := parser.GetSourceType(); name != source.Type {
+		// у именованных парсеров (custom, json) свой файл смещения
+		offsetKey = source.Type + "_" + name
+	}
+	return newCollectorWithOffsetKey(source, parser, hostname, offsetKey)
+}
+
+// newCollectorWithOffsetKey нужен, когда один источник читает несколько
+// файлов и у каждого должен быть свой файл смещения
+func newCollectorWithOffsetKey(source config.SourceConfig, parser LogParser, hostname, offsetKey string) (*LogCollector, error) {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create watcher: %w", err)
 	}
 
-	offsetFile := filepath.Join(".offsets", fmt.Sprintf("%s.offset", source.Type))
+	offsetFile := filepath.Join(".offsets", fmt.Sprintf("%s.offset", offsetKey))
 	os.MkdirAll(".offsets", 0755)
 
 	collector := &LogCollector{
@@ -52,6 +96,12 @@ func NewCollector(source config.SourceConfig, parser LogParser, hostname string)
 		watcher:    watcher,
 		events:     make(chan *types.Event, 100),
 		stopCh:     make(chan struct{}),
+
+		maxLineLength: source.MaxLineLength,
+		multiline:     newMultilineBuffer(source.Multiline),
+	}
+	if collector.maxLineLength == 0 {
+		collector.maxLineLength = defaultMaxLineLength
 	}
 
 	collector.loadOffset()
@@ -68,18 +118,42 @@ func (c *LogCollector) Start() error {
 		return fmt.Errorf("failed to watch file: %w", err)
 	}
 
+	c.wg.Add(2)
 	go c.readExisting()
 	go c.watchChanges()
+	if _, ok := c.parser.(FlushableParser); ok || c.multiline != nil {
+		c.wg.Add(1)
+		go c.flushLoop()
+	}
 
 	return nil
 }
 
+// Stop закрывает канал событий только после выхода всех горутин, которые
+// в него пишут. Незавершенные группы парсера и многострочная запись
+// отдаются перед закрытием: их строки уже за сохраненным смещением
 func (c *LogCollector) Stop() {
 	close(c.stopCh)
 	c.watcher.Close()
+	c.wg.Wait()
+
+	c.mu.Lock()
+	events := c.flushPending(true)
 	if c.file != nil {
 		c.file.Close()
 	}
+	c.mu.Unlock()
+
+	timeout := time.After(stopFlushTimeout)
+	for i, event := range events {
+		select {
+		case c.events <- event:
+			continue
+		case <-timeout:
+			log.Printf("Источник %s: при остановке потеряно %d незавершенных событий", c.source.Type, len(events)-i)
+		}
+		break
+	}
 	close(c.events)
 }
 
@@ -101,44 +175,30 @@ func (c *LogCollector) openFile() error {
 	}
 
 	c.file = file
+	if c.reader == nil {
+		c.reader = bufio.NewReader(file)
+	}
+	c.resetReader(0)
 	return nil
 }
 
 func (c *LogCollector) readExisting() {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	defer c.wg.Done()
 
-	if c.file == nil {
-		return
+	c.mu.Lock()
+	if c.file != nil {
+		c.file.Seek(c.offset, io.SeekStart)
+		c.resetReader(c.offset)
 	}
+	c.mu.Unlock()
 
-	c.file.Seek(c.offset, io.SeekStart)
-
-	scanner := bufio.NewScanner(c.file)
-	for scanner.Scan() {
-		line := scanner.Text()
-		if line == "" {
-			continue
-		}
-
-		event, err := c.parser.Parse(line, c.hostname)
-		if err != nil {
-			continue
-		}
-
-		select {
-		case c.events <- event:
-		case <-c.stopCh:
-			return
-		}
-
-		c.offset, _ = c.file.Seek(0, io.SeekCurrent)
-		c.saveOffset()
-	}
+	c.readLines(true)
 }
 
 // отслеживает изменения в файле
 func (c *LogCollector) watchChanges() {
+	defer c.wg.Done()
+
 	for {
 		select {
 		case event, ok := <-c.watcher.Events:
@@ -168,6 +228,12 @@ func (c *LogCollector) watchChanges() {
 }
 
 func (c *LogCollector) readNewLines() {
+	c.readLines(false)
+}
+
+// readLines разбирает все полные строки до конца файла. При block=false
+// события, не поместившиеся в канал, пропускаются
+func (c *LogCollector) readLines(block bool) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -175,35 +241,209 @@ func (c *LogCollector) readNewLines() {
 		return
 	}
 
-	scanner := bufio.NewScanner(c.file)
-	for scanner.Scan() {
-		line := scanner.Text()
+	for {
+		line, truncated, start, ok := c.nextLine()
+		if !ok {
+			return
+		}
 		if line == "" {
+			c.updateOffset()
 			continue
 		}
 
-		event, err := c.parser.Parse(line, c.hostname)
-		if err != nil {
+		records := []multilineRecord{{text: line, lines: 1, truncated: truncated}}
+		if c.multiline != nil {
+			records = c.multiline.Add(line, truncated, start)
+		}
+
+		for _, rec := range records {
+			event := c.parseRecord(rec)
+			if event == nil {
+				continue
+			}
+			if !c.send(event, block) {
+				return
+			}
+		}
+
+		c.updateOffset()
+	}
+}
+
+// nextLine возвращает следующую полную строку и смещение ее начала.
+// Строка длиннее maxLineLength обрезается, остаток до перевода строки
+// пропускается. Недописанная строка в конце файла ждет следующего чтения
+func (c *LogCollector) nextLine() (string, bool, int64, bool) {
+	for {
+		chunk, err := c.reader.ReadSlice('\n')
+		c.readOffset += int64(len(chunk))
+
+		data := bytes.TrimSuffix(chunk, []byte("\n"))
+		if room := c.maxLineLength - len(c.partial); len(data) > room {
+			c.partial = append(c.partial, data[:room]...)
+			c.partialTruncated = true
+		} else {
+			c.partial = append(c.partial, data...)
+		}
+
+		switch err {
+		case nil:
+			line := string(bytes.TrimSuffix(c.partial, []byte("\r")))
+			truncated, start := c.partialTruncated, c.lineStart
+
+			c.partial = c.partial[:0]
+			c.partialTruncated = false
+			c.lineStart = c.readOffset
+			return line, truncated, start, true
+		case bufio.ErrBufferFull:
 			continue
+		default:
+			return "", false, 0, false
 		}
+	}
+}
 
+// parseRecord разбирает строку или склеенную многострочную запись
+func (c *LogCollector) parseRecord(rec multilineRecord) *types.Event {
+	event, err := c.parser.Parse(rec.text, c.hostname)
+	if err != nil || event == nil {
+		return nil
+	}
+
+	if rec.truncated {
+		event.SetField("truncated", "true")
+	}
+	if rec.lines > 1 {
+		event.SetField("multiline_lines", strconv.Itoa(rec.lines))
+	}
+	return event
+}
+
+// send возвращает false, если коллектор остановлен
+func (c *LogCollector) send(event *types.Event, block bool) bool {
+	if block {
 		select {
 		case c.events <- event:
 		case <-c.stopCh:
-			return
-		default:
-			// канал заполнен, пропускаем
+			return false
 		}
+		return true
+	}
+
+	select {
+	case c.events <- event:
+	case <-c.stopCh:
+		return false
+	default:
+		// канал заполнен, пропускаем
+	}
+	return true
+}
 
-		c.offset, _ = c.file.Seek(0, io.SeekCurrent)
+// updateOffset сохраняет смещение последней обработанной строки; если
+// многострочная запись еще собирается, после перезапуска она читается заново
+func (c *LogCollector) updateOffset() {
+	offset := c.lineStart
+	if c.multiline != nil {
+		if start, pending := c.multiline.Pending(); pending {
+			offset = start
+		}
+	}
+
+	if offset != c.offset {
+		c.offset = offset
 		c.saveOffset()
 	}
 }
 
+func (c *LogCollector) resetReader(offset int64) {
+	c.reader.Reset(c.file)
+	c.readOffset = offset
+	c.lineStart = offset
+	c.partial = c.partial[:0]
+	c.partialTruncated = false
+}
+
+// периодически сбрасывает многострочные записи и группы парсера,
+// не дождавшиеся завершения
+func (c *LogCollector) flushLoop() {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.mu.Lock()
+			events := c.flushPending(false)
+			c.mu.Unlock()
+
+			for _, event := range events {
+				if !c.send(event, true) {
+					return
+				}
+			}
+
+		case <-c.stopCh:
+			return
+		}
+	}
+}
+
+// flushPending забирает просроченную (при force - любую) многострочную
+// запись и незавершенные события парсера
+func (c *LogCollector) flushPending(force bool) []*types.Event {
+	var events []*types.Event
+
+	if c.multiline != nil {
+		expire := c.multiline.Expired
+		if force {
+			expire = c.multiline.take
+		}
+		rec, ok := expire()
+		if ok {
+			if event := c.parseRecord(rec); event != nil {
+				events = append(events, event)
+			}
+			c.updateOffset()
+		}
+	}
+
+	if flushable, ok := c.parser.(FlushableParser); ok {
+		events = append(events, flushable.Flush(c.hostname, force)...)
+	}
+	return events
+}
+
 func (c *LogCollector) reopenFile() {
-	c.openFile()
+	// недособранная запись относится к старому файлу
+	c.mu.Lock()
+	var events []*types.Event
+	if c.multiline != nil {
+		if rec, ok := c.multiline.take(); ok {
+			if event := c.parseRecord(rec); event != nil {
+				events = append(events, event)
+			}
+		}
+	}
+	c.mu.Unlock()
+
+	for _, event := range events {
+		if !c.send(event, true) {
+			return
+		}
+	}
+
+	if err := c.openFile(); err != nil {
+		return
+	}
+
+	c.mu.Lock()
 	c.offset = 0
+	c.resetReader(0)
 	c.saveOffset()
+	c.mu.Unlock()
 }
 
 func (c *LogCollector) loadOffset() {
@@ -0,0 +1,397 @@
+package collector
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"siem-project/agent/pkg/config"
+	"siem-project/agent/pkg/types"
+)
+
+// где cron, anacron и systemd хранят задания
+var defaultScheduledTaskPaths = []string{
+	"/etc/crontab",
+	"/etc/anacrontab",
+	"/etc/cron.d/*",
+	"/etc/cron.hourly/*",
+	"/etc/cron.daily/*",
+	"/etc/cron.weekly/*",
+	"/etc/cron.monthly/*",
+	"/var/spool/cron/*",
+	"/var/spool/cron/crontabs/*",
+	"/etc/systemd/system/*.timer",
+	"/usr/lib/systemd/system/*.timer",
+	"/run/systemd/transient/*.timer",
+}
+
+// команды в задании, типичные для закрепления: запуск из временных
+// каталогов, загрузка и исполнение скриптов, обратные оболочки
+var cronSuspiciousRegex = regexp.MustCompile(`(?i)(/tmp/|/var/tmp/|/dev/shm/|\b(curl|wget)\s|base64\s+(-d|--decode)|\bncat?\s|/dev/tcp/|\bbash\s+-i|\bpython[23]?\s+-c|\bperl\s+-e|\bchmod\s+\+?[0-7]*[sx])`)
+
+// content заданий в событии ограничивается этим размером
+const scheduledTaskMaxContent = 4096
+
+func init() {
+	Register(ParserFactory{
+		Type:        "scheduled_tasks",
+		Description: "добавление и изменение заданий cron, anacron и таймеров systemd",
+		Options: map[string]OptionSpec{
+			"root_dir": {Type: OptionString, Description: "корень файловой системы хоста (/host в контейнере)"},
+			"paths":    {Type: OptionList, Description: "файлы и шаблоны с заданиями", Default: defaultScheduledTaskPaths},
+			"interval": {Type: OptionDuration, Description: "период проверки файлов", Default: "30s"},
+		},
+		NewCollector: func(source config.SourceConfig, opts Options, hostname string) (Collector, error) {
+			return NewScheduledTaskCollector(opts.String("root_dir"), opts.Strings("paths"), opts.Duration("interval"), hostname), nil
+		},
+	})
+}
+
+// cronExtractor разбирает сообщения cron/crond о запуске задания и
+// сообщения crontab о замене таблицы пользователя
+type cronExtractor struct {
+	cmdRegex     *regexp.Regexp
+	crontabRegex *regexp.Regexp
+}
+
+func newCronExtractor() *cronExtractor {
+	return &cronExtractor{
+		// (root) CMD (   cd / && run-parts --report /etc/cron.hourly)
+		cmdRegex: regexp.MustCompile(`^\((\S+)\) CMD \((.*)\)\s*$`),
+		// crontab[1234]: (root) REPLACE (alice)
+		crontabRegex: regexp.MustCompile(`^\((\S+)\) (REPLACE|DELETE) \((\S+)\)\s*$`),
+	}
+}
+
+func (c *cronExtractor) extract(event *types.Event, process, message string) {
+	switch strings.ToLower(process) {
+	case "cron", "crond":
+		m := c.cmdRegex.FindStringSubmatch(message)
+		if m == nil {
+			return
+		}
+		command := strings.TrimSpace(m[2])
+		event.EventType = "scheduled_task_executed"
+		event.Severity = "low"
+		event.User = m[1]
+		event.Command = command
+		event.SetField("task_user", m[1])
+		if cronSuspiciousRegex.MatchString(command) {
+			event.Severity = "high"
+			event.SetField("suspicious", "true")
+		}
+
+	case "crontab":
+		m := c.crontabRegex.FindStringSubmatch(message)
+		if m == nil {
+			return
+		}
+		event.EventType = "crontab_modified"
+		event.Severity = "medium"
+		event.User = m[1]
+		event.SetField("action", strings.ToLower(m[2]))
+		event.SetField("target_user", m[3])
+		// правка чужой таблицы
+		if m[1] != m[3] {
+			event.Severity = "high"
+		}
+	}
+}
+
+// ScheduledTaskCollector сравнивает снимки файлов с заданиями и сообщает
+// о новых, измененных и удаленных заданиях вместе с содержимым
+type ScheduledTaskCollector struct {
+	rootDir      string
+	patterns     []string
+	interval     time.Duration
+	hostname     string
+	snapshotFile string
+
+	tasks       map[string]scheduledTask
+	rootMissing bool // о недоступном root_dir сообщается один раз
+
+	events chan *types.Event
+	wg     sync.WaitGroup
+	stopCh chan struct{}
+}
+
+type scheduledTask struct {
+	Hash    string `json:"hash"`
+	Content string `json:"content"`
+}
+
+func NewScheduledTaskCollector(rootDir string, patterns []string, interval time.Duration, hostname string) *ScheduledTaskCollector {
+	if len(patterns) == 0 {
+		patterns = defaultScheduledTaskPaths
+	}
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	// у источников с разными root_dir и paths свои снимки
+	rootDir = strings.TrimSuffix(rootDir, "/")
+	sum := sha256.Sum256([]byte(rootDir + "\n" + strings.Join(patterns, "\n")))
+	os.MkdirAll(".offsets", 0755)
+
+	return &ScheduledTaskCollector{
+		rootDir:      rootDir,
+		patterns:     patterns,
+		interval:     interval,
+		hostname:     hostname,
+		snapshotFile: filepath.Join(".offsets", "scheduled_tasks_"+hex.EncodeToString(sum[:6])+".json"),
+		events:       make(chan *types.Event, 100),
+		stopCh:       make(chan struct{}),
+	}
+}
+
+func (c *ScheduledTaskCollector) Start() error {
+	if data, err := os.ReadFile(c.snapshotFile); err == nil {
+		var tasks map[string]scheduledTask
+		if json.Unmarshal(data, &tasks) == nil {
+			c.tasks = tasks
+		}
+	}
+
+	c.wg.Add(1)
+	go c.pollLoop()
+
+	return nil
+}
+
+func (c *ScheduledTaskCollector) Stop() {
+	close(c.stopCh)
+	c.wg.Wait()
+	close(c.events)
+}
+
+func (c *ScheduledTaskCollector) Events() <-chan *types.Event {
+	return c.events
+}
+
+func (c *ScheduledTaskCollector) pollLoop() {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	c.poll()
+	for {
+		select {
+		case <-ticker.C:
+			c.poll()
+		case <-c.stopCh:
+			return
+		}
+	}
+}
+
+func (c *ScheduledTaskCollector) poll() {
+	// несмонтированный root_dir выглядел бы как удаление всех заданий,
+	// а после монтирования - как их повторное создание
+	if !c.rootAvailable() {
+		return
+	}
+	current := c.scan()
+
+	prev := c.tasks
+	c.tasks = current
+	if prev == nil {
+		// первый запуск: текущие задания считаются исходным состоянием
+		c.saveSnapshot()
+		return
+	}
+
+	var events []*types.Event
+	for _, path := range sortedKeys(current) {
+		task := current[path]
+		old, existed := prev[path]
+		switch {
+		case !existed:
+			events = append(events, c.taskEvent(path, "scheduled_task_created", "", task.Content))
+		case old.Hash != task.Hash:
+			events = append(events, c.taskEvent(path, "scheduled_task_modified", old.Content, task.Content))
+		}
+	}
+	for _, path := range sortedKeys(prev) {
+		if _, ok := current[path]; ok {
+			continue
+		}
+		// файл есть, но не прочитан (права, ошибка чтения) - не удаление
+		if _, err := os.Lstat(path); !os.IsNotExist(err) {
+			current[path] = prev[path]
+			continue
+		}
+		events = append(events, c.taskEvent(path, "scheduled_task_deleted", prev[path].Content, ""))
+	}
+
+	if len(events) == 0 {
+		return
+	}
+	c.saveSnapshot()
+
+	for _, event := range events {
+		select {
+		case c.events <- event:
+		case <-c.stopCh:
+			return
+		}
+	}
+}
+
+// rootAvailable: корень ФС хоста читается и не пуст
+func (c *ScheduledTaskCollector) rootAvailable() bool {
+	root := c.rootDir
+	if root == "" {
+		root = "/"
+	}
+	entries, err := os.ReadDir(root)
+	if err != nil || len(entries) == 0 {
+		if !c.rootMissing {
+			log.Printf("Корень %s недоступен, проверка заданий приостановлена", root)
+		}
+		c.rootMissing = true
+		return false
+	}
+	c.rootMissing = false
+	return true
+}
+
+// scan читает все файлы заданий; для таймера systemd читается и юнит,
+// который он запускает, - команда записана там
+func (c *ScheduledTaskCollector) scan() map[string]scheduledTask {
+	tasks := make(map[string]scheduledTask)
+
+	add := func(path string) {
+		if _, ok := tasks[path]; ok {
+			return
+		}
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			return
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return
+		}
+		hash := sha256.Sum256(data)
+		tasks[path] = scheduledTask{Hash: hex.EncodeToString(hash[:]), Content: string(data)}
+	}
+
+	for _, pattern := range c.patterns {
+		matches, err := filepath.Glob(filepath.Join(c.rootDir, pattern))
+		if err != nil {
+			log.Printf("Неверный шаблон заданий %s: %v", pattern, err)
+			continue
+		}
+		for _, path := range matches {
+			add(path)
+			if strings.HasSuffix(path, ".timer") {
+				if content, ok := tasks[path]; ok {
+					add(filepath.Join(filepath.Dir(path), timerUnit(path, content.Content)))
+				}
+			}
+		}
+	}
+	return tasks
+}
+
+func (c *ScheduledTaskCollector) taskEvent(path, eventType, before, after string) *types.Event {
+	name := strings.TrimPrefix(path, c.rootDir)
+	taskType := scheduledTaskType(name)
+
+	event := types.NewEvent("scheduled_tasks", eventType, "medium", fmt.Sprintf("%s: %s", eventType, name))
+	event.SetHostname(c.hostname)
+	event.SetField("path", name)
+	event.SetField("task_type", taskType)
+	if taskType == "user_crontab" {
+		event.User = filepath.Base(name)
+		event.SetField("task_user", event.User)
+	}
+
+	content := after
+	if eventType == "scheduled_task_deleted" {
+		content = before
+	}
+	if len(content) > scheduledTaskMaxContent {
+		content = truncateUTF8(content, scheduledTaskMaxContent) + "\n... (обрезано)"
+	}
+	event.SetField("content", content)
+
+	// проверяются только добавленные строки, чтобы старое задание
+	// не поднимало важность каждого изменения файла
+	var added []string
+	if eventType == "scheduled_task_modified" {
+		diff := textDiff(before, after)
+		event.SetField("diff", diff)
+		for _, line := range strings.Split(diff, "\n") {
+			if strings.HasPrefix(line, "+") {
+				added = append(added, line[1:])
+			}
+		}
+	} else if eventType == "scheduled_task_created" {
+		added = strings.Split(after, "\n")
+	}
+
+	var entries []string
+	for _, line := range added {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entries = append(entries, line)
+		if cronSuspiciousRegex.MatchString(line) {
+			event.Severity = "high"
+			event.SetField("suspicious", "true")
+		}
+	}
+	event.SetField("added_entries", strings.Join(entries, "\n"))
+	return event
+}
+
+func (c *ScheduledTaskCollector) saveSnapshot() {
+	data, err := json.Marshal(c.tasks)
+	if err != nil {
+		return
+	}
+	if err := os.WriteFile(c.snapshotFile, data, 0600); err != nil {
+		log.Printf("Не удалось сохранить снимок заданий: %v", err)
+	}
+}
+
+// timerUnit возвращает юнит из Unit= секции [Timer] или одноименный .service
+func timerUnit(path, content string) string {
+	for _, line := range strings.Split(content, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if ok && strings.TrimSpace(key) == "Unit" {
+			return strings.TrimSpace(value)
+		}
+	}
+	return strings.TrimSuffix(filepath.Base(path), ".timer") + ".service"
+}
+
+// scheduledTaskType определяет вид задания по пути файла
+func scheduledTaskType(path string) string {
+	switch {
+	case strings.HasPrefix(path, "/var/spool/cron/"):
+		return "user_crontab"
+	case path == "/etc/crontab", strings.HasPrefix(path, "/etc/cron.d/"):
+		return "system_crontab"
+	case path == "/etc/anacrontab":
+		return "anacrontab"
+	case strings.HasPrefix(path, "/etc/cron."):
+		return "cron_script"
+	case strings.HasSuffix(path, ".timer"):
+		return "systemd_timer"
+	case strings.HasSuffix(path, ".service"):
+		return "systemd_service"
+	default:
+		return "other"
+	}
+}
@@ -0,0 +1,266 @@
+package collector
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"siem-project/agent/pkg/config"
+	"siem-project/agent/pkg/types"
+)
+
+// встроенные grok шаблоны
+var grokPatterns = map[string]string{
+	"WORD":              `\b\w+\b`,
+	"NOTSPACE":          `\S+`,
+	"SPACE":             `\s*`,
+	"DATA":              `.*?`,
+	"GREEDYDATA":        `.*`,
+	"INT":               `[+-]?\d+`,
+	"POSINT":            `\b[1-9]\d*\b`,
+	"NUMBER":            `[+-]?(?:\d+(?:\.\d+)?|\.\d+)`,
+	"BASE16NUM":         `(?:0[xX])?[0-9A-Fa-f]+`,
+	"USERNAME":          `[a-zA-Z0-9._-]+`,
+	"USER":              `%{USERNAME}`,
+	"IPV4":              `(?:\d{1,3}\.){3}\d{1,3}`,
+	"IPV6":              `[0-9A-Fa-f:]*:[0-9A-Fa-f:.]+`,
+	"IP":                `(?:%{IPV6}|%{IPV4})`,
+	"HOSTNAME":          `\b[0-9A-Za-z][0-9A-Za-z-]{0,62}(?:\.[0-9A-Za-z][0-9A-Za-z-]{0,62})*\.?\b`,
+	"IPORHOST":          `(?:%{IP}|%{HOSTNAME})`,
+	"PORT":              `\d{1,5}`,
+	"PATH":              `(?:/[^\s]*)+`,
+	"URIPATH":           `/[^\s?#]*`,
+	"URI":               `[A-Za-z][A-Za-z0-9+.-]*://\S+`,
+	"QS":                `"(?:[^"\\]|\\.)*"`,
+	"QUOTEDSTRING":      `%{QS}`,
+	"LOGLEVEL":          `(?i:trace|debug|info|notice|warn(?:ing)?|err(?:or)?|crit(?:ical)?|alert|emerg(?:ency)?|fatal|panic)`,
+	"PROG":              `[\w._/%-]+`,
+	"SYSLOGTIMESTAMP":   `[A-Z][a-z]{2} +\d{1,2} \d{2}:\d{2}:\d{2}`,
+	"TIMESTAMP_ISO8601": `\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}(?::\d{2}(?:[.,]\d+)?)?(?:Z|[+-]\d{2}:?\d{2})?`,
+	"HTTPDATE":          `\d{2}/[A-Z][a-z]{2}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}`,
+}
+
+// %{NAME} или %{NAME:field}
+var grokRefRegex = regexp.MustCompile(`%\{(\w+)(?::([\w]+))?\}`)
+
+func init() {
+	Register(ParserFactory{
+		Type:        "custom",
+		Description: "парсер из конфига: grok/regex шаблоны, маппинг полей и правила",
+		Validate: func(source config.SourceConfig, opts Options) error {
+			if source.Parser == nil || len(source.Parser.Patterns) == 0 {
+				return fmt.Errorf("parser.patterns is required")
+			}
+			return nil
+		},
+		NewParser: func(source config.SourceConfig, opts Options) (LogParser, error) {
+			return NewCustomParser(*source.Parser)
+		},
+	})
+}
+
+// CustomParser - парсер, целиком описанный в YAML (type: custom)
+type CustomParser struct {
+	cfg      config.CustomParserConfig
+	patterns []*regexp.Regexp
+	rules    []customRule
+}
+
+type customRule struct {
+	cfg     config.CustomRuleConfig
+	matches *regexp.Regexp
+}
+
+func NewCustomParser(cfg config.CustomParserConfig) (*CustomParser, error) {
+	if len(cfg.Patterns) == 0 {
+		return nil, fmt.Errorf("custom parser %q has no patterns", cfg.Name)
+	}
+	if cfg.Name == "" {
+		cfg.Name = "custom"
+	}
+	if cfg.EventType == "" {
+		cfg.EventType = "custom_event"
+	}
+	if cfg.Severity == "" {
+		cfg.Severity = "low"
+	}
+
+	parser := &CustomParser{cfg: cfg}
+
+	for i, pattern := range cfg.Patterns {
+		expanded, err := expandGrok(pattern, cfg.Definitions)
+		if err != nil {
+			return nil, fmt.Errorf("pattern %d: %w", i, err)
+		}
+		re, err := regexp.Compile(expanded)
+		if err != nil {
+			return nil, fmt.Errorf("pattern %d: %w", i, err)
+		}
+		parser.patterns = append(parser.patterns, re)
+	}
+
+	for i, rule := range cfg.Rules {
+		r := customRule{cfg: rule}
+		if rule.Matches != "" {
+			re, err := regexp.Compile(rule.Matches)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: %w", i, err)
+			}
+			r.matches = re
+		}
+		parser.rules = append(parser.rules, r)
+	}
+
+	return parser, nil
+}
+
+func (p *CustomParser) GetSourceType() string {
+	return p.cfg.Name
+}
+
+func (p *CustomParser) Parse(line string, hostname string) (*types.Event, error) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return nil, fmt.Errorf("empty line")
+	}
+
+	captures, _, ok := p.Match(line)
+	if !ok {
+		return nil, fmt.Errorf("no pattern matched")
+	}
+
+	event := types.NewEvent(p.cfg.Name, p.cfg.EventType, p.cfg.Severity, line)
+	event.SetHostname(hostname)
+
+	// группы, которые явно отображены на поля события
+	mapped := make(map[string]bool)
+	for target, group := range p.cfg.Fields {
+		value, ok := captures[group]
+		if !ok {
+			continue
+		}
+		mapped[group] = true
+		p.setEventField(event, target, value)
+	}
+
+	for name, value := range captures {
+		if !mapped[name] {
+			event.SetField(name, value)
+		}
+	}
+
+	p.applyRules(event, captures, line)
+
+	return event, nil
+}
+
+// Match возвращает именованные группы первого подошедшего шаблона и его номер
+func (p *CustomParser) Match(line string) (map[string]string, int, bool) {
+	for i, re := range p.patterns {
+		m := re.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+
+		captures := make(map[string]string)
+		for j, name := range re.SubexpNames() {
+			if name != "" && m[j] != "" {
+				captures[name] = m[j]
+			}
+		}
+		return captures, i, true
+	}
+	return nil, -1, false
+}
+
+func (p *CustomParser) setEventField(event *types.Event, target, value string) {
+	switch target {
+	case "timestamp":
+		if ts, ok := p.parseTimestamp(value); ok {
+			event.SetTimestamp(ts)
+		}
+	case "user":
+		event.User = value
+	case "process":
+		event.Process = value
+	case "command":
+		event.Command = value
+	case "severity":
+		event.Severity = strings.ToLower(value)
+	case "event_type":
+		event.EventType = value
+	case "hostname":
+		event.SetHostname(value)
+	default:
+		event.SetField(target, value)
+	}
+}
+
+func (p *CustomParser) parseTimestamp(value string) (time.Time, bool) {
+	if p.cfg.TimestampFormat != "" {
+		t, err := time.ParseInLocation(p.cfg.TimestampFormat, value, time.Local)
+		return t, err == nil
+	}
+	return parseSyslogTimestamp(value, time.Now(), time.Local)
+}
+
+// applyRules применяет первое правило, условие которого выполнено.
+// Поле "raw" - вся строка лога
+func (p *CustomParser) applyRules(event *types.Event, captures map[string]string, line string) {
+	for _, rule := range p.rules {
+		value := captures[rule.cfg.Field]
+		if rule.cfg.Field == "raw" {
+			value = line
+		}
+
+		if rule.cfg.Equals != "" && value != rule.cfg.Equals {
+			continue
+		}
+		if rule.matches != nil && !rule.matches.MatchString(value) {
+			continue
+		}
+
+		if rule.cfg.EventType != "" {
+			event.EventType = rule.cfg.EventType
+		}
+		if rule.cfg.Severity != "" {
+			event.Severity = rule.cfg.Severity
+		}
+		return
+	}
+}
+
+// expandGrok раскрывает %{NAME:field} в регулярное выражение
+// с именованными группами; свои шаблоны перекрывают встроенные
+func expandGrok(pattern string, definitions map[string]string) (string, error) {
+	var expandErr error
+
+	for depth := 0; grokRefRegex.MatchString(pattern); depth++ {
+		if depth > 10 {
+			return "", fmt.Errorf("grok patterns are nested too deep")
+		}
+
+		pattern = grokRefRegex.ReplaceAllStringFunc(pattern, func(ref string) string {
+			m := grokRefRegex.FindStringSubmatch(ref)
+			def, ok := definitions[m[1]]
+			if !ok {
+				def, ok = grokPatterns[m[1]]
+			}
+			if !ok {
+				expandErr = fmt.Errorf("unknown grok pattern %s", m[1])
+				return ref
+			}
+			if m[2] != "" {
+				return "(?P<" + m[2] + ">" + def + ")"
+			}
+			return "(?:" + def + ")"
+		})
+
+		if expandErr != nil {
+			return "", expandErr
+		}
+	}
+
+	return pattern, nil
+}
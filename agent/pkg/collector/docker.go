@@ -0,0 +1,603 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"siem-project/agent/pkg/config"
+	"siem-project/agent/pkg/types"
+)
+
+// пауза перед повторным подключением к сокету Docker
+const dockerReconnectInterval = 10 * time.Second
+
+// возможности, с которыми контейнер фактически получает доступ к хосту
+var dockerDangerousCaps = map[string]bool{
+	"ALL": true, "SYS_ADMIN": true, "SYS_MODULE": true, "SYS_PTRACE": true,
+	"SYS_RAWIO": true, "DAC_READ_SEARCH": true, "NET_ADMIN": true,
+}
+
+// каталоги хоста, монтирование которых дает контроль над хостом
+var dockerSensitiveMounts = map[string]bool{
+	"/": true, "/etc": true, "/root": true, "/proc": true, "/sys": true, "/dev": true,
+	"/var/run/docker.sock": true, "/run/docker.sock": true, "/run/containerd/containerd.sock": true,
+}
+
+func init() {
+	Register(ParserFactory{
+		Type:        "docker",
+		Description: "логи контейнеров (json-file) и события жизненного цикла из сокета Docker",
+		Options: map[string]OptionSpec{
+			"containers_dir":  {Type: OptionString, Description: "каталог контейнеров Docker", Default: "/var/lib/docker/containers"},
+			"socket":          {Type: OptionString, Description: "сокет Docker API", Default: "/var/run/docker.sock"},
+			"logs":            {Type: OptionBool, Description: "читать *-json.log контейнеров", Default: true},
+			"lifecycle":       {Type: OptionBool, Description: "получать события start/stop/exec из сокета", Default: true},
+			"exclude":         {Type: OptionList, Description: "имена контейнеров, логи которых не читаются (сам агент)", Default: []string{"siem-agent"}},
+			"rescan_interval": {Type: OptionDuration, Description: "период поиска новых контейнеров", Default: "10s"},
+		},
+		Validate: func(source config.SourceConfig, opts Options) error {
+			if !opts.Bool("logs") && !opts.Bool("lifecycle") {
+				return fmt.Errorf("logs or lifecycle must be enabled")
+			}
+			return nil
+		},
+		NewCollector: func(source config.SourceConfig, opts Options, hostname string) (Collector, error) {
+			return NewDockerCollector(DockerConfig{
+				ContainersDir:  opts.String("containers_dir"),
+				Socket:         opts.String("socket"),
+				Logs:           opts.Bool("logs"),
+				Lifecycle:      opts.Bool("lifecycle"),
+				Exclude:        opts.Strings("exclude"),
+				RescanInterval: opts.Duration("rescan_interval"),
+			}, source, hostname), nil
+		},
+	})
+}
+
+// DockerConfig - опции источника docker
+type DockerConfig struct {
+	ContainersDir  string
+	Socket         string
+	Logs           bool
+	Lifecycle      bool
+	Exclude        []string
+	RescanInterval time.Duration
+}
+
+// DockerCollector читает json-логи контейнеров (на каждый файл свой
+// LogCollector, как у истории команд) и поток событий Docker API
+type DockerCollector struct {
+	cfg      DockerConfig
+	source   config.SourceConfig
+	hostname string
+	client   *http.Client
+	exclude  map[string]bool
+
+	collectors map[string]*LogCollector
+	lastEvent  time.Time
+
+	events chan *types.Event
+	ctx    context.Context
+	cancel context.CancelFunc
+	mu     sync.Mutex
+	wg     sync.WaitGroup
+	stopCh chan struct{}
+}
+
+// метаданные контейнера из config.v2.json
+type dockerContainer struct {
+	ID     string `json:"ID"`
+	Name   string `json:"Name"`
+	Config struct {
+		Image  string            `json:"Image"`
+		Labels map[string]string `json:"Labels"`
+	} `json:"Config"`
+}
+
+// событие из GET /events
+type dockerEvent struct {
+	Type   string `json:"Type"`
+	Action string `json:"Action"`
+	Actor  struct {
+		ID         string            `json:"ID"`
+		Attributes map[string]string `json:"Attributes"`
+	} `json:"Actor"`
+	TimeNano int64 `json:"timeNano"`
+}
+
+// ответ GET /containers/{id}/json, только нужные поля
+type dockerInspect struct {
+	Config struct {
+		User string `json:"User"`
+	} `json:"Config"`
+	HostConfig struct {
+		Privileged  bool     `json:"Privileged"`
+		CapAdd      []string `json:"CapAdd"`
+		PidMode     string   `json:"PidMode"`
+		NetworkMode string   `json:"NetworkMode"`
+		IpcMode     string   `json:"IpcMode"`
+		SecurityOpt []string `json:"SecurityOpt"`
+	} `json:"HostConfig"`
+	Mounts []struct {
+		Source string `json:"Source"`
+		RW     bool   `json:"RW"`
+	} `json:"Mounts"`
+}
+
+// ответ GET /exec/{id}/json
+type dockerExecInspect struct {
+	ProcessConfig struct {
+		User       string `json:"user"`
+		Privileged bool   `json:"privileged"`
+	} `json:"ProcessConfig"`
+}
+
+func NewDockerCollector(cfg DockerConfig, source config.SourceConfig, hostname string) *DockerCollector {
+	if cfg.ContainersDir == "" {
+		cfg.ContainersDir = "/var/lib/docker/containers"
+	}
+	if cfg.Socket == "" {
+		cfg.Socket = "/var/run/docker.sock"
+	}
+	if cfg.RescanInterval <= 0 {
+		cfg.RescanInterval = 10 * time.Second
+	}
+
+	exclude := make(map[string]bool, len(cfg.Exclude))
+	for _, name := range cfg.Exclude {
+		exclude[strings.TrimPrefix(name, "/")] = true
+	}
+
+	socket := cfg.Socket
+	ctx, cancel := context.WithCancel(context.Background())
+	return &DockerCollector{
+		cfg:      cfg,
+		source:   source,
+		hostname: hostname,
+		exclude:  exclude,
+		client: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var dialer net.Dialer
+					return dialer.DialContext(ctx, "unix", socket)
+				},
+			},
+		},
+		collectors: make(map[string]*LogCollector),
+		events:     make(chan *types.Event, 100),
+		ctx:        ctx,
+		cancel:     cancel,
+		stopCh:     make(chan struct{}),
+	}
+}
+
+func (c *DockerCollector) Start() error {
+	_, dirErr := os.Stat(c.cfg.ContainersDir)
+	_, sockErr := os.Stat(c.cfg.Socket)
+	if (!c.cfg.Logs || dirErr != nil) && (!c.cfg.Lifecycle || sockErr != nil) {
+		return fmt.Errorf("failed to find docker data: %s and %s are not available", c.cfg.ContainersDir, c.cfg.Socket)
+	}
+
+	if c.cfg.Logs {
+		c.scan()
+		c.wg.Add(1)
+		go c.rescanLoop()
+	}
+	if c.cfg.Lifecycle {
+		c.wg.Add(1)
+		go c.eventsLoop()
+	}
+
+	return nil
+}
+
+func (c *DockerCollector) Stop() {
+	close(c.stopCh)
+	c.cancel()
+
+	c.mu.Lock()
+	for _, coll := range c.collectors {
+		coll.Stop()
+	}
+	c.mu.Unlock()
+
+	c.wg.Wait()
+	close(c.events)
+}
+
+func (c *DockerCollector) Events() <-chan *types.Event {
+	return c.events
+}
+
+func (c *DockerCollector) rescanLoop() {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(c.cfg.RescanInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.scan()
+		case <-c.stopCh:
+			return
+		}
+	}
+}
+
+// scan запускает чтение логов новых контейнеров и останавливает
+// коллекторы удаленных
+func (c *DockerCollector) scan() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	select {
+	case <-c.stopCh:
+		return
+	default:
+	}
+
+	paths, err := filepath.Glob(filepath.Join(c.cfg.ContainersDir, "*", "*-json.log"))
+	if err != nil {
+		return
+	}
+
+	found := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		found[path] = true
+		if _, exists := c.collectors[path]; exists {
+			continue
+		}
+
+		container, err := readDockerContainer(filepath.Dir(path))
+		if err != nil {
+			// config.v2.json появляется чуть позже лога, попробуем при следующем поиске
+			continue
+		}
+		if c.exclude[container.name()] {
+			continue
+		}
+
+		source := c.source
+		source.Path = path
+		coll, err := newCollectorWithOffsetKey(source, NewDockerLogParser(container), c.hostname, c.offsetKey(path))
+		if err != nil {
+			log.Printf("Не удалось создать коллектор логов контейнера %s: %v", container.name(), err)
+			continue
+		}
+		if err := coll.Start(); err != nil {
+			log.Printf("Не удалось запустить коллектор логов контейнера %s: %v", container.name(), err)
+			continue
+		}
+
+		c.collectors[path] = coll
+		log.Printf("Отслеживаются логи контейнера %s (%s)", container.name(), container.Config.Image)
+
+		c.wg.Add(1)
+		go c.forward(coll)
+	}
+
+	for path, coll := range c.collectors {
+		if found[path] {
+			continue
+		}
+		// контейнер удален вместе с логом
+		coll.Stop()
+		delete(c.collectors, path)
+		os.Remove(filepath.Join(".offsets", c.offsetKey(path)+".offset"))
+	}
+}
+
+func (c *DockerCollector) offsetKey(path string) string {
+	return "docker_" + shortContainerID(filepath.Base(filepath.Dir(path)))
+}
+
+func (c *DockerCollector) forward(coll *LogCollector) {
+	defer c.wg.Done()
+
+	// читает до закрытия канала: при остановке дочерний коллектор отдает
+	// незавершенные события, и они не должны теряться
+	for event := range coll.Events() {
+		c.events <- event
+	}
+}
+
+// eventsLoop держит подключение к потоку событий и переподключается
+// после ошибок; пропущенные события запрашиваются через since
+func (c *DockerCollector) eventsLoop() {
+	defer c.wg.Done()
+
+	for {
+		err := c.streamEvents()
+		select {
+		case <-c.stopCh:
+			return
+		default:
+		}
+		log.Printf("Поток событий Docker прерван: %v, повтор через %s", err, dockerReconnectInterval)
+
+		select {
+		case <-time.After(dockerReconnectInterval):
+		case <-c.stopCh:
+			return
+		}
+	}
+}
+
+func (c *DockerCollector) streamEvents() error {
+	query := url.Values{}
+	query.Set("filters", `{"type":["container"]}`)
+	if !c.lastEvent.IsZero() {
+		since := c.lastEvent.Add(time.Nanosecond)
+		query.Set("since", fmt.Sprintf("%d.%09d", since.Unix(), since.Nanosecond()))
+	}
+
+	resp, err := c.get("/events?" + query.Encode())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			return fmt.Errorf("failed to read docker events: %w", err)
+		}
+
+		var ev dockerEvent
+		if err := json.Unmarshal(raw, &ev); err != nil {
+			continue
+		}
+		if ev.TimeNano > 0 {
+			c.lastEvent = time.Unix(0, ev.TimeNano)
+		}
+
+		event := c.lifecycleEvent(ev, string(raw))
+		if event == nil {
+			continue
+		}
+		select {
+		case c.events <- event:
+		case <-c.stopCh:
+			return nil
+		}
+	}
+}
+
+// lifecycleEvent переводит событие Docker в событие агента; create, kill,
+// pause и прочие промежуточные действия пропускаются
+func (c *DockerCollector) lifecycleEvent(ev dockerEvent, raw string) *types.Event {
+	action, detail, _ := strings.Cut(ev.Action, ": ")
+	attrs := ev.Actor.Attributes
+
+	var event *types.Event
+	switch action {
+	case "start":
+		event = types.NewEvent("docker", "container_started", "low", raw)
+		c.setRiskFields(event, ev.Actor.ID)
+	case "die":
+		event = types.NewEvent("docker", "container_stopped", "low", raw)
+		event.SetField("exit_code", attrs["exitCode"])
+	case "exec_start":
+		event = types.NewEvent("docker", "container_exec", "medium", raw)
+		event.Command = detail
+		c.setExecFields(event, attrs["execID"])
+	case "oom":
+		event = types.NewEvent("docker", "container_oom", "medium", raw)
+	case "destroy":
+		event = types.NewEvent("docker", "container_removed", "low", raw)
+	default:
+		return nil
+	}
+
+	event.SetHostname(c.hostname)
+	if ev.TimeNano > 0 {
+		event.SetTimestamp(time.Unix(0, ev.TimeNano))
+	}
+	event.Process = attrs["name"]
+	event.SetField("container_id", shortContainerID(ev.Actor.ID))
+	event.SetField("container_name", attrs["name"])
+	event.SetField("container_image", attrs["image"])
+	event.SetField("compose_project", attrs["com.docker.compose.project"])
+	event.SetField("compose_service", attrs["com.docker.compose.service"])
+	return event
+}
+
+// setRiskFields отмечает запуск с доступом к хосту: privileged или все
+// возможности - отдельный тип события, остальное повышает важность
+func (c *DockerCollector) setRiskFields(event *types.Event, id string) {
+	var inspect dockerInspect
+	if err := c.getJSON("/containers/"+id+"/json", &inspect); err != nil {
+		return
+	}
+	host := inspect.HostConfig
+	event.User = inspect.Config.User
+
+	var risky []string
+	if host.PidMode == "host" {
+		risky = append(risky, "host_pid")
+	}
+	if host.NetworkMode == "host" {
+		risky = append(risky, "host_network")
+	}
+	if host.IpcMode == "host" {
+		risky = append(risky, "host_ipc")
+	}
+	allCaps := false
+	for _, capability := range host.CapAdd {
+		capability = strings.TrimPrefix(strings.ToUpper(capability), "CAP_")
+		if dockerDangerousCaps[capability] {
+			risky = append(risky, "cap_"+strings.ToLower(capability))
+		}
+		allCaps = allCaps || capability == "ALL"
+	}
+	for _, opt := range host.SecurityOpt {
+		if strings.HasSuffix(opt, "=unconfined") {
+			risky = append(risky, strings.Replace(opt, "=", "_", 1))
+		}
+	}
+	var mounts []string
+	for _, mount := range inspect.Mounts {
+		if dockerSensitiveMounts[mount.Source] {
+			mounts = append(mounts, mount.Source)
+		}
+	}
+	if len(mounts) > 0 {
+		risky = append(risky, "sensitive_mount")
+		event.SetField("sensitive_mounts", strings.Join(mounts, ","))
+	}
+
+	event.SetField("risky_options", strings.Join(risky, ","))
+	switch {
+	case host.Privileged || allCaps:
+		event.EventType = "privileged_container_started"
+		event.Severity = "high"
+		event.SetField("privileged", "true")
+	case len(risky) > 0:
+		event.Severity = "medium"
+	}
+}
+
+func (c *DockerCollector) setExecFields(event *types.Event, execID string) {
+	if execID == "" {
+		return
+	}
+	var inspect dockerExecInspect
+	if err := c.getJSON("/exec/"+execID+"/json", &inspect); err != nil {
+		return
+	}
+	// пустой user означает пользователя образа, обычно root
+	event.User = inspect.ProcessConfig.User
+	if inspect.ProcessConfig.Privileged {
+		event.Severity = "high"
+		event.SetField("privileged", "true")
+	}
+}
+
+func (c *DockerCollector) get(path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(c.ctx, http.MethodGet, "http://docker"+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query docker socket: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("docker API returned %s for %s", resp.Status, path)
+	}
+	return resp, nil
+}
+
+func (c *DockerCollector) getJSON(path string, v interface{}) error {
+	resp, err := c.get(path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// DockerLogParser разбирает строки драйвера json-file. Docker делит
+// длинные строки на части по 16 КБ без перевода строки в конце, части
+// склеиваются обратно
+type DockerLogParser struct {
+	container dockerContainer
+	partial   strings.Builder
+	truncated bool
+}
+
+func NewDockerLogParser(container dockerContainer) *DockerLogParser {
+	return &DockerLogParser{container: container}
+}
+
+func (p *DockerLogParser) GetSourceType() string {
+	return "docker"
+}
+
+func (p *DockerLogParser) Parse(line string, hostname string) (*types.Event, error) {
+	// {"log":"GET / HTTP/1.1 200\n","stream":"stdout","time":"2024-01-15T10:23:45.123456789Z"}
+	var entry struct {
+		Log    string `json:"log"`
+		Stream string `json:"stream"`
+		Time   string `json:"time"`
+	}
+	if err := json.Unmarshal([]byte(line), &entry); err != nil {
+		return nil, fmt.Errorf("failed to parse docker log line: %w", err)
+	}
+
+	if !strings.HasSuffix(entry.Log, "\n") {
+		if p.partial.Len()+len(entry.Log) <= defaultMaxLineLength {
+			p.partial.WriteString(entry.Log)
+		} else {
+			p.truncated = true
+		}
+		return nil, nil
+	}
+
+	message := p.partial.String() + entry.Log
+	truncated := p.truncated
+	p.partial.Reset()
+	p.truncated = false
+
+	message = strings.TrimRight(message, "\r\n")
+	if message == "" {
+		return nil, nil
+	}
+
+	event := types.NewEvent("docker", "container_log", "low", message)
+	event.SetHostname(hostname)
+	if ts, err := time.Parse(time.RFC3339Nano, entry.Time); err == nil {
+		event.SetTimestamp(ts)
+	}
+	event.Process = p.container.name()
+	event.SetField("stream", entry.Stream)
+	event.SetField("container_id", shortContainerID(p.container.ID))
+	event.SetField("container_name", p.container.name())
+	event.SetField("container_image", p.container.Config.Image)
+	event.SetField("compose_project", p.container.Config.Labels["com.docker.compose.project"])
+	event.SetField("compose_service", p.container.Config.Labels["com.docker.compose.service"])
+	if truncated {
+		event.SetField("truncated", "true")
+	}
+	return event, nil
+}
+
+func (d dockerContainer) name() string {
+	return strings.TrimPrefix(d.Name, "/")
+}
+
+func readDockerContainer(dir string) (dockerContainer, error) {
+	var container dockerContainer
+	data, err := os.ReadFile(filepath.Join(dir, "config.v2.json"))
+	if err != nil {
+		return container, err
+	}
+	if err := json.Unmarshal(data, &container); err != nil {
+		return container, fmt.Errorf("failed to parse container config: %w", err)
+	}
+	if container.ID == "" {
+		container.ID = filepath.Base(dir)
+	}
+	return container, nil
+}
+
+// shortContainerID - первые 12 символов, как в docker ps
+func shortContainerID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
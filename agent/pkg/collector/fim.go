@@ -0,0 +1,688 @@
+package collector
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/fsnotify/fsnotify"
+
+	"siem-project/agent/pkg/config"
+	"siem-project/agent/pkg/types"
+)
+
+// файлы, изменение которых сразу важно (учетные записи, sudo, ключи ssh)
+var fimSensitivePatterns = []string{
+	"/etc/passwd", "/etc/shadow", "/etc/group", "/etc/gshadow",
+	"/etc/sudoers", "/etc/sudoers.d/*", "*/.ssh/authorized_keys*",
+	"/etc/ssh/sshd_config", "/etc/pam.d/*", "/etc/ld.so.preload",
+}
+
+// для этих файлов diff не строится, чтобы секреты не уходили с хоста
+var fimDefaultNoDiff = []string{
+	"/etc/shadow*", "/etc/gshadow*", "*.key", "*.pem", "*/.ssh/id_*",
+}
+
+// ограничения diff: размер таблицы LCS и длина текста в событии
+const (
+	fimMaxDiffCells  = 4 * 1024 * 1024
+	fimMaxDiffOutput = 4096
+)
+
+// изменения, пришедшие от fsnotify, проверяются пачкой раз в секунду:
+// редакторы пишут файл в несколько приемов
+const fimSettleInterval = time.Second
+
+func init() {
+	Register(ParserFactory{
+		Type:        "fim",
+		Description: "контроль целостности файлов: baseline и события создания/изменения/удаления/смены прав",
+		Options: map[string]OptionSpec{
+			"paths":           {Type: OptionList, Required: true, Description: "файлы и каталоги, допускаются шаблоны (/home/*/.ssh/authorized_keys)"},
+			"exclude":         {Type: OptionList, Description: "шаблоны путей или имен файлов, которые не отслеживаются"},
+			"recursive":       {Type: OptionBool, Description: "обходить подкаталоги", Default: true},
+			"rescan_interval": {Type: OptionDuration, Description: "полная перепроверка на случай пропущенных уведомлений", Default: "10m"},
+			"max_hash_size":   {Type: OptionInt, Description: "файлы больше (байт) сравниваются по размеру и mtime без хеша", Default: 50 * 1024 * 1024},
+			"max_diff_size":   {Type: OptionInt, Description: "для текстовых файлов не больше (байт) в событие добавляется diff", Default: 64 * 1024},
+			"no_diff":         {Type: OptionList, Description: "шаблоны файлов без diff (по умолчанию shadow и ключи)"},
+			"root_dir":        {Type: OptionString, Description: "корень файловой системы хоста (/host в контейнере); paths, exclude и no_diff задаются без него"},
+		},
+		Validate: func(source config.SourceConfig, opts Options) error {
+			if len(opts.Strings("paths")) == 0 {
+				return fmt.Errorf("option paths must not be empty")
+			}
+			for _, pattern := range append(opts.Strings("paths"), opts.Strings("exclude")...) {
+				if _, err := filepath.Match(pattern, ""); err != nil {
+					return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+				}
+			}
+			return nil
+		},
+		NewCollector: func(source config.SourceConfig, opts Options, hostname string) (Collector, error) {
+			noDiff := opts.Strings("no_diff")
+			if noDiff == nil {
+				noDiff = fimDefaultNoDiff
+			}
+			return NewFIMCollector(FIMConfig{
+				Paths:          opts.Strings("paths"),
+				Exclude:        opts.Strings("exclude"),
+				Recursive:      opts.Bool("recursive"),
+				RescanInterval: opts.Duration("rescan_interval"),
+				MaxHashSize:    int64(opts.Int("max_hash_size")),
+				MaxDiffSize:    int64(opts.Int("max_diff_size")),
+				NoDiff:         noDiff,
+				RootDir:        opts.String("root_dir"),
+			}, hostname)
+		},
+	})
+}
+
+// FIMConfig - настройки источника fim
+type FIMConfig struct {
+	Paths          []string
+	Exclude        []string
+	Recursive      bool
+	RescanInterval time.Duration
+	MaxHashSize    int64
+	MaxDiffSize    int64
+	NoDiff         []string
+	RootDir        string
+}
+
+// FIMCollector хранит baseline атрибутов файлов и сообщает об отличиях.
+// Baseline сохраняется на диск, поэтому изменения, сделанные пока агент
+// был остановлен, обнаруживаются при следующем запуске
+type FIMCollector struct {
+	cfg          FIMConfig
+	hostname     string
+	baselineFile string
+	ids          *idResolver
+
+	baseline map[string]*fimState
+	roots    map[string]bool // найденные по шаблонам пути -> это каталог
+	pending  map[string]bool
+	watcher  *fsnotify.Watcher
+
+	events chan *types.Event
+	wg     sync.WaitGroup
+	stopCh chan struct{}
+}
+
+// fimState - атрибуты файла в baseline
+type fimState struct {
+	Hash    string    `json:"hash,omitempty"`
+	Size    int64     `json:"size"`
+	Mode    uint32    `json:"mode"`
+	UID     uint32    `json:"uid"`
+	GID     uint32    `json:"gid"`
+	ModTime time.Time `json:"mtime"`
+	Link    string    `json:"link,omitempty"`
+	// содержимое небольших текстовых файлов, нужно для diff
+	Content string `json:"content,omitempty"`
+}
+
+func NewFIMCollector(cfg FIMConfig, hostname string) (*FIMCollector, error) {
+	if cfg.RescanInterval <= 0 {
+		cfg.RescanInterval = 10 * time.Minute
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create watcher: %w", err)
+	}
+
+	cfg.RootDir = strings.TrimSuffix(cfg.RootDir, "/")
+	sum := sha256.Sum256([]byte(cfg.RootDir + "\n" + strings.Join(cfg.Paths, "\n")))
+	os.MkdirAll(".offsets", 0755)
+
+	return &FIMCollector{
+		cfg:          cfg,
+		hostname:     hostname,
+		baselineFile: filepath.Join(".offsets", "fim_"+hex.EncodeToString(sum[:6])+".json"),
+		ids:          newIDResolver(filepath.Join(cfg.RootDir, defaultPasswdPath), filepath.Join(cfg.RootDir, defaultGroupPath)),
+		pending:      make(map[string]bool),
+		watcher:      watcher,
+		events:       make(chan *types.Event, 100),
+		stopCh:       make(chan struct{}),
+	}, nil
+}
+
+func (c *FIMCollector) Start() error {
+	silent := !c.loadBaseline()
+	if silent {
+		log.Printf("FIM: baseline не найден, создается новый (%s)", c.baselineFile)
+	}
+
+	events := c.scan()
+	if silent {
+		events = nil
+	}
+	c.saveBaseline()
+
+	c.wg.Add(1)
+	go c.run(events)
+
+	return nil
+}
+
+func (c *FIMCollector) Stop() {
+	close(c.stopCh)
+	c.watcher.Close()
+	c.wg.Wait()
+	close(c.events)
+}
+
+func (c *FIMCollector) Events() <-chan *types.Event {
+	return c.events
+}
+
+// run обрабатывает уведомления fsnotify и периодические перепроверки
+// в одной горутине, поэтому baseline не требует блокировок
+func (c *FIMCollector) run(initial []*types.Event) {
+	defer c.wg.Done()
+
+	if !c.send(initial) {
+		return
+	}
+
+	settle := time.NewTicker(fimSettleInterval)
+	defer settle.Stop()
+	rescan := time.NewTicker(c.cfg.RescanInterval)
+	defer rescan.Stop()
+
+	for {
+		select {
+		case event, ok := <-c.watcher.Events:
+			if !ok {
+				return
+			}
+			if c.covered(event.Name) || c.roots[event.Name] {
+				c.pending[event.Name] = true
+			}
+
+		case err, ok := <-c.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("FIM: ошибка watcher: %v", err)
+
+		case <-settle.C:
+			if len(c.pending) == 0 {
+				continue
+			}
+			var events []*types.Event
+			for path := range c.pending {
+				events = append(events, c.checkPath(path)...)
+			}
+			c.pending = make(map[string]bool)
+			c.saveBaseline()
+			if !c.send(events) {
+				return
+			}
+
+		case <-rescan.C:
+			events := c.scan()
+			c.saveBaseline()
+			if !c.send(events) {
+				return
+			}
+
+		case <-c.stopCh:
+			return
+		}
+	}
+}
+
+func (c *FIMCollector) send(events []*types.Event) bool {
+	for _, event := range events {
+		select {
+		case c.events <- event:
+		case <-c.stopCh:
+			return false
+		}
+	}
+	return true
+}
+
+// scan обходит все отслеживаемые пути, обновляет watches и сравнивает
+// результат с baseline, включая удаленные файлы
+func (c *FIMCollector) scan() []*types.Event {
+	c.roots = make(map[string]bool)
+	seen := make(map[string]bool)
+	var events []*types.Event
+
+	for _, pattern := range c.cfg.Paths {
+		pattern = filepath.Join(c.cfg.RootDir, pattern)
+		matches, _ := filepath.Glob(pattern)
+		if len(matches) == 0 {
+			// файла пока нет: следим за каталогами, чтобы заметить создание
+			dirs, _ := filepath.Glob(filepath.Dir(pattern))
+			for _, dir := range dirs {
+				c.watch(dir)
+			}
+			continue
+		}
+
+		for _, root := range matches {
+			info, err := os.Lstat(root)
+			if err != nil {
+				continue
+			}
+			c.roots[root] = info.IsDir()
+
+			if !info.IsDir() {
+				c.watch(filepath.Dir(root))
+				seen[root] = true
+				events = append(events, c.compare(root, info)...)
+				continue
+			}
+
+			filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+				if err != nil || c.excluded(path) {
+					if d != nil && d.IsDir() && path != root {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				if d.IsDir() {
+					if path != root && !c.cfg.Recursive {
+						return filepath.SkipDir
+					}
+					c.watch(path)
+					return nil
+				}
+
+				info, err := d.Info()
+				if err != nil {
+					return nil
+				}
+				seen[path] = true
+				events = append(events, c.compare(path, info)...)
+				return nil
+			})
+		}
+	}
+
+	for path, state := range c.baseline {
+		if !seen[path] {
+			events = append(events, c.changeEvent(path, "deleted", state, nil))
+			delete(c.baseline, path)
+		}
+	}
+	return events
+}
+
+// checkPath проверяет один путь после уведомления fsnotify
+func (c *FIMCollector) checkPath(path string) []*types.Event {
+	info, err := os.Lstat(path)
+	if err != nil {
+		var events []*types.Event
+		// удален файл или целый каталог
+		for known, state := range c.baseline {
+			if known == path || strings.HasPrefix(known, path+"/") {
+				events = append(events, c.changeEvent(known, "deleted", state, nil))
+				delete(c.baseline, known)
+			}
+		}
+		return events
+	}
+
+	if !info.IsDir() {
+		if c.excluded(path) {
+			return nil
+		}
+		return c.compare(path, info)
+	}
+
+	// новый каталог: добавить watch и проверить то, что уже успели создать
+	if !c.cfg.Recursive && !c.roots[path] {
+		return nil
+	}
+	var events []*types.Event
+	filepath.WalkDir(path, func(sub string, d fs.DirEntry, err error) error {
+		if err != nil || c.excluded(sub) {
+			return nil
+		}
+		if d.IsDir() {
+			c.watch(sub)
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			events = append(events, c.compare(sub, info)...)
+		}
+		return nil
+	})
+	return events
+}
+
+// compare сравнивает файл с baseline и обновляет его
+func (c *FIMCollector) compare(path string, info os.FileInfo) []*types.Event {
+	prev := c.baseline[path]
+	if prev != nil && prev.Size == info.Size() && prev.ModTime.Equal(info.ModTime()) && prev.Mode == uint32(info.Mode()) {
+		// содержимое не менялось, достаточно проверить владельца
+		if uid, gid := fileOwnerIDs(info); uid == prev.UID && gid == prev.GID {
+			return nil
+		}
+	}
+
+	state := c.readState(path, info)
+	if state == nil {
+		return nil
+	}
+	c.baseline[path] = state
+
+	if prev == nil {
+		return []*types.Event{c.changeEvent(path, "created", nil, state)}
+	}
+
+	var events []*types.Event
+	if prev.Hash != state.Hash || prev.Link != state.Link || prev.Size != state.Size {
+		events = append(events, c.changeEvent(path, "modified", prev, state))
+	}
+	if prev.Mode != state.Mode || prev.UID != state.UID || prev.GID != state.GID {
+		events = append(events, c.changeEvent(path, "permissions", prev, state))
+	}
+	return events
+}
+
+func (c *FIMCollector) readState(path string, info os.FileInfo) *fimState {
+	uid, gid := fileOwnerIDs(info)
+	state := &fimState{
+		Size:    info.Size(),
+		Mode:    uint32(info.Mode()),
+		UID:     uid,
+		GID:     gid,
+		ModTime: info.ModTime(),
+	}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		state.Link, _ = os.Readlink(path)
+		return state
+	}
+	if !info.Mode().IsRegular() {
+		return state
+	}
+
+	if c.cfg.MaxHashSize > 0 && info.Size() > c.cfg.MaxHashSize {
+		return state
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	var content strings.Builder
+	writer := io.Writer(hash)
+	keepContent := info.Size() <= c.cfg.MaxDiffSize && !c.noDiff(c.hostPath(path))
+	if keepContent {
+		writer = io.MultiWriter(hash, &content)
+	}
+	if _, err := io.Copy(writer, file); err != nil {
+		return nil
+	}
+	state.Hash = hex.EncodeToString(hash.Sum(nil))
+
+	if keepContent && isText(content.String()) {
+		state.Content = content.String()
+	}
+	return state
+}
+
+func (c *FIMCollector) changeEvent(path, change string, before, after *fimState) *types.Event {
+	eventType := "file_" + change
+	if change == "permissions" {
+		eventType = "file_permissions_changed"
+	}
+
+	// в событии и в шаблонах - путь на хосте, без root_dir
+	hostPath := c.hostPath(path)
+	severity := "medium"
+	if fimSensitive(hostPath) {
+		severity = "high"
+	}
+
+	event := types.NewEvent("fim", eventType, severity, fmt.Sprintf("%s %s", change, hostPath))
+	event.SetHostname(c.hostname)
+	event.SetField("path", hostPath)
+	event.SetField("change", change)
+
+	c.setStateFields(event, "before", before)
+	c.setStateFields(event, "after", after)
+
+	if after != nil {
+		event.User = c.ids.UserName(strconv.FormatUint(uint64(after.UID), 10))
+		mode := os.FileMode(after.Mode)
+		if mode&os.ModeSetuid != 0 && (before == nil || os.FileMode(before.Mode)&os.ModeSetuid == 0) {
+			event.Severity = "critical"
+			event.SetField("setuid_added", "true")
+		}
+		if mode.Perm()&0002 != 0 && !mode.IsDir() {
+			event.Severity = "high"
+			event.SetField("world_writable", "true")
+		}
+	}
+
+	if before != nil && after != nil && change == "modified" && before.Content != "" && after.Content != "" {
+		event.SetField("diff", textDiff(before.Content, after.Content))
+	}
+	return event
+}
+
+func (c *FIMCollector) setStateFields(event *types.Event, prefix string, state *fimState) {
+	if state == nil {
+		return
+	}
+	event.SetField(prefix+"_hash", state.Hash)
+	event.SetField(prefix+"_size", strconv.FormatInt(state.Size, 10))
+	event.SetField(prefix+"_mode", os.FileMode(state.Mode).String())
+	event.SetField(prefix+"_owner", c.ids.UserName(strconv.FormatUint(uint64(state.UID), 10))+":"+c.ids.GroupName(strconv.FormatUint(uint64(state.GID), 10)))
+	event.SetField(prefix+"_mtime", state.ModTime.UTC().Format(time.RFC3339))
+	event.SetField(prefix+"_link", state.Link)
+}
+
+func (c *FIMCollector) watch(dir string) {
+	if _, err := os.Stat(dir); err != nil {
+		return
+	}
+	if err := c.watcher.Add(dir); err != nil {
+		log.Printf("FIM: не удалось отслеживать %s: %v", dir, err)
+	}
+}
+
+// covered проверяет, относится ли путь к отслеживаемым
+func (c *FIMCollector) covered(path string) bool {
+	if c.excluded(path) {
+		return false
+	}
+	for _, pattern := range c.cfg.Paths {
+		if ok, _ := filepath.Match(pattern, c.hostPath(path)); ok {
+			return true
+		}
+	}
+	for root, isDir := range c.roots {
+		if isDir && strings.HasPrefix(path, root+"/") {
+			if c.cfg.Recursive || filepath.Dir(path) == root {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c *FIMCollector) excluded(path string) bool {
+	return matchAnyPattern(c.cfg.Exclude, c.hostPath(path))
+}
+
+func (c *FIMCollector) noDiff(hostPath string) bool {
+	return matchAnyPattern(c.cfg.NoDiff, hostPath)
+}
+
+// hostPath убирает root_dir: /host/etc/shadow -> /etc/shadow
+func (c *FIMCollector) hostPath(path string) string {
+	if c.cfg.RootDir == "" || !strings.HasPrefix(path, c.cfg.RootDir+"/") {
+		return path
+	}
+	return strings.TrimPrefix(path, c.cfg.RootDir)
+}
+
+func (c *FIMCollector) loadBaseline() bool {
+	c.baseline = make(map[string]*fimState)
+
+	data, err := os.ReadFile(c.baselineFile)
+	if err != nil {
+		return false
+	}
+	if err := json.Unmarshal(data, &c.baseline); err != nil {
+		log.Printf("FIM: поврежденный baseline %s: %v", c.baselineFile, err)
+		c.baseline = make(map[string]*fimState)
+		return false
+	}
+	return true
+}
+
+func (c *FIMCollector) saveBaseline() {
+	data, err := json.Marshal(c.baseline)
+	if err != nil {
+		return
+	}
+	// baseline может содержать конфиги, читать его должен только агент
+	tmp := c.baselineFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err == nil {
+		os.Rename(tmp, c.baselineFile)
+	}
+}
+
+func fimSensitive(path string) bool {
+	return matchAnyPattern(fimSensitivePatterns, path)
+}
+
+// matchAnyPattern сравнивает шаблоны с полным путем, шаблоны без "/" -
+// с именем файла. Шаблон "*/x/y" совпадает с путем, оканчивающимся на /x/y
+func matchAnyPattern(patterns []string, path string) bool {
+	for _, pattern := range patterns {
+		target := path
+		if !strings.Contains(pattern, "/") {
+			target = filepath.Base(path)
+		}
+		if ok, _ := filepath.Match(pattern, target); ok {
+			return true
+		}
+
+		if !strings.HasPrefix(pattern, "*/") {
+			continue
+		}
+		for i := 0; i < len(path); i++ {
+			if path[i] != '/' {
+				continue
+			}
+			if ok, _ := filepath.Match(pattern[1:], path[i:]); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func fileOwnerIDs(info os.FileInfo) (uint32, uint32) {
+	if sys, ok := info.Sys().(*syscall.Stat_t); ok {
+		return sys.Uid, sys.Gid
+	}
+	return 0, 0
+}
+
+func isText(content string) bool {
+	return utf8.ValidString(content) && !strings.ContainsRune(content, 0)
+}
+
+// truncateUTF8 обрезает строку до max байт, не разрывая символ UTF-8
+func truncateUTF8(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max]
+}
+
+// textDiff строит построчный diff: удаленные строки с "-", добавленные с "+"
+func textDiff(before, after string) string {
+	a := strings.Split(before, "\n")
+	b := strings.Split(after, "\n")
+
+	// общие начало и конец в сравнении не участвуют
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	a = a[prefix : len(a)-suffix]
+	b = b[prefix : len(b)-suffix]
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "@@ -%d +%d @@\n", prefix+1, prefix+1)
+
+	if len(a)*len(b) > fimMaxDiffCells {
+		// слишком большое изменение для LCS: старые строки, затем новые
+		for _, line := range a {
+			out.WriteString("-" + line + "\n")
+		}
+		for _, line := range b {
+			out.WriteString("+" + line + "\n")
+		}
+	} else {
+		// lcs[i][j] - длина общей подпоследовательности a[i:] и b[j:]
+		width := len(b) + 1
+		lcs := make([]int, (len(a)+1)*width)
+		for i := len(a) - 1; i >= 0; i-- {
+			for j := len(b) - 1; j >= 0; j-- {
+				if a[i] == b[j] {
+					lcs[i*width+j] = lcs[(i+1)*width+j+1] + 1
+				} else {
+					lcs[i*width+j] = max(lcs[(i+1)*width+j], lcs[i*width+j+1])
+				}
+			}
+		}
+
+		i, j := 0, 0
+		for i < len(a) || j < len(b) {
+			switch {
+			case i < len(a) && j < len(b) && a[i] == b[j]:
+				out.WriteString(" " + a[i] + "\n")
+				i++
+				j++
+			// при равенстве сначала удаленная строка, как в diff -u
+			case i < len(a) && (j == len(b) || lcs[(i+1)*width+j] >= lcs[i*width+j+1]):
+				out.WriteString("-" + a[i] + "\n")
+				i++
+			default:
+				out.WriteString("+" + b[j] + "\n")
+				j++
+			}
+		}
+	}
+
+	diff := out.String()
+	if len(diff) > fimMaxDiffOutput {
+		diff = truncateUTF8(diff, fimMaxDiffOutput) + "\n... (diff обрезан)"
+	}
+	return diff
+}
@@ -0,0 +1,181 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestMatchAnyPattern(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		path     string
+		want     bool
+	}{
+		{[]string{"*/.ssh/authorized_keys*"}, "/root/.ssh/authorized_keys", true},
+		{[]string{"*/.ssh/authorized_keys*"}, "/home/alice/.ssh/authorized_keys2", true},
+		{[]string{"*/.ssh/authorized_keys*"}, "/home/alice/.ssh/known_hosts", false},
+		{[]string{"*/.ssh/authorized_keys*"}, "/home/alice/ssh/authorized_keys", false},
+		{[]string{"*/.ssh/id_*"}, "/home/bob/.ssh/id_ed25519", true},
+		{[]string{"/etc/sudoers.d/*"}, "/etc/sudoers.d/admins", true},
+		{[]string{"/etc/sudoers.d/*"}, "/etc/sudoers.d/sub/admins", false},
+		{[]string{"/etc/shadow*"}, "/etc/shadow-", true},
+		{[]string{"/etc/shadow*"}, "/host/etc/shadow", false},
+		{[]string{"*.pem"}, "/etc/ssl/private/server.pem", true},
+		{[]string{"*.swp", "*.key"}, "/etc/nginx/tls.key", true},
+		{[]string{"*.swp"}, "/etc/nginx/nginx.conf", false},
+		{nil, "/etc/passwd", false},
+	}
+	for _, tt := range tests {
+		if got := matchAnyPattern(tt.patterns, tt.path); got != tt.want {
+			t.Errorf("matchAnyPattern(%q, %q) = %v, want %v", tt.patterns, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestFIMHostPath(t *testing.T) {
+	tests := []struct {
+		rootDir string
+		path    string
+		want    string
+	}{
+		{"/host", "/host/etc/shadow", "/etc/shadow"},
+		{"/host", "/host/home/alice/.ssh/authorized_keys", "/home/alice/.ssh/authorized_keys"},
+		{"/host", "/hostile/etc/shadow", "/hostile/etc/shadow"},
+		{"/host", "/host", "/host"},
+		{"", "/etc/shadow", "/etc/shadow"},
+	}
+	for _, tt := range tests {
+		c := &FIMCollector{cfg: FIMConfig{RootDir: tt.rootDir}}
+		if got := c.hostPath(tt.path); got != tt.want {
+			t.Errorf("hostPath(%q) with root %q = %q, want %q", tt.path, tt.rootDir, got, tt.want)
+		}
+	}
+}
+
+func TestFIMChangeEventUnderRootDir(t *testing.T) {
+	dir := t.TempDir()
+	passwd := filepath.Join(dir, "passwd")
+	group := filepath.Join(dir, "group")
+	os.WriteFile(passwd, []byte("alice:x:1000:1000::/home/alice:/bin/sh\n"), 0644)
+	os.WriteFile(group, []byte("alice:x:1000:\n"), 0644)
+
+	c := &FIMCollector{
+		cfg:      FIMConfig{RootDir: "/host", Paths: []string{"/home/*/.ssh/authorized_keys"}, NoDiff: fimDefaultNoDiff},
+		hostname: "web01",
+		ids:      newIDResolver(passwd, group),
+		roots:    map[string]bool{},
+	}
+
+	before := &fimState{Hash: "a", Mode: 0600, UID: 1000, GID: 1000, Content: "ssh-ed25519 AAAA alice@laptop\n"}
+	after := &fimState{Hash: "b", Mode: 0600, UID: 1000, GID: 1000, Content: "ssh-ed25519 AAAA alice@laptop\nssh-rsa BBBB attacker@evil\n"}
+	event := c.changeEvent("/host/home/alice/.ssh/authorized_keys", "modified", before, after)
+
+	if event.Severity != "high" {
+		t.Errorf("severity = %s, want high for authorized_keys under root_dir", event.Severity)
+	}
+	if event.Fields["path"] != "/home/alice/.ssh/authorized_keys" {
+		t.Errorf("path = %q, want host path", event.Fields["path"])
+	}
+	if !strings.Contains(event.Fields["diff"], "+ssh-rsa BBBB attacker@evil") {
+		t.Errorf("diff = %q", event.Fields["diff"])
+	}
+	if event.User != "alice" || event.Fields["after_owner"] != "alice:alice" {
+		t.Errorf("user/owner = %q/%q", event.User, event.Fields["after_owner"])
+	}
+	if !c.covered("/host/home/alice/.ssh/authorized_keys") || c.covered("/host/home/alice/.ssh/config") {
+		t.Error("paths are not matched against host paths")
+	}
+	if !c.noDiff(c.hostPath("/host/etc/shadow")) || c.noDiff(c.hostPath("/host/etc/passwd")) {
+		t.Error("no_diff is not matched against host paths")
+	}
+}
+
+func TestTextDiff(t *testing.T) {
+	tests := []struct {
+		name          string
+		before, after string
+		want          string
+	}{
+		{
+			name:   "changed line",
+			before: "a\nb\nc",
+			after:  "a\nB\nc",
+			want:   "@@ -2 +2 @@\n-b\n+B\n",
+		},
+		{
+			name:   "inserted lines",
+			before: "root ALL=(ALL) ALL\n",
+			after:  "root ALL=(ALL) ALL\nalice ALL=(ALL) NOPASSWD: ALL\nbob ALL=(ALL) ALL\n",
+			want:   "@@ -2 +2 @@\n+alice ALL=(ALL) NOPASSWD: ALL\n+bob ALL=(ALL) ALL\n",
+		},
+		{
+			name:   "deleted line",
+			before: "x\ny\nz\n",
+			after:  "x\nz\n",
+			want:   "@@ -2 +2 @@\n-y\n",
+		},
+		{
+			name:   "common lines between changes",
+			before: "1\nkeep\n2\nkeep2\n3",
+			after:  "one\nkeep\n2\nkeep2\nthree",
+			want:   "@@ -1 +1 @@\n-1\n+one\n keep\n 2\n keep2\n-3\n+three\n",
+		},
+		{
+			name:   "reordered lines",
+			before: "a\nb\nc",
+			after:  "c\na\nb",
+			want:   "@@ -1 +1 @@\n+c\n a\n b\n-c\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := textDiff(tt.before, tt.after); got != tt.want {
+				t.Errorf("textDiff() =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTextDiffTruncatedAtRuneBoundary(t *testing.T) {
+	// кириллица - по 2 байта на символ, граница обрезки попадает внутрь символа
+	var after strings.Builder
+	for i := 0; i < 300; i++ {
+		after.WriteString("строка конфигурации\n")
+	}
+	diff := textDiff("", after.String())
+
+	if !strings.HasSuffix(diff, "\n... (diff обрезан)") {
+		t.Fatalf("diff of %d bytes is not truncated", len(diff))
+	}
+	if !utf8.ValidString(diff) {
+		t.Error("truncated diff is not valid UTF-8")
+	}
+	if body := strings.TrimSuffix(diff, "\n... (diff обрезан)"); len(body) > fimMaxDiffOutput || len(body) < fimMaxDiffOutput-utf8.UTFMax {
+		t.Errorf("truncated body is %d bytes, want close to %d", len(body), fimMaxDiffOutput)
+	}
+}
+
+func TestTruncateUTF8(t *testing.T) {
+	tests := []struct {
+		s    string
+		max  int
+		want string
+	}{
+		{"hello", 10, "hello"},
+		{"hello", 5, "hello"},
+		{"hello", 3, "hel"},
+		{"привет", 3, "п"},
+		{"привет", 4, "пр"},
+		{"a€b", 2, "a"},
+		{"a€b", 4, "a€"},
+		{"€", 2, ""},
+	}
+	for _, tt := range tests {
+		if got := truncateUTF8(tt.s, tt.max); got != tt.want {
+			t.Errorf("truncateUTF8(%q, %d) = %q, want %q", tt.s, tt.max, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package collector
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"siem-project/agent/pkg/config"
+	"siem-project/agent/pkg/types"
+)
+
+// как часто искать новые файлы истории (новые пользователи, первый запуск shell)
+const historyRescanInterval = time.Minute
+
+// файлы истории относительно домашнего каталога
+var historyFiles = []string{
+	".bash_history",
+	".zsh_history",
+	".local/share/fish/fish_history",
+}
+
+func init() {
+	Register(ParserFactory{
+		Type:        "bash_history",
+		Description: "история команд bash/zsh/fish; без path - всех пользователей из passwd",
+		Options: map[string]OptionSpec{
+			"passwd_path": {Type: OptionString, Description: "откуда брать домашние каталоги (/host/etc/passwd -> каталоги внутри /host)", Default: defaultPasswdPath},
+		},
+		NewCollector: func(source config.SourceConfig, opts Options, hostname string) (Collector, error) {
+			return NewHistoryCollector(source, opts.String("passwd_path"), hostname)
+		},
+	})
+}
+
+// HistoryCollector читает истории команд всех пользователей: если path
+// не задан, файлы ищутся в домашних каталогах из /etc/passwd. На каждый
+// файл создается свой LogCollector с парсером, знающим владельца
+type HistoryCollector struct {
+	source     config.SourceConfig
+	hostname   string
+	passwdPath string
+	rootDir    string
+
+	collectors map[string]*LogCollector
+	events     chan *types.Event
+	mu         sync.Mutex
+	wg         sync.WaitGroup
+	stopCh     chan struct{}
+}
+
+// найденный файл истории и его владелец
+type historyFile struct {
+	path string
+	user string
+}
+
+func NewHistoryCollector(source config.SourceConfig, passwdPath, hostname string) (*HistoryCollector, error) {
+	if passwdPath == "" {
+		passwdPath = defaultPasswdPath
+	}
+
+	return &HistoryCollector{
+		source:     source,
+		hostname:   hostname,
+		passwdPath: passwdPath,
+		// /host/etc/passwd -> домашние каталоги ищутся внутри /host
+		rootDir:    strings.TrimSuffix(passwdPath, defaultPasswdPath),
+		collectors: make(map[string]*LogCollector),
+		events:     make(chan *types.Event, 100),
+		stopCh:     make(chan struct{}),
+	}, nil
+}
+
+func (h *HistoryCollector) Start() error {
+	h.scan()
+
+	h.mu.Lock()
+	started := len(h.collectors)
+	h.mu.Unlock()
+	if h.source.Path != "" && started == 0 {
+		return fmt.Errorf("failed to start history collector for %s", h.source.Path)
+	}
+
+	h.wg.Add(1)
+	go h.rescanLoop()
+
+	return nil
+}
+
+func (h *HistoryCollector) Stop() {
+	close(h.stopCh)
+
+	h.mu.Lock()
+	for _, coll := range h.collectors {
+		coll.Stop()
+	}
+	h.mu.Unlock()
+
+	h.wg.Wait()
+	close(h.events)
+}
+
+func (h *HistoryCollector) Events() <-chan *types.Event {
+	return h.events
+}
+
+func (h *HistoryCollector) rescanLoop() {
+	defer h.wg.Done()
+
+	ticker := time.NewTicker(historyRescanInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			h.scan()
+		case <-h.stopCh:
+			return
+		}
+	}
+}
+
+// scan запускает коллекторы для еще не отслеживаемых файлов
+func (h *HistoryCollector) scan() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	select {
+	case <-h.stopCh:
+		return
+	default:
+	}
+
+	for _, file := range h.discover() {
+		if _, exists := h.collectors[file.path]; exists {
+			continue
+		}
+
+		source := h.source
+		source.Path = file.path
+		parser := NewShellHistoryParser(historyFormat(file.path), file.user)
+		offsetKey := "bash_history_" + strings.ReplaceAll(strings.Trim(file.path, "/"), "/", "_")
+
+		coll, err := newCollectorWithOffsetKey(source, parser, h.hostname, offsetKey)
+		if err != nil {
+			log.Printf("Не удалось создать коллектор истории %s: %v", file.path, err)
+			continue
+		}
+		if err := coll.Start(); err != nil {
+			log.Printf("Не удалось запустить коллектор истории %s: %v", file.path, err)
+			continue
+		}
+
+		h.collectors[file.path] = coll
+		log.Printf("Отслеживается история команд %s (пользователь %s)", file.path, file.user)
+
+		h.wg.Add(1)
+		go h.forward(coll)
+	}
+}
+
+func (h *HistoryCollector) forward(coll *LogCollector) {
+	defer h.wg.Done()
+
+	// читает до закрытия канала: при остановке дочерний коллектор отдает
+	// незавершенные события, и они не должны теряться
+	for event := range coll.Events() {
+		h.events <- event
+	}
+}
+
+// discover возвращает файлы истории с владельцами
+func (h *HistoryCollector) discover() []historyFile {
+	entries, err := readPasswd(h.passwdPath)
+	if err != nil {
+		log.Printf("Не удалось прочитать %s: %v", h.passwdPath, err)
+	}
+
+	if h.source.Path != "" {
+		return []historyFile{{path: h.source.Path, user: fileOwner(h.source.Path, entries)}}
+	}
+
+	var files []historyFile
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		if entry.Home == "" || entry.Home == "/" || seen[entry.Home] {
+			continue
+		}
+		seen[entry.Home] = true
+
+		for _, name := range historyFiles {
+			path := filepath.Join(h.rootDir, entry.Home, name)
+			if stat, err := os.Stat(path); err == nil && stat.Mode().IsRegular() {
+				files = append(files, historyFile{path: path, user: entry.Name})
+			}
+		}
+	}
+	return files
+}
+
+// fileOwner определяет владельца файла по uid
+func fileOwner(path string, entries []passwdEntry) string {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return ""
+	}
+	sys, ok := stat.Sys().(*syscall.Stat_t)
+	if !ok {
+		return ""
+	}
+
+	uid := strconv.FormatUint(uint64(sys.Uid), 10)
+	for _, entry := range entries {
+		if entry.UID == uid {
+			return entry.Name
+		}
+	}
+	return uid
+}
@@ -0,0 +1,258 @@
+package collector
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"siem-project/agent/pkg/config"
+	"siem-project/agent/pkg/types"
+)
+
+// ключи, которые пробуются, если в fields не задано отображение
+var jsonDefaultKeys = map[string][]string{
+	"timestamp": {"timestamp", "@timestamp", "time", "ts"},
+	"severity":  {"level", "severity", "log.level"},
+}
+
+// уровни логов приложений -> severity событий
+var jsonLevelSeverity = map[string]string{
+	"trace":    "low",
+	"debug":    "low",
+	"info":     "low",
+	"notice":   "low",
+	"warn":     "medium",
+	"warning":  "medium",
+	"error":    "high",
+	"err":      "high",
+	"critical": "critical",
+	"crit":     "critical",
+	"fatal":    "critical",
+	"panic":    "critical",
+	"alert":    "critical",
+	"emerg":    "critical",
+}
+
+func init() {
+	Register(ParserFactory{
+		Type:        "json",
+		Description: "JSON-lines логи приложений с отображением ключей на поля события",
+		Options: map[string]OptionSpec{
+			"name":             {Type: OptionString, Description: "значение Event.Source", Default: "json"},
+			"fields":           {Type: OptionMap, Description: "поле события (timestamp, user, process, command, severity, event_type) -> ключ, вложенные через точку"},
+			"timestamp_format": {Type: OptionString, Description: "формат времени Go, если это не RFC3339 и не unix time"},
+			"event_type":       {Type: OptionString, Description: "тип события по умолчанию", Default: "json_event"},
+			"severity":         {Type: OptionString, Description: "severity по умолчанию", Default: "low"},
+		},
+		NewParser: func(source config.SourceConfig, opts Options) (LogParser, error) {
+			return NewJSONParser(opts.String("name"), opts.StringMap("fields"), opts.String("timestamp_format"), opts.String("event_type"), opts.String("severity")), nil
+		},
+	})
+}
+
+// JSONParser разбирает строки JSON-lines. Отображенные ключи идут в поля
+// события, остальные - в details с вложенными ключами через точку
+type JSONParser struct {
+	name            string
+	fields          map[string]string
+	timestampFormat string
+	eventType       string
+	severity        string
+}
+
+func NewJSONParser(name string, fields map[string]string, timestampFormat, eventType, severity string) *JSONParser {
+	if name == "" {
+		name = "json"
+	}
+	if eventType == "" {
+		eventType = "json_event"
+	}
+	if severity == "" {
+		severity = "low"
+	}
+	return &JSONParser{
+		name:            name,
+		fields:          fields,
+		timestampFormat: timestampFormat,
+		eventType:       eventType,
+		severity:        severity,
+	}
+}
+
+func (p *JSONParser) GetSourceType() string {
+	return p.name
+}
+
+func (p *JSONParser) Parse(line string, hostname string) (*types.Event, error) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return nil, fmt.Errorf("empty line")
+	}
+
+	event := types.NewEvent(p.name, p.eventType, p.severity, line)
+	event.SetHostname(hostname)
+
+	var doc map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader([]byte(line)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil {
+		// строку не теряем, помечаем ошибку разбора
+		event.SetField("parse_error", err.Error())
+		return event, nil
+	}
+
+	flat := make(map[string]interface{})
+	flattenJSON("", doc, flat)
+
+	used := make(map[string]bool)
+	for _, target := range []string{"timestamp", "user", "process", "command", "severity", "event_type"} {
+		key, value, ok := p.lookup(target, flat)
+		if !ok {
+			continue
+		}
+		used[key] = true
+		p.setEventField(event, target, value)
+	}
+
+	for key, value := range flat {
+		if !used[key] {
+			event.SetField(key, jsonString(value))
+		}
+	}
+
+	return event, nil
+}
+
+// lookup находит значение для поля события по fields или ключам по умолчанию
+func (p *JSONParser) lookup(target string, flat map[string]interface{}) (string, interface{}, bool) {
+	if key, ok := p.fields[target]; ok {
+		value, found := flat[key]
+		return key, value, found
+	}
+
+	for _, key := range jsonDefaultKeys[target] {
+		if value, ok := flat[key]; ok {
+			return key, value, true
+		}
+	}
+	return "", nil, false
+}
+
+func (p *JSONParser) setEventField(event *types.Event, target string, value interface{}) {
+	str := jsonString(value)
+
+	switch target {
+	case "timestamp":
+		if ts, ok := p.parseTimestamp(value); ok {
+			event.SetTimestamp(ts)
+		} else {
+			event.SetField("timestamp", str)
+		}
+	case "user":
+		event.User = str
+	case "process":
+		event.Process = str
+	case "command":
+		event.Command = str
+	case "event_type":
+		event.EventType = str
+	case "severity":
+		if severity, ok := jsonLevelSeverity[strings.ToLower(str)]; ok {
+			event.Severity = severity
+		}
+		event.SetField("level", str)
+	}
+}
+
+// parseTimestamp понимает RFC3339, timestamp_format и unix time в секундах,
+// миллисекундах, микросекундах или наносекундах (числом или строкой)
+func (p *JSONParser) parseTimestamp(value interface{}) (time.Time, bool) {
+	if num, ok := value.(json.Number); ok {
+		return unixTimestamp(num.String())
+	}
+
+	str, ok := value.(string)
+	if !ok {
+		return time.Time{}, false
+	}
+	if p.timestampFormat != "" {
+		t, err := time.ParseInLocation(p.timestampFormat, str, time.Local)
+		return t, err == nil
+	}
+	if t, ok := unixTimestamp(str); ok {
+		return t, true
+	}
+	return parseSyslogTimestamp(str, time.Now(), time.Local)
+}
+
+// unixTimestamp определяет единицы по величине числа: сейчас это около
+// 1.7e9 с, 1.7e12 мс, 1.7e15 мкс и 1.7e18 нс. Целые числа разбираются
+// без float64, чтобы не терять наносекунды
+func unixTimestamp(s string) (time.Time, bool) {
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		switch {
+		case n > 1e17:
+			return time.Unix(0, n), true
+		case n > 1e14:
+			return time.UnixMicro(n), true
+		case n > 1e11:
+			return time.UnixMilli(n), true
+		default:
+			return time.Unix(n, 0), true
+		}
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(f) || math.Abs(f) >= math.MaxInt64 {
+		return time.Time{}, false
+	}
+	// целая часть переводится точно, дробная - с округлением
+	whole, frac := math.Modf(f)
+	var t time.Time
+	unit := time.Second
+	switch {
+	case f > 1e17:
+		t, unit = time.Unix(0, int64(whole)), time.Nanosecond
+	case f > 1e14:
+		t, unit = time.UnixMicro(int64(whole)), time.Microsecond
+	case f > 1e11:
+		t, unit = time.UnixMilli(int64(whole)), time.Millisecond
+	default:
+		t = time.Unix(int64(whole), 0)
+	}
+	return t.Add(time.Duration(math.Round(frac * float64(unit)))), true
+}
+
+// flattenJSON раскладывает вложенные объекты в ключи вида a.b.c
+func flattenJSON(prefix string, value interface{}, out map[string]interface{}) {
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		out[prefix] = value
+		return
+	}
+
+	for key, val := range obj {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		flattenJSON(key, val, out)
+	}
+}
+
+func jsonString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case nil:
+		return ""
+	default:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+}
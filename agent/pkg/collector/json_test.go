@@ -0,0 +1,51 @@
+package collector
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestJSONParseUnixTimestamp(t *testing.T) {
+	want := time.Date(2024, 1, 15, 10, 0, 0, 123456789, time.UTC)
+
+	tests := []struct {
+		name  string
+		value interface{}
+		want  time.Time
+	}{
+		{"seconds", json.Number("1705312800"), want.Truncate(time.Second)},
+		{"fractional seconds", json.Number("1705312800.5"), want.Truncate(time.Second).Add(500 * time.Millisecond)},
+		{"milliseconds", json.Number("1705312800123"), want.Truncate(time.Millisecond)},
+		{"microseconds", json.Number("1705312800123456"), want.Truncate(time.Microsecond)},
+		{"nanoseconds", json.Number("1705312800123456789"), want},
+		{"milliseconds as float", json.Number("1705312800123.0"), want.Truncate(time.Millisecond)},
+		{"seconds string", "1705312800", want.Truncate(time.Second)},
+		{"microseconds string", "1705312800123456", want.Truncate(time.Microsecond)},
+		{"nanoseconds string", "1705312800123456789", want},
+	}
+
+	p := NewJSONParser("", nil, "", "", "")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := p.parseTimestamp(tt.value)
+			if !ok {
+				t.Fatalf("parseTimestamp(%v) failed", tt.value)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("parseTimestamp(%v) = %v, want %v", tt.value, got.UTC(), tt.want)
+			}
+		})
+	}
+}
+
+func TestJSONParseEventTimestamp(t *testing.T) {
+	p := NewJSONParser("app", nil, "", "", "")
+	event, err := p.Parse(`{"ts":1705312800123456,"level":"error","msg":"boom"}`, "web01")
+	if err != nil || event == nil {
+		t.Fatalf("Parse() = %v, %v", event, err)
+	}
+	if ts, _ := time.Parse(time.RFC3339Nano, event.Timestamp); ts.Year() != 2024 {
+		t.Errorf("timestamp = %s, want 2024", event.Timestamp)
+	}
+}
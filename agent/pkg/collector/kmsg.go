@@ -0,0 +1,461 @@
+package collector
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"siem-project/agent/pkg/config"
+	"siem-project/agent/pkg/types"
+)
+
+// уровень сообщения ядра (PRI & 7) -> важность события
+var kmsgSeverity = map[int]string{
+	0: "critical", // emerg
+	1: "critical", // alert
+	2: "critical", // crit
+	3: "high",     // err
+	4: "medium",   // warning
+	5: "low",      // notice
+	6: "low",      // info
+	7: "low",      // debug
+}
+
+// одна запись /dev/kmsg не превышает 8 КБ вместе со словарем
+const kmsgMaxRecord = 8192
+
+// как часто сохранять номер последней записи
+const kmsgCheckpointInterval = time.Second
+
+func init() {
+	Register(ParserFactory{
+		Type:        "kmsg",
+		Description: "кольцевой буфер ядра /dev/kmsg: segfault, OOM, модули, AppArmor/SELinux, USB",
+		Options: map[string]OptionSpec{
+			"path":          {Type: OptionString, Description: "устройство kmsg", Default: "/dev/kmsg"},
+			"proc_path":     {Type: OptionString, Description: "каталог proc для времени загрузки и boot_id", Default: "/proc"},
+			"read_existing": {Type: OptionBool, Description: "при первом запуске прочитать весь буфер, а не только новые записи", Default: false},
+		},
+		NewCollector: func(source config.SourceConfig, opts Options, hostname string) (Collector, error) {
+			return NewKmsgCollector(opts.String("path"), opts.String("proc_path"), opts.Bool("read_existing"), hostname), nil
+		},
+	})
+}
+
+// KmsgCollector читает записи ядра "PRI,SEQ,USEC,FLAGS;сообщение" с
+// продолжением " KEY=VALUE". Номер записи сохраняется вместе с boot_id:
+// после перезагрузки нумерация начинается заново
+type KmsgCollector struct {
+	path         string
+	procPath     string
+	readExisting bool
+	hostname     string
+	checkpoint   string
+	parser       *kmsgParser
+
+	file     *os.File
+	bootID   string
+	bootTime time.Time
+	lastSeq  uint64
+	saved    uint64
+	savedAt  time.Time
+
+	events chan *types.Event
+	wg     sync.WaitGroup
+	stopCh chan struct{}
+}
+
+// состояние в .offsets/kmsg.json
+type kmsgCheckpoint struct {
+	BootID   string `json:"boot_id"`
+	Sequence uint64 `json:"sequence"`
+}
+
+func NewKmsgCollector(path, procPath string, readExisting bool, hostname string) *KmsgCollector {
+	if path == "" {
+		path = "/dev/kmsg"
+	}
+	if procPath == "" {
+		procPath = "/proc"
+	}
+	os.MkdirAll(".offsets", 0755)
+
+	return &KmsgCollector{
+		path:         path,
+		procPath:     procPath,
+		readExisting: readExisting,
+		hostname:     hostname,
+		checkpoint:   filepath.Join(".offsets", "kmsg.json"),
+		parser:       newKmsgParser(),
+		events:       make(chan *types.Event, 100),
+		stopCh:       make(chan struct{}),
+	}
+}
+
+func (c *KmsgCollector) Start() error {
+	bootTime, err := readBootTime(c.procPath)
+	if err != nil {
+		return fmt.Errorf("failed to read boot time from %s: %w", c.procPath, err)
+	}
+	c.bootTime = bootTime
+
+	if data, err := os.ReadFile(filepath.Join(c.procPath, "sys/kernel/random/boot_id")); err == nil {
+		c.bootID = strings.TrimSpace(string(data))
+	}
+
+	// O_NONBLOCK: чтение ждет данных через poller и прерывается закрытием файла
+	file, err := os.OpenFile(c.path, os.O_RDONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", c.path, err)
+	}
+	c.file = file
+
+	var saved kmsgCheckpoint
+	data, err := os.ReadFile(c.checkpoint)
+	switch {
+	case err == nil && json.Unmarshal(data, &saved) == nil && saved.BootID == c.bootID:
+		// та же загрузка: пропускаем уже отправленные записи
+		c.lastSeq = saved.Sequence
+		c.saved = saved.Sequence
+	case err == nil:
+		// была перезагрузка, весь буфер новый
+	case !c.readExisting:
+		c.file.Seek(0, io.SeekEnd)
+	}
+
+	c.wg.Add(1)
+	go c.readLoop()
+
+	return nil
+}
+
+func (c *KmsgCollector) Stop() {
+	close(c.stopCh)
+	c.file.Close()
+	c.wg.Wait()
+	c.saveCheckpoint()
+	close(c.events)
+}
+
+func (c *KmsgCollector) Events() <-chan *types.Event {
+	return c.events
+}
+
+// readLoop читает записи: из /dev/kmsg одно чтение возвращает одну запись,
+// из обычного файла (для проверки) - сколько поместится, поэтому записи
+// дополнительно делятся по строкам
+func (c *KmsgCollector) readLoop() {
+	defer c.wg.Done()
+
+	buf := make([]byte, kmsgMaxRecord)
+	var pending string
+	for {
+		n, err := c.file.Read(buf)
+		if n > 0 {
+			records := splitKmsgRecords(pending + string(buf[:n]))
+			pending = ""
+			if !strings.HasSuffix(string(buf[:n]), "\n") && len(records) > 0 {
+				pending = records[len(records)-1]
+				records = records[:len(records)-1]
+			}
+			for _, record := range records {
+				if !c.handle(record) {
+					return
+				}
+			}
+		}
+
+		switch {
+		case err == nil:
+			continue
+		case errors.Is(err, syscall.EPIPE):
+			// записи перезаписаны до того, как их прочитали
+			log.Printf("Часть записей %s потеряна: буфер ядра переполнен", c.path)
+			continue
+		case errors.Is(err, os.ErrClosed):
+			return
+		case err == io.EOF:
+			// обычный файл дочитан до конца
+		default:
+			log.Printf("Ошибка чтения %s: %v", c.path, err)
+		}
+
+		select {
+		case <-time.After(time.Second):
+		case <-c.stopCh:
+			return
+		}
+	}
+}
+
+// handle разбирает запись и отправляет событие; false - коллектор остановлен
+func (c *KmsgCollector) handle(record string) bool {
+	rec, ok := parseKmsgRecord(record)
+	if !ok || (rec.seq <= c.lastSeq && c.lastSeq > 0) {
+		return true
+	}
+	c.lastSeq = rec.seq
+
+	// время от загрузки без учета сна, поэтому после suspend возможен сдвиг
+	event := c.parser.parse(rec, c.bootTime.Add(time.Duration(rec.usec)*time.Microsecond), c.hostname)
+
+	if time.Since(c.savedAt) >= kmsgCheckpointInterval {
+		c.saveCheckpoint()
+	}
+
+	if event == nil {
+		return true
+	}
+	select {
+	case c.events <- event:
+		return true
+	case <-c.stopCh:
+		return false
+	}
+}
+
+func (c *KmsgCollector) saveCheckpoint() {
+	c.savedAt = time.Now()
+	if c.lastSeq == c.saved {
+		return
+	}
+	data, err := json.Marshal(kmsgCheckpoint{BootID: c.bootID, Sequence: c.lastSeq})
+	if err != nil {
+		return
+	}
+	if err := os.WriteFile(c.checkpoint, data, 0644); err != nil {
+		log.Printf("Не удалось сохранить позицию kmsg: %v", err)
+		return
+	}
+	c.saved = c.lastSeq
+}
+
+// запись kmsg после разбора заголовка
+type kmsgRecord struct {
+	priority int
+	seq      uint64
+	usec     uint64
+	message  string
+	dict     map[string]string
+	raw      string
+}
+
+// splitKmsgRecords делит текст на записи: строки с пробелом в начале -
+// словарь (SUBSYSTEM=, DEVICE=) предыдущей записи
+func splitKmsgRecords(text string) []string {
+	var records []string
+	for _, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		if strings.HasPrefix(line, " ") && len(records) > 0 {
+			records[len(records)-1] += "\n" + line
+			continue
+		}
+		if line != "" {
+			records = append(records, line)
+		}
+	}
+	return records
+}
+
+// parseKmsgRecord разбирает "6,1234,5678901,-;сообщение"
+func parseKmsgRecord(record string) (kmsgRecord, bool) {
+	rec := kmsgRecord{raw: record, dict: make(map[string]string)}
+
+	header, body, ok := strings.Cut(record, ";")
+	if !ok {
+		return rec, false
+	}
+	fields := strings.Split(header, ",")
+	if len(fields) < 3 {
+		return rec, false
+	}
+
+	var err error
+	if rec.priority, err = strconv.Atoi(fields[0]); err != nil {
+		return rec, false
+	}
+	if rec.seq, err = strconv.ParseUint(fields[1], 10, 64); err != nil {
+		return rec, false
+	}
+	if rec.usec, err = strconv.ParseUint(fields[2], 10, 64); err != nil {
+		return rec, false
+	}
+
+	lines := strings.Split(body, "\n")
+	rec.message = lines[0]
+	for _, line := range lines[1:] {
+		if key, value, ok := strings.Cut(strings.TrimSpace(line), "="); ok {
+			rec.dict[key] = value
+		}
+	}
+	return rec, true
+}
+
+// kmsgParser относит сообщения ядра к категориям безопасности
+type kmsgParser struct {
+	segfaultRegex *regexp.Regexp
+	trapRegex     *regexp.Regexp
+	oomRegex      *regexp.Regexp
+	moduleRegex   *regexp.Regexp
+	auditRegex    *regexp.Regexp
+	fieldRegex    *regexp.Regexp
+	avcRegex      *regexp.Regexp
+	usbRegex      *regexp.Regexp
+	usbIDRegex    *regexp.Regexp
+	firewall      *firewallExtractor
+}
+
+func newKmsgParser() *kmsgParser {
+	return &kmsgParser{
+		// a.out[1234]: segfault at 0 ip 000055d5 sp 00007ffc error 4 in a.out[55d5+1000]
+		segfaultRegex: regexp.MustCompile(`^(\S+)\[(\d+)\]: segfault at ([0-9a-f]+) ip ([0-9a-f]+) sp ([0-9a-f]+) error (\d+)(?: in ([^\[\s]+))?`),
+		// traps: a.out[1234] general protection fault ip:... / trap invalid opcode ip:...
+		trapRegex: regexp.MustCompile(`^traps: (\S+)\[(\d+)\] (general protection fault|trap [\w ]+?) ip:([0-9a-f]+)`),
+		// Out of memory: Killed process 1234 (java) total-vm:..., UID:1000 pgtables:...
+		oomRegex: regexp.MustCompile(`Killed process (\d+) \(([^)]*)\)(?:.*?UID:(\d+))?`),
+		// rootkit: loading out-of-tree module taints kernel.
+		moduleRegex: regexp.MustCompile(`^(\S+): (loading out-of-tree module taints kernel|module verification failed: .*|module license .* taints kernel|module is from the staging directory.*)`),
+		// audit: type=1400 audit(1705314225.123:45): apparmor="DENIED" ...
+		auditRegex: regexp.MustCompile(`^audit: type=\d+ audit\([\d.]+:\d+\): (.*)$`),
+		fieldRegex: regexp.MustCompile(`(\w+)=("[^"]*"|\S+)`),
+		// avc:  denied  { read } for  pid=1234 comm="httpd" ...
+		avcRegex: regexp.MustCompile(`avc:\s+(denied|granted)\s+\{ ([^}]*) \}`),
+		// usb 1-1: New USB device found, idVendor=0781, idProduct=5567
+		usbRegex:   regexp.MustCompile(`^usb (\S+): (New USB device found|USB disconnect)`),
+		usbIDRegex: regexp.MustCompile(`idVendor=([0-9a-f]{4}), idProduct=([0-9a-f]{4})`),
+		firewall:   newFirewallExtractor(),
+	}
+}
+
+// parse возвращает событие для записи; сообщения без категории остаются
+// kernel_message с важностью по уровню ядра
+func (p *kmsgParser) parse(rec kmsgRecord, ts time.Time, hostname string) *types.Event {
+	level := rec.priority & 7
+	severity := kmsgSeverity[level]
+
+	event := types.NewEvent("kmsg", "kernel_message", severity, rec.message)
+	event.SetHostname(hostname)
+	event.SetTimestamp(ts)
+	event.Process = "kernel"
+	event.SetField("kernel_level", strconv.Itoa(level))
+	event.SetField("facility", strconv.Itoa(rec.priority>>3))
+	event.SetField("sequence", strconv.FormatUint(rec.seq, 10))
+	event.SetField("uptime_usec", strconv.FormatUint(rec.usec, 10))
+	event.SetField("subsystem", rec.dict["SUBSYSTEM"])
+	event.SetField("device", rec.dict["DEVICE"])
+
+	message := rec.message
+	switch {
+	case p.segfaultRegex.MatchString(message):
+		m := p.segfaultRegex.FindStringSubmatch(message)
+		setKernelEvent(event, "process_crashed", "medium")
+		event.Process = fmt.Sprintf("%s[%s]", m[1], m[2])
+		event.SetField("crash_type", "segfault")
+		event.SetField("pid", m[2])
+		event.SetField("fault_address", m[3])
+		event.SetField("instruction_pointer", m[4])
+		event.SetField("error_code", m[6])
+		event.SetField("binary", m[7])
+
+	case p.trapRegex.MatchString(message):
+		m := p.trapRegex.FindStringSubmatch(message)
+		setKernelEvent(event, "process_crashed", "medium")
+		event.Process = fmt.Sprintf("%s[%s]", m[1], m[2])
+		event.SetField("crash_type", strings.ReplaceAll(m[3], " ", "_"))
+		event.SetField("pid", m[2])
+		event.SetField("instruction_pointer", m[4])
+
+	case strings.Contains(message, "Killed process") && p.oomRegex.MatchString(message):
+		m := p.oomRegex.FindStringSubmatch(message)
+		setKernelEvent(event, "oom_kill", "high")
+		event.Process = fmt.Sprintf("%s[%s]", m[2], m[1])
+		event.SetField("pid", m[1])
+		event.SetField("uid", m[3])
+
+	case p.moduleRegex.MatchString(message):
+		m := p.moduleRegex.FindStringSubmatch(message)
+		// ядро пишет только о модулях, которые его "портят": неподписанных,
+		// сторонних и с несвободной лицензией - так грузятся руткиты
+		setKernelEvent(event, "kernel_module_loaded", "high")
+		event.SetField("module", m[1])
+		event.SetField("taint_reason", m[2])
+
+	case p.auditRegex.MatchString(message):
+		p.parseAudit(event, p.auditRegex.FindStringSubmatch(message)[1])
+
+	case p.usbRegex.MatchString(message):
+		m := p.usbRegex.FindStringSubmatch(message)
+		event.SetField("usb_port", m[1])
+		if m[2] == "USB disconnect" {
+			setKernelEvent(event, "usb_device_disconnected", "low")
+			break
+		}
+		setKernelEvent(event, "usb_device_connected", "medium")
+		if ids := p.usbIDRegex.FindStringSubmatch(message); ids != nil {
+			event.SetField("vendor_id", ids[1])
+			event.SetField("product_id", ids[2])
+		}
+
+	case strings.Contains(message, "USB Mass Storage device detected"):
+		setKernelEvent(event, "usb_storage_connected", "medium")
+
+	default:
+		p.firewall.extract(event, "kernel", message)
+	}
+
+	return event
+}
+
+// parseAudit разбирает отказы AppArmor и SELinux, которые ядро пишет в
+// kmsg, когда auditd не запущен
+func (p *kmsgParser) parseAudit(event *types.Event, body string) {
+	fields := make(map[string]string)
+	for _, m := range p.fieldRegex.FindAllStringSubmatch(body, -1) {
+		fields[m[1]] = strings.Trim(m[2], `"`)
+	}
+
+	switch {
+	case fields["apparmor"] == "DENIED":
+		setKernelEvent(event, "apparmor_denied", "medium")
+		event.SetField("operation", fields["operation"])
+		event.SetField("profile", fields["profile"])
+		event.SetField("path", fields["name"])
+		event.SetField("requested_mask", fields["requested_mask"])
+		event.SetField("denied_mask", fields["denied_mask"])
+
+	case p.avcRegex.MatchString(body):
+		m := p.avcRegex.FindStringSubmatch(body)
+		if m[1] != "denied" {
+			return
+		}
+		setKernelEvent(event, "selinux_denied", "medium")
+		event.SetField("permission", m[2])
+		event.SetField("path", fields["name"])
+		event.SetField("scontext", fields["scontext"])
+		event.SetField("tcontext", fields["tcontext"])
+		event.SetField("tclass", fields["tclass"])
+		event.SetField("permissive", fields["permissive"])
+
+	default:
+		return
+	}
+
+	event.SetField("pid", fields["pid"])
+	if fields["comm"] != "" {
+		event.Process = fmt.Sprintf("%s[%s]", fields["comm"], fields["pid"])
+	}
+}
+
+func setKernelEvent(event *types.Event, eventType, severity string) {
+	event.EventType = eventType
+	event.Severity = severity
+}
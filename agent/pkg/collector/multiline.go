@@ -0,0 +1,121 @@
+package collector
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"siem-project/agent/pkg/config"
+)
+
+const (
+	defaultMultilineMaxLines     = 500
+	defaultMultilineFlushTimeout = time.Second
+)
+
+// multilineBuffer склеивает строки одной записи (stack trace, kernel oops)
+type multilineBuffer struct {
+	start        *regexp.Regexp
+	continuation *regexp.Regexp
+	maxLines     int
+	flushTimeout time.Duration
+
+	lines       []string
+	truncated   bool
+	startOffset int64
+	lastAppend  time.Time
+}
+
+// готовая многострочная запись
+type multilineRecord struct {
+	text      string
+	lines     int
+	truncated bool
+}
+
+func newMultilineBuffer(cfg *config.MultilineConfig) *multilineBuffer {
+	if cfg == nil {
+		return nil
+	}
+
+	m := &multilineBuffer{
+		maxLines:     cfg.MaxLines,
+		flushTimeout: defaultMultilineFlushTimeout,
+	}
+	// шаблоны уже проверены в config.Validate
+	if cfg.StartPattern != "" {
+		m.start = regexp.MustCompile(cfg.StartPattern)
+	}
+	if cfg.ContinuationPattern != "" {
+		m.continuation = regexp.MustCompile(cfg.ContinuationPattern)
+	}
+	if m.maxLines == 0 {
+		m.maxLines = defaultMultilineMaxLines
+	}
+	if d, err := time.ParseDuration(cfg.FlushTimeout); err == nil && d > 0 {
+		m.flushTimeout = d
+	}
+	return m
+}
+
+// Add добавляет строку, начинающуюся в файле со смещения offset, и
+// возвращает предыдущую запись, если эта строка ее завершила
+func (m *multilineBuffer) Add(line string, truncated bool, offset int64) []multilineRecord {
+	var done []multilineRecord
+
+	if !m.isContinuation(line) || len(m.lines) == 0 {
+		if rec, ok := m.take(); ok {
+			done = append(done, rec)
+		}
+		m.startOffset = offset
+	}
+
+	m.lines = append(m.lines, line)
+	m.truncated = m.truncated || truncated
+	m.lastAppend = time.Now()
+
+	if len(m.lines) >= m.maxLines {
+		if rec, ok := m.take(); ok {
+			done = append(done, rec)
+		}
+	}
+	return done
+}
+
+// Expired возвращает запись, к которой давно не добавлялись строки
+func (m *multilineBuffer) Expired() (multilineRecord, bool) {
+	if len(m.lines) == 0 || time.Since(m.lastAppend) < m.flushTimeout {
+		return multilineRecord{}, false
+	}
+	return m.take()
+}
+
+// Pending сообщает, есть ли незавершенная запись, и где она начинается
+func (m *multilineBuffer) Pending() (int64, bool) {
+	return m.startOffset, len(m.lines) > 0
+}
+
+func (m *multilineBuffer) isContinuation(line string) bool {
+	if m.continuation != nil && m.continuation.MatchString(line) {
+		return true
+	}
+	if m.start != nil {
+		return !m.start.MatchString(line)
+	}
+	return false
+}
+
+func (m *multilineBuffer) take() (multilineRecord, bool) {
+	if len(m.lines) == 0 {
+		return multilineRecord{}, false
+	}
+
+	rec := multilineRecord{
+		text:      strings.Join(m.lines, "\n"),
+		lines:     len(m.lines),
+		truncated: m.truncated,
+	}
+	m.lines = nil
+	m.truncated = false
+	return rec, true
+}
@@ -0,0 +1,490 @@
+package collector
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"siem-project/agent/pkg/config"
+	"siem-project/agent/pkg/types"
+)
+
+// состояния сокетов в /proc/net/{tcp,udp}
+const (
+	tcpEstablished = "01"
+	tcpListen      = "0A"
+	udpUnconnected = "07"
+)
+
+var netTables = []string{"tcp", "tcp6", "udp", "udp6"}
+
+func init() {
+	Register(ParserFactory{
+		Type:        "network",
+		Description: "новые слушающие порты и соединения из /proc/net с процессом и пользователем",
+		Options: map[string]OptionSpec{
+			"proc_path":       {Type: OptionString, Description: "каталог proc для поиска процессов по сокетам", Default: "/proc"},
+			"net_path":        {Type: OptionString, Description: "каталог с tcp/udp таблицами; для сети хоста из контейнера - /host/proc/1/net (по умолчанию <proc_path>/net)"},
+			"interval":        {Type: OptionDuration, Description: "период опроса", Default: "10s"},
+			"allow":           {Type: OptionList, Description: "известные соединения без событий: \"process=sshd local_port=22\", \"remote_ip=10.0.0.0/8 remote_port=443\""},
+			"report_existing": {Type: OptionBool, Description: "отправить события для соединений, открытых до запуска агента", Default: false},
+			"passwd_path":     {Type: OptionString, Description: "файл для имен пользователей (/host/etc/passwd в контейнере)", Default: defaultPasswdPath},
+		},
+		Validate: func(source config.SourceConfig, opts Options) error {
+			_, err := parseNetAllowlist(opts.Strings("allow"))
+			return err
+		},
+		NewCollector: func(source config.SourceConfig, opts Options, hostname string) (Collector, error) {
+			allow, err := parseNetAllowlist(opts.Strings("allow"))
+			if err != nil {
+				return nil, err
+			}
+			return NewNetworkCollector(opts.String("proc_path"), opts.String("net_path"), opts.Duration("interval"), allow, opts.Bool("report_existing"), opts.String("passwd_path"), hostname), nil
+		},
+	})
+}
+
+// NetworkCollector опрашивает таблицы сокетов ядра и сообщает о новых
+// слушающих портах и установленных соединениях
+type NetworkCollector struct {
+	procPath       string
+	netPath        string
+	interval       time.Duration
+	allow          []netAllowRule
+	reportExisting bool
+	hostname       string
+	ids            *idResolver
+
+	known map[string]bool // сокеты из предыдущего опроса
+
+	events chan *types.Event
+	wg     sync.WaitGroup
+	stopCh chan struct{}
+}
+
+// строка таблицы сокетов
+type netSocket struct {
+	protocol   string
+	localIP    net.IP
+	localPort  int
+	remoteIP   net.IP
+	remotePort int
+	state      string
+	uid        string
+	inode      string
+}
+
+// владелец сокета, найденный через /proc/<pid>/fd
+type netOwner struct {
+	pid     int
+	comm    string
+	exe     string
+	cmdline string
+}
+
+func NewNetworkCollector(procPath, netPath string, interval time.Duration, allow []netAllowRule, reportExisting bool, passwdPath, hostname string) *NetworkCollector {
+	if procPath == "" {
+		procPath = "/proc"
+	}
+	if netPath == "" {
+		netPath = filepath.Join(procPath, "net")
+	}
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	if passwdPath == "" {
+		passwdPath = defaultPasswdPath
+	}
+
+	return &NetworkCollector{
+		procPath:       procPath,
+		netPath:        netPath,
+		interval:       interval,
+		allow:          allow,
+		reportExisting: reportExisting,
+		hostname:       hostname,
+		ids:            newIDResolver(passwdPath, defaultGroupPath),
+		events:         make(chan *types.Event, 100),
+		stopCh:         make(chan struct{}),
+	}
+}
+
+func (c *NetworkCollector) Start() error {
+	if _, err := os.Stat(filepath.Join(c.netPath, "tcp")); err != nil {
+		return fmt.Errorf("failed to read socket tables in %s: %w", c.netPath, err)
+	}
+
+	c.wg.Add(1)
+	go c.pollLoop()
+
+	return nil
+}
+
+func (c *NetworkCollector) Stop() {
+	close(c.stopCh)
+	c.wg.Wait()
+	close(c.events)
+}
+
+func (c *NetworkCollector) Events() <-chan *types.Event {
+	return c.events
+}
+
+func (c *NetworkCollector) pollLoop() {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	c.poll()
+	for {
+		select {
+		case <-ticker.C:
+			c.poll()
+		case <-c.stopCh:
+			return
+		}
+	}
+}
+
+func (c *NetworkCollector) poll() {
+	var sockets []netSocket
+	for _, table := range netTables {
+		list, err := readNetTable(filepath.Join(c.netPath, table), table)
+		if err != nil {
+			continue
+		}
+		sockets = append(sockets, list...)
+	}
+
+	// слушающие сокеты, чтобы отличать входящие соединения
+	listening := newNetListeners(sockets)
+
+	first := c.known == nil
+	current := make(map[string]bool, len(sockets))
+	var fresh []netSocket
+	for _, sock := range sockets {
+		if !sock.listening() && sock.state != tcpEstablished {
+			continue
+		}
+		key := sock.key()
+		current[key] = true
+		if !c.known[key] && (!first || c.reportExisting) {
+			fresh = append(fresh, sock)
+		}
+	}
+	c.known = current
+
+	if len(fresh) == 0 {
+		return
+	}
+
+	// обход /proc/*/fd дорогой, поэтому только когда есть новые сокеты
+	owners := c.socketOwners()
+	for _, sock := range fresh {
+		event := c.socketEvent(sock, owners[sock.inode], listening)
+		if event == nil {
+			continue
+		}
+		select {
+		case c.events <- event:
+		case <-c.stopCh:
+			return
+		}
+	}
+}
+
+func (c *NetworkCollector) socketEvent(sock netSocket, owner *netOwner, listening netListeners) *types.Event {
+	direction := "outbound"
+	if listening.accepts(sock) {
+		direction = "inbound"
+	}
+
+	user := ""
+	if sock.uid != "" {
+		user = c.ids.UserName(sock.uid)
+	}
+
+	if c.allowed(sock, owner, user) {
+		return nil
+	}
+
+	var event *types.Event
+	raw := fmt.Sprintf("%s %s:%d -> %s:%d state=%s uid=%s inode=%s", sock.protocol, sock.localIP, sock.localPort, sock.remoteIP, sock.remotePort, sock.state, sock.uid, sock.inode)
+	if sock.listening() {
+		event = types.NewEvent("network", "listening_port_opened", "medium", raw)
+	} else {
+		event = types.NewEvent("network", "network_connection_established", "low", raw)
+		event.SetField("remote_ip", sock.remoteIP.String())
+		event.SetField("remote_port", strconv.Itoa(sock.remotePort))
+		event.SetField("direction", direction)
+	}
+	event.SetHostname(c.hostname)
+	event.User = user
+
+	event.SetField("protocol", sock.protocol)
+	event.SetField("local_ip", sock.localIP.String())
+	event.SetField("local_port", strconv.Itoa(sock.localPort))
+	event.SetField("uid", sock.uid)
+	event.SetField("inode", sock.inode)
+
+	if owner != nil {
+		event.Process = fmt.Sprintf("%s[%d]", owner.comm, owner.pid)
+		event.Command = owner.cmdline
+		event.SetField("pid", strconv.Itoa(owner.pid))
+		event.SetField("exe", owner.exe)
+	}
+	return event
+}
+
+// socketOwners строит соответствие inode сокета -> процесс
+func (c *NetworkCollector) socketOwners() map[string]*netOwner {
+	owners := make(map[string]*netOwner)
+
+	entries, err := os.ReadDir(c.procPath)
+	if err != nil {
+		log.Printf("Не удалось прочитать %s: %v", c.procPath, err)
+		return owners
+	}
+
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+
+		dir := filepath.Join(c.procPath, entry.Name())
+		fds, err := os.ReadDir(filepath.Join(dir, "fd"))
+		if err != nil {
+			continue
+		}
+
+		var owner *netOwner
+		for _, fd := range fds {
+			link, err := os.Readlink(filepath.Join(dir, "fd", fd.Name()))
+			if err != nil || !strings.HasPrefix(link, "socket:[") {
+				continue
+			}
+			inode := strings.TrimSuffix(strings.TrimPrefix(link, "socket:["), "]")
+			if _, exists := owners[inode]; exists {
+				// сокет унаследован, владельцем считается первый процесс
+				continue
+			}
+
+			if owner == nil {
+				owner = &netOwner{pid: pid}
+				comm, _ := os.ReadFile(filepath.Join(dir, "comm"))
+				owner.comm = strings.TrimSpace(string(comm))
+				owner.exe, _ = os.Readlink(filepath.Join(dir, "exe"))
+				cmdline, _ := os.ReadFile(filepath.Join(dir, "cmdline"))
+				owner.cmdline = strings.TrimSpace(strings.ReplaceAll(string(cmdline), "\x00", " "))
+			}
+			owners[inode] = owner
+		}
+	}
+	return owners
+}
+
+func (c *NetworkCollector) allowed(sock netSocket, owner *netOwner, user string) bool {
+	for _, rule := range c.allow {
+		if rule.matches(sock, owner, user) {
+			return true
+		}
+	}
+	return false
+}
+
+// netListeners - слушающие сокеты по таблице (tcp, tcp6, udp, udp6),
+// адресу и порту; сокет на 0.0.0.0 или :: записывается как "*"
+type netListeners map[string]bool
+
+func newNetListeners(sockets []netSocket) netListeners {
+	listening := make(netListeners)
+	for _, sock := range sockets {
+		if !sock.listening() {
+			continue
+		}
+		ip := sock.localIP.String()
+		if sock.localIP.IsUnspecified() {
+			ip = "*"
+		}
+		listening[listenerKey(sock.protocol, ip, sock.localPort)] = true
+	}
+	return listening
+}
+
+// accepts: соединение пришло на слушающий сокет той же таблицы
+// с тем же портом и адресом (или на сокет, слушающий все адреса)
+func (l netListeners) accepts(sock netSocket) bool {
+	return l[listenerKey(sock.protocol, sock.localIP.String(), sock.localPort)] ||
+		l[listenerKey(sock.protocol, "*", sock.localPort)]
+}
+
+func listenerKey(protocol, ip string, port int) string {
+	return fmt.Sprintf("%s|%s|%d", protocol, ip, port)
+}
+
+func (s netSocket) listening() bool {
+	if strings.HasPrefix(s.protocol, "udp") {
+		return s.state == udpUnconnected && s.remotePort == 0
+	}
+	return s.state == tcpListen
+}
+
+func (s netSocket) key() string {
+	return fmt.Sprintf("%s|%s|%d|%s|%d|%s", s.protocol, s.localIP, s.localPort, s.remoteIP, s.remotePort, s.inode)
+}
+
+// readNetTable разбирает /proc/net/tcp и аналогичные таблицы
+func readNetTable(path, protocol string) ([]netSocket, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var sockets []netSocket
+	scanner := bufio.NewScanner(file)
+	scanner.Scan() // заголовок
+	for scanner.Scan() {
+		// sl local_address rem_address st tx_queue:rx_queue tr:tm->when retrnsmt uid timeout inode
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 {
+			continue
+		}
+
+		localIP, localPort, err := parseNetAddr(fields[1])
+		if err != nil {
+			continue
+		}
+		remoteIP, remotePort, err := parseNetAddr(fields[2])
+		if err != nil {
+			continue
+		}
+
+		sockets = append(sockets, netSocket{
+			protocol:   protocol,
+			localIP:    localIP,
+			localPort:  localPort,
+			remoteIP:   remoteIP,
+			remotePort: remotePort,
+			state:      fields[3],
+			uid:        fields[7],
+			inode:      fields[9],
+		})
+	}
+	return sockets, scanner.Err()
+}
+
+// parseNetAddr разбирает "0100007F:0050": адрес - 32-битные слова
+// в порядке байт хоста (little-endian), порт - big-endian hex
+func parseNetAddr(value string) (net.IP, int, error) {
+	addr, port, ok := strings.Cut(value, ":")
+	if !ok {
+		return nil, 0, fmt.Errorf("invalid address %q", value)
+	}
+
+	raw, err := hex.DecodeString(addr)
+	if err != nil || (len(raw) != 4 && len(raw) != 16) {
+		return nil, 0, fmt.Errorf("invalid address %q", value)
+	}
+	ip := make(net.IP, len(raw))
+	for i := 0; i < len(raw); i += 4 {
+		binary.BigEndian.PutUint32(ip[i:], binary.LittleEndian.Uint32(raw[i:]))
+	}
+	if v4 := ip.To4(); v4 != nil {
+		// ::ffff:a.b.c.d в tcp6 показываем как IPv4
+		ip = v4
+	}
+
+	portNum, err := strconv.ParseUint(port, 16, 16)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid port %q", value)
+	}
+	return ip, int(portNum), nil
+}
+
+// netAllowRule - набор условий key=value, которые должны выполниться все
+type netAllowRule struct {
+	conditions map[string]string
+	network    *net.IPNet
+}
+
+var netAllowKeys = map[string]bool{
+	"process": true, "exe": true, "user": true, "protocol": true,
+	"local_port": true, "remote_ip": true, "remote_port": true,
+}
+
+func parseNetAllowlist(entries []string) ([]netAllowRule, error) {
+	var rules []netAllowRule
+	for i, entry := range entries {
+		rule := netAllowRule{conditions: make(map[string]string)}
+		for _, cond := range strings.Fields(entry) {
+			key, value, ok := strings.Cut(cond, "=")
+			if !ok || !netAllowKeys[key] {
+				return nil, fmt.Errorf("allow[%d]: invalid condition %q", i, cond)
+			}
+			if key == "remote_ip" && strings.Contains(value, "/") {
+				_, network, err := net.ParseCIDR(value)
+				if err != nil {
+					return nil, fmt.Errorf("allow[%d]: %w", i, err)
+				}
+				rule.network = network
+				continue
+			}
+			rule.conditions[key] = value
+		}
+		if len(rule.conditions) == 0 && rule.network == nil {
+			return nil, fmt.Errorf("allow[%d]: empty rule", i)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func (r netAllowRule) matches(sock netSocket, owner *netOwner, user string) bool {
+	if r.network != nil && !r.network.Contains(sock.remoteIP) {
+		return false
+	}
+
+	for key, want := range r.conditions {
+		var have string
+		switch key {
+		case "process":
+			if owner != nil {
+				have = owner.comm
+			}
+		case "exe":
+			if owner != nil {
+				have = owner.exe
+			}
+		case "user":
+			have = user
+		case "protocol":
+			// tcp подходит и для tcp6
+			have = strings.TrimSuffix(sock.protocol, "6")
+			if want == sock.protocol {
+				have = want
+			}
+		case "local_port":
+			have = strconv.Itoa(sock.localPort)
+		case "remote_ip":
+			have = sock.remoteIP.String()
+		case "remote_port":
+			have = strconv.Itoa(sock.remotePort)
+		}
+		if have != want {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,73 @@
+package collector
+
+import (
+	"net"
+	"testing"
+)
+
+func TestNetworkConnectionDirection(t *testing.T) {
+	listeners := []netSocket{
+		// mDNS: udp на 5353 не делает входящими tcp-соединения с того же порта
+		{protocol: "udp", localIP: net.IPv4zero, localPort: 5353, remoteIP: net.IPv4zero, state: udpUnconnected, inode: "1"},
+		{protocol: "tcp", localIP: net.IPv4zero, localPort: 22, remoteIP: net.IPv4zero, state: tcpListen, inode: "2"},
+		{protocol: "tcp", localIP: net.ParseIP("127.0.0.1"), localPort: 8080, remoteIP: net.IPv4zero, state: tcpListen, inode: "3"},
+		{protocol: "tcp6", localIP: net.IPv6unspecified, localPort: 443, remoteIP: net.IPv6unspecified, state: tcpListen, inode: "4"},
+	}
+
+	tests := []struct {
+		name string
+		sock netSocket
+		want string
+	}{
+		{
+			name: "tcp connection from the port of a udp listener",
+			sock: netSocket{protocol: "tcp", localIP: net.ParseIP("10.0.0.5"), localPort: 5353, remoteIP: net.ParseIP("93.184.216.34"), remotePort: 443},
+			want: "outbound",
+		},
+		{
+			name: "connected udp socket on the listening udp port",
+			sock: netSocket{protocol: "udp", localIP: net.ParseIP("10.0.0.5"), localPort: 5353, remoteIP: net.ParseIP("10.0.0.9"), remotePort: 5353},
+			want: "inbound",
+		},
+		{
+			name: "ssh to wildcard listener",
+			sock: netSocket{protocol: "tcp", localIP: net.ParseIP("10.0.0.5"), localPort: 22, remoteIP: net.ParseIP("198.51.100.7"), remotePort: 50022},
+			want: "inbound",
+		},
+		{
+			name: "ipv6 connection from the port of an ipv4 listener",
+			sock: netSocket{protocol: "tcp6", localIP: net.ParseIP("2001:db8::5"), localPort: 22, remoteIP: net.ParseIP("2001:db8::9"), remotePort: 443},
+			want: "outbound",
+		},
+		{
+			name: "connection on port of a loopback-only listener",
+			sock: netSocket{protocol: "tcp", localIP: net.ParseIP("10.0.0.5"), localPort: 8080, remoteIP: net.ParseIP("203.0.113.1"), remotePort: 80},
+			want: "outbound",
+		},
+		{
+			name: "loopback connection to a loopback listener",
+			sock: netSocket{protocol: "tcp", localIP: net.ParseIP("127.0.0.1"), localPort: 8080, remoteIP: net.ParseIP("127.0.0.1"), remotePort: 40000},
+			want: "inbound",
+		},
+		{
+			name: "ipv4-mapped connection to a dual-stack listener",
+			sock: netSocket{protocol: "tcp6", localIP: net.ParseIP("::ffff:10.0.0.5"), localPort: 443, remoteIP: net.ParseIP("::ffff:198.51.100.7"), remotePort: 61000},
+			want: "inbound",
+		},
+	}
+
+	c := NewNetworkCollector(t.TempDir(), "", 0, nil, false, "", "web01")
+	listening := newNetListeners(listeners)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.sock.state = tcpEstablished
+			event := c.socketEvent(tt.sock, nil, listening)
+			if event == nil {
+				t.Fatal("socketEvent() = nil")
+			}
+			if got := event.Fields["direction"]; got != tt.want {
+				t.Errorf("direction = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
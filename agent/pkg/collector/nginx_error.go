@@ -0,0 +1,131 @@
+package collector
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"siem-project/agent/pkg/config"
+	"siem-project/agent/pkg/types"
+)
+
+// уровни error_log nginx -> severity событий
+var nginxErrorSeverity = map[string]string{
+	"debug":  "low",
+	"info":   "low",
+	"notice": "low",
+	"warn":   "medium",
+	"error":  "medium",
+	"crit":   "high",
+	"alert":  "critical",
+	"emerg":  "critical",
+}
+
+func init() {
+	Register(ParserFactory{
+		Type:        "nginx_error",
+		Description: "error_log nginx: уровень, клиент, запрос, блокировки и ошибки upstream",
+		NewParser: func(source config.SourceConfig, opts Options) (LogParser, error) {
+			return NewNginxErrorParser(), nil
+		},
+	})
+}
+
+// 2024/01/15 10:30:00 [error] 1234#1234: *5 open() "/var/www/x" failed (2: No such file or directory), client: 10.0.0.1, server: example.com, request: "GET /x HTTP/1.1", host: "example.com"
+type NginxErrorParser struct {
+	lineRegex    *regexp.Regexp
+	contextRegex *regexp.Regexp
+}
+
+func NewNginxErrorParser() *NginxErrorParser {
+	return &NginxErrorParser{
+		lineRegex: regexp.MustCompile(`^(\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}) \[(\w+)\] (\d+)#(\d+): (?:\*(\d+) )?(.*)$`),
+		// ", client: 1.2.3.4" и ", request: "GET / HTTP/1.1"" в конце сообщения
+		contextRegex: regexp.MustCompile(`, (client|server|request|upstream|host|referrer): ("(?:[^"\\]|\\.)*"|[^,]*)`),
+	}
+}
+
+func (p *NginxErrorParser) GetSourceType() string {
+	return "nginx_error"
+}
+
+func (p *NginxErrorParser) Parse(line string, hostname string) (*types.Event, error) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return nil, fmt.Errorf("empty line")
+	}
+
+	m := p.lineRegex.FindStringSubmatch(line)
+	if m == nil {
+		return nil, fmt.Errorf("invalid nginx error log format")
+	}
+
+	level := m[2]
+	severity, ok := nginxErrorSeverity[level]
+	if !ok {
+		severity = "medium"
+	}
+
+	event := types.NewEvent("nginx_error", "nginx_error", severity, line)
+	event.SetHostname(hostname)
+	event.Process = "nginx"
+	event.SetField("level", level)
+	event.SetField("pid", m[3])
+	event.SetField("connection", m[5])
+
+	if ts, err := time.ParseInLocation("2006/01/02 15:04:05", m[1], time.Local); err == nil {
+		event.SetTimestamp(ts)
+	}
+
+	message := m[6]
+	values := make(map[string]string)
+	if loc := p.contextRegex.FindStringIndex(message); loc != nil {
+		for _, ctx := range p.contextRegex.FindAllStringSubmatch(message[loc[0]:], -1) {
+			values[ctx[1]] = unescapeWebValue(strings.Trim(ctx[2], `"`))
+		}
+		message = message[:loc[0]]
+	}
+	event.SetField("message", message)
+
+	fieldNames := map[string]string{"client": "src_ip", "server": "vhost", "upstream": "upstream_addr", "host": "host", "referrer": "referrer"}
+	for key, field := range fieldNames {
+		event.SetField(field, values[key])
+	}
+
+	if request, ok := values["request"]; ok {
+		values = map[string]string{"request": request}
+		splitHTTPRequest(values)
+		for _, key := range []string{"http_method", "url_path", "query", "http_version"} {
+			event.SetField(key, values[key])
+		}
+	}
+
+	p.classify(event, message, values)
+
+	return event, nil
+}
+
+func (p *NginxErrorParser) classify(event *types.Event, message string, values map[string]string) {
+	target := decodeWebTarget(values["url_path"] + "?" + values["query"])
+
+	switch {
+	case webSQLiRegex.MatchString(target):
+		setWebAttack(event, "web_sqli", "sqli", "high")
+	case webXSSRegex.MatchString(target):
+		setWebAttack(event, "web_xss", "xss", "high")
+	case webTraversalRegex.MatchString(target):
+		setWebAttack(event, "web_path_traversal", "path_traversal", "high")
+	case strings.HasPrefix(message, "limiting requests") || strings.HasPrefix(message, "limiting connections"):
+		event.EventType = "web_rate_limited"
+		event.Severity = "medium"
+	case strings.Contains(message, "access forbidden by rule"):
+		event.EventType = "web_access_denied"
+		event.Severity = "medium"
+	case strings.Contains(message, "no user/password was provided") || strings.Contains(message, "password mismatch") || strings.Contains(message, "was not found in"):
+		event.EventType = "web_auth_failed"
+		event.Severity = "medium"
+	case strings.Contains(message, "upstream timed out") || strings.Contains(message, "connect() failed") || strings.Contains(message, "upstream prematurely closed"):
+		event.EventType = "web_upstream_error"
+	}
+}
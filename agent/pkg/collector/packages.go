@@ -0,0 +1,443 @@
+package collector
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"siem-project/agent/pkg/config"
+	"siem-project/agent/pkg/types"
+)
+
+// инструменты разведки и атак: их установка на сервер заслуживает внимания
+var offensivePackages = map[string]bool{
+	"nmap": true, "masscan": true, "zmap": true, "hydra": true, "john": true,
+	"hashcat": true, "ncat": true, "netcat": true, "netcat-traditional": true,
+	"netcat-openbsd": true, "socat": true, "sqlmap": true, "nikto": true,
+	"metasploit-framework": true, "proxychains": true, "proxychains4": true,
+	"aircrack-ng": true,
+}
+
+// средства защиты и журналирования: удаление часто предшествует атаке
+var securityPackages = map[string]bool{
+	"auditd": true, "audit": true, "apparmor": true, "selinux-policy": true,
+	"selinux-policy-targeted": true, "fail2ban": true, "rsyslog": true,
+	"ufw": true, "firewalld": true, "nftables": true, "iptables": true,
+	"aide": true, "clamav": true, "osquery": true,
+}
+
+// архитектуры rpm, по которым NEVRA отделяется от имени пакета
+var rpmArches = map[string]bool{
+	"x86_64": true, "noarch": true, "i686": true, "i386": true, "aarch64": true,
+	"ppc64le": true, "s390x": true, "armv7hl": true, "src": true,
+}
+
+func init() {
+	timezone := map[string]OptionSpec{
+		"timezone": {Type: OptionString, Description: "зона для времени без смещения (по умолчанию локальная)"},
+	}
+
+	Register(ParserFactory{
+		Type:        "dpkg",
+		Description: "/var/log/dpkg.log: установка, обновление и удаление пакетов",
+		Options:     timezone,
+		NewParser: func(source config.SourceConfig, opts Options) (LogParser, error) {
+			loc, err := timezoneOption(opts)
+			if err != nil {
+				return nil, err
+			}
+			parser := NewDpkgParser()
+			parser.location = loc
+			return parser, nil
+		},
+	})
+
+	Register(ParserFactory{
+		Type:        "apt_history",
+		Description: "/var/log/apt/history.log: операции apt с командой и пользователем",
+		Options:     timezone,
+		NewParser: func(source config.SourceConfig, opts Options) (LogParser, error) {
+			loc, err := timezoneOption(opts)
+			if err != nil {
+				return nil, err
+			}
+			parser := NewAptHistoryParser()
+			parser.location = loc
+			return parser, nil
+		},
+	})
+
+	for _, sourceType := range []string{"dnf", "yum"} {
+		sourceType := sourceType
+		Register(ParserFactory{
+			Type:        sourceType,
+			Description: "/var/log/dnf.rpm.log и /var/log/yum.log",
+			Options:     timezone,
+			NewParser: func(source config.SourceConfig, opts Options) (LogParser, error) {
+				loc, err := timezoneOption(opts)
+				if err != nil {
+					return nil, err
+				}
+				parser := NewDnfParser(sourceType)
+				parser.location = loc
+				return parser, nil
+			},
+		})
+	}
+}
+
+// DpkgParser парсит /var/log/dpkg.log. Пользователя и команду dpkg не пишет,
+// они есть только в apt history.log
+type DpkgParser struct {
+	location  *time.Location
+	lineRegex *regexp.Regexp
+}
+
+func NewDpkgParser() *DpkgParser {
+	return &DpkgParser{
+		location: time.Local,
+		// 2024-01-15 10:23:45 upgrade libssl3:amd64 3.0.2-0ubuntu1.10 3.0.2-0ubuntu1.12
+		lineRegex: regexp.MustCompile(`^(\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}) (install|upgrade|remove) (\S+) (\S+) (\S+)$`),
+	}
+}
+
+func (p *DpkgParser) GetSourceType() string {
+	return "dpkg"
+}
+
+// Parse возвращает события только для install/upgrade/remove; строки
+// status, configure, trigproc и purge (идет после remove) пропускаются
+func (p *DpkgParser) Parse(line string, hostname string) (*types.Event, error) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return nil, fmt.Errorf("empty line")
+	}
+
+	m := p.lineRegex.FindStringSubmatch(line)
+	if m == nil {
+		return nil, nil
+	}
+
+	name, arch := splitDebArch(m[3])
+	var event *types.Event
+	switch {
+	case m[2] == "remove":
+		event = newPackageEvent("dpkg", "package_removed", name, m[4], line)
+	case m[2] == "upgrade" && m[4] != "<none>":
+		event = newPackageEvent("dpkg", "package_upgraded", name, m[5], line)
+		event.SetField("old_version", m[4])
+	default:
+		event = newPackageEvent("dpkg", "package_installed", name, m[5], line)
+	}
+	event.SetHostname(hostname)
+	event.SetField("arch", arch)
+
+	if ts, ok := parseSyslogTimestamp(m[1], time.Now(), p.location); ok {
+		event.SetTimestamp(ts)
+	}
+	return event, nil
+}
+
+// AptHistoryParser собирает блоки history.log (от Start-Date до End-Date)
+// и возвращает по событию на каждый пакет. Parse отдает первое событие
+// блока, остальные забирает Flush
+type AptHistoryParser struct {
+	location     *time.Location
+	entryRegex   *regexp.Regexp
+	requestRegex *regexp.Regexp
+	stanza       *aptStanza
+	ready        []*types.Event
+}
+
+// один блок history.log
+type aptStanza struct {
+	start   time.Time
+	command string
+	user    string
+	uid     string
+	err     string
+	actions [][2]string // действие (Install, Upgrade, ...) и список пакетов
+}
+
+// действия apt -> тип события
+var aptActions = map[string]string{
+	"Install":   "package_installed",
+	"Reinstall": "package_installed",
+	"Upgrade":   "package_upgraded",
+	"Downgrade": "package_downgraded",
+	"Remove":    "package_removed",
+	"Purge":     "package_removed",
+}
+
+func NewAptHistoryParser() *AptHistoryParser {
+	return &AptHistoryParser{
+		location: time.Local,
+		// nginx:amd64 (1.18.0-6ubuntu14.4), libssl3:amd64 (3.0.2-0ubuntu1.10, 3.0.2-0ubuntu1.12)
+		entryRegex: regexp.MustCompile(`([^\s,()]+) \(([^)]*)\)`),
+		// Requested-By: alice (1000)
+		requestRegex: regexp.MustCompile(`^(\S+)(?: \((\d+)\))?`),
+	}
+}
+
+func (p *AptHistoryParser) GetSourceType() string {
+	return "apt_history"
+}
+
+// Parse принимает как отдельные строки, так и весь блок целиком, если
+// в источнике настроен multiline
+func (p *AptHistoryParser) Parse(text string, hostname string) (*types.Event, error) {
+	var events []*types.Event
+
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		key, value, ok := strings.Cut(line, ": ")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+
+		if key == "Start-Date" {
+			// предыдущий блок не получил End-Date (apt прервали)
+			events = append(events, p.finish(hostname)...)
+			p.stanza = &aptStanza{}
+			if ts, ok := parseSyslogTimestamp(value, time.Now(), p.location); ok {
+				p.stanza.start = ts
+			}
+			continue
+		}
+
+		if p.stanza == nil {
+			// чтение началось с середины блока
+			p.stanza = &aptStanza{}
+		}
+
+		switch key {
+		case "Commandline":
+			p.stanza.command = value
+		case "Requested-By":
+			if m := p.requestRegex.FindStringSubmatch(value); m != nil {
+				p.stanza.user, p.stanza.uid = m[1], m[2]
+			}
+		case "Error":
+			p.stanza.err = value
+		case "End-Date":
+			events = append(events, p.finish(hostname)...)
+		default:
+			if _, ok := aptActions[key]; ok {
+				p.stanza.actions = append(p.stanza.actions, [2]string{key, value})
+			}
+		}
+	}
+
+	if len(events) == 0 {
+		return nil, nil
+	}
+	p.ready = append(p.ready, events[1:]...)
+	return events[0], nil
+}
+
+// Flush отдает оставшиеся события разобранных блоков. force сбрасывает и
+// незавершенный блок: apt пишет список пакетов только в конце операции,
+// поэтому без force он не трогается
+func (p *AptHistoryParser) Flush(hostname string, force bool) []*types.Event {
+	events := p.ready
+	p.ready = nil
+	if force {
+		events = append(events, p.finish(hostname)...)
+	}
+	return events
+}
+
+// finish превращает текущий блок в события и закрывает его
+func (p *AptHistoryParser) finish(hostname string) []*types.Event {
+	stanza := p.stanza
+	p.stanza = nil
+	if stanza == nil {
+		return nil
+	}
+
+	var events []*types.Event
+	for _, action := range stanza.actions {
+		for _, m := range p.entryRegex.FindAllStringSubmatch(action[1], -1) {
+			name, arch := splitDebArch(m[1])
+			versions := strings.Split(m[2], ", ")
+
+			raw := fmt.Sprintf("%s: %s (%s)", action[0], m[1], m[2])
+			if stanza.command != "" {
+				raw = fmt.Sprintf("Commandline: %s; %s", stanza.command, raw)
+			}
+
+			eventType := aptActions[action[0]]
+			version := versions[0]
+			if (eventType == "package_upgraded" || eventType == "package_downgraded") && len(versions) > 1 {
+				version = versions[1]
+			}
+
+			event := newPackageEvent("apt_history", eventType, name, version, raw)
+			event.SetHostname(hostname)
+			event.SetField("arch", arch)
+			if version != versions[0] {
+				event.SetField("old_version", versions[0])
+			}
+			for _, flag := range versions[1:] {
+				if flag == "automatic" {
+					event.SetField("automatic", "true")
+				}
+			}
+			switch action[0] {
+			case "Reinstall":
+				event.SetField("reinstall", "true")
+			case "Purge":
+				event.SetField("purge", "true")
+			}
+
+			event.User = stanza.user
+			event.Command = stanza.command
+			event.SetField("uid", stanza.uid)
+			event.SetField("error", stanza.err)
+			if !stanza.start.IsZero() {
+				event.SetTimestamp(stanza.start)
+			}
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+// DnfParser парсит /var/log/dnf.rpm.log и /var/log/yum.log. Обновление
+// пишется двумя строками (Upgrade: новая версия, Upgraded: старая),
+// событие создается по первой
+type DnfParser struct {
+	sourceType string
+	location   *time.Location
+	lineRegex  *regexp.Regexp
+}
+
+// действия dnf/yum -> тип события
+var dnfActions = map[string]string{
+	"Installed": "package_installed",
+	"Install":   "package_installed",
+	"Reinstall": "package_installed",
+	"Upgrade":   "package_upgraded",
+	"Updated":   "package_upgraded",
+	"Downgrade": "package_downgraded",
+	"Erase":     "package_removed",
+	"Erased":    "package_removed",
+	"Obsoleted": "package_removed",
+}
+
+func NewDnfParser(sourceType string) *DnfParser {
+	return &DnfParser{
+		sourceType: sourceType,
+		location:   time.Local,
+		// 2024-01-15T10:23:45+0000 SUBDEBUG Installed: nginx-1:1.20.1-10.el9.x86_64
+		// Jan 15 10:23:45 Updated: 1:openssl-1.0.2k-26.el7_9.x86_64
+		lineRegex: regexp.MustCompile(`^([A-Z][a-z]{2}\s+\d{1,2}\s+\d{2}:\d{2}:\d{2}|\S+)\s+(?:[A-Z]+\s+)?(\w+):\s+(\S+)\s*$`),
+	}
+}
+
+func (p *DnfParser) GetSourceType() string {
+	return p.sourceType
+}
+
+func (p *DnfParser) Parse(line string, hostname string) (*types.Event, error) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return nil, fmt.Errorf("empty line")
+	}
+
+	m := p.lineRegex.FindStringSubmatch(line)
+	if m == nil {
+		return nil, nil
+	}
+	eventType, ok := dnfActions[m[2]]
+	if !ok {
+		return nil, nil
+	}
+
+	name, version, arch := splitNEVRA(m[3])
+	event := newPackageEvent(p.sourceType, eventType, name, version, line)
+	event.SetHostname(hostname)
+	event.SetField("arch", arch)
+	switch m[2] {
+	case "Reinstall":
+		event.SetField("reinstall", "true")
+	case "Obsoleted":
+		event.SetField("obsoleted", "true")
+	}
+
+	if ts, ok := parseSyslogTimestamp(m[1], time.Now(), p.location); ok {
+		event.SetTimestamp(ts)
+	}
+	return event, nil
+}
+
+// newPackageEvent создает событие о пакете; установка инструментов атак
+// и удаление средств защиты повышают важность
+func newPackageEvent(source, eventType, name, version, raw string) *types.Event {
+	severity := "low"
+	if eventType == "package_downgraded" {
+		severity = "medium"
+	}
+
+	event := types.NewEvent(source, eventType, severity, raw)
+	event.SetField("package", name)
+	event.SetField("version", version)
+
+	switch {
+	case eventType == "package_installed" && offensivePackages[name]:
+		event.Severity = "medium"
+		event.SetField("suspicious", "offensive_tool")
+	case eventType == "package_removed" && securityPackages[name]:
+		event.Severity = "high"
+		event.SetField("suspicious", "security_tool_removed")
+	}
+	return event
+}
+
+// splitDebArch разделяет "nginx:amd64" на имя и архитектуру
+func splitDebArch(pkg string) (string, string) {
+	if i := strings.LastIndexByte(pkg, ':'); i > 0 {
+		return pkg[:i], pkg[i+1:]
+	}
+	return pkg, ""
+}
+
+// splitNEVRA разбирает name-[epoch:]version-release.arch; yum пишет эпоху
+// перед именем (1:openssl-...). Старый yum для Erased пишет только имя
+func splitNEVRA(nevra string) (string, string, string) {
+	epoch := ""
+	if i := strings.IndexByte(nevra, ':'); i > 0 && !strings.ContainsRune(nevra[:i], '-') {
+		epoch, nevra = nevra[:i+1], nevra[i+1:]
+	}
+
+	dot := strings.LastIndexByte(nevra, '.')
+	if dot < 0 || !rpmArches[nevra[dot+1:]] {
+		return nevra, "", ""
+	}
+	arch := nevra[dot+1:]
+	rest := nevra[:dot]
+
+	release := strings.LastIndexByte(rest, '-')
+	if release < 0 {
+		return rest, "", arch
+	}
+	version := strings.LastIndexByte(rest[:release], '-')
+	if version < 0 {
+		return rest, "", arch
+	}
+	return rest[:version], epoch + rest[version+1:], arch
+}
+
+func timezoneOption(opts Options) (*time.Location, error) {
+	tz := opts.String("timezone")
+	if tz == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone: %w", err)
+	}
+	return loc, nil
+}
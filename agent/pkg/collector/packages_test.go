@@ -0,0 +1,51 @@
+package collector
+
+import "testing"
+
+func TestSplitNEVRA(t *testing.T) {
+	tests := []struct {
+		nevra   string
+		name    string
+		version string
+		arch    string
+	}{
+		{"nginx-1.20.1-14.el9.x86_64", "nginx", "1.20.1-14.el9", "x86_64"},
+		{"python3-pip-21.2.3-7.el9.noarch", "python3-pip", "21.2.3-7.el9", "noarch"},
+		{"1:openssl-3.0.7-27.el9.x86_64", "openssl", "1:3.0.7-27.el9", "x86_64"},
+		{"openssl-1:3.0.7-27.el9.x86_64", "openssl", "1:3.0.7-27.el9", "x86_64"},
+		{"glibc-langpack-en-2.34-100.el9.aarch64", "glibc-langpack-en", "2.34-100.el9", "aarch64"},
+		{"kernel-core-5.14.0-427.13.1.el9_4.x86_64", "kernel-core", "5.14.0-427.13.1.el9_4", "x86_64"},
+		{"java-17-openjdk-17.0.9.0.9-2.el9.i686", "java-17-openjdk", "17.0.9.0.9-2.el9", "i686"},
+		// старый yum пишет для Erased только имя
+		{"nmap", "nmap", "", ""},
+		{"python3.11", "python3.11", "", ""},
+		{"foo.x86_64", "foo", "", "x86_64"},
+		{"foo-1.0.noarch", "foo-1.0", "", "noarch"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.nevra, func(t *testing.T) {
+			name, version, arch := splitNEVRA(tt.nevra)
+			if name != tt.name || version != tt.version || arch != tt.arch {
+				t.Errorf("splitNEVRA(%q) = %q, %q, %q; want %q, %q, %q",
+					tt.nevra, name, version, arch, tt.name, tt.version, tt.arch)
+			}
+		})
+	}
+}
+
+func TestSplitDebArch(t *testing.T) {
+	tests := []struct {
+		pkg, name, arch string
+	}{
+		{"nginx:amd64", "nginx", "amd64"},
+		{"libc6:i386", "libc6", "i386"},
+		{"tzdata:all", "tzdata", "all"},
+		{"nmap", "nmap", ""},
+	}
+	for _, tt := range tests {
+		if name, arch := splitDebArch(tt.pkg); name != tt.name || arch != tt.arch {
+			t.Errorf("splitDebArch(%q) = %q, %q; want %q, %q", tt.pkg, name, arch, tt.name, tt.arch)
+		}
+	}
+}
@@ -0,0 +1,409 @@
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"siem-project/agent/pkg/config"
+	"siem-project/agent/pkg/types"
+)
+
+// USER_HZ: starttime в /proc/<pid>/stat считается в этих тиках
+const procClockTicks = 100
+
+// каталоги, запуск из которых подозрителен (туда может писать любой
+// пользователь) -> значение поля suspicious
+var suspiciousExecDirs = map[string]string{
+	"/tmp/":     "exec_from_tmp",
+	"/var/tmp/": "exec_from_tmp",
+	"/dev/shm/": "exec_from_dev_shm",
+}
+
+func init() {
+	Register(ParserFactory{
+		Type:        "process",
+		Description: "запуск и завершение процессов по снимкам /proc (без auditd)",
+		Options: map[string]OptionSpec{
+			"proc_path":       {Type: OptionString, Description: "каталог proc (/host/proc в контейнере)", Default: "/proc"},
+			"interval":        {Type: OptionDuration, Description: "период снимков /proc", Default: "5s"},
+			"max_events":      {Type: OptionInt, Description: "максимум событий за один снимок; подозрительные процессы отправляются всегда", Default: 200},
+			"report_existing": {Type: OptionBool, Description: "отправить process_started для процессов, запущенных до агента", Default: false},
+			"passwd_path":     {Type: OptionString, Description: "файл для имен пользователей (/host/etc/passwd в контейнере)", Default: defaultPasswdPath},
+			"group_path":      {Type: OptionString, Description: "файл для имен групп (/host/etc/group в контейнере)", Default: defaultGroupPath},
+		},
+		Validate: func(source config.SourceConfig, opts Options) error {
+			if opts.Duration("interval") < time.Second {
+				return fmt.Errorf("interval must be at least 1s")
+			}
+			return nil
+		},
+		NewCollector: func(source config.SourceConfig, opts Options, hostname string) (Collector, error) {
+			return NewProcessCollector(opts.String("proc_path"), opts.Duration("interval"), opts.Int("max_events"), opts.Bool("report_existing"), opts.String("passwd_path"), opts.String("group_path"), hostname), nil
+		},
+	})
+}
+
+// ProcessCollector сравнивает соседние снимки /proc. Процессы, прожившие
+// меньше интервала, не видны; для полного аудита запусков нужен auditd
+type ProcessCollector struct {
+	procPath       string
+	interval       time.Duration
+	maxEvents      int
+	reportExisting bool
+	hostname       string
+	ids            *idResolver
+
+	bootTime  time.Time
+	processes map[int]*procInfo
+
+	events chan *types.Event
+	wg     sync.WaitGroup
+	stopCh chan struct{}
+}
+
+// procInfo - то, что известно о процессе на момент первого снимка
+type procInfo struct {
+	pid       int
+	ppid      int
+	comm      string
+	uid       string
+	euid      string
+	gid       string
+	egid      string
+	exe       string
+	cmdline   string
+	cwd       string
+	startTime time.Time
+	ticks     uint64 // starttime, отличает процесс при повторном использовании pid
+}
+
+func NewProcessCollector(procPath string, interval time.Duration, maxEvents int, reportExisting bool, passwdPath, groupPath, hostname string) *ProcessCollector {
+	if procPath == "" {
+		procPath = "/proc"
+	}
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	if maxEvents <= 0 {
+		maxEvents = 200
+	}
+	if passwdPath == "" {
+		passwdPath = defaultPasswdPath
+	}
+	if groupPath == "" {
+		groupPath = defaultGroupPath
+	}
+
+	return &ProcessCollector{
+		procPath:       procPath,
+		interval:       interval,
+		maxEvents:      maxEvents,
+		reportExisting: reportExisting,
+		hostname:       hostname,
+		ids:            newIDResolver(passwdPath, groupPath),
+		events:         make(chan *types.Event, 100),
+		stopCh:         make(chan struct{}),
+	}
+}
+
+func (c *ProcessCollector) Start() error {
+	bootTime, err := readBootTime(c.procPath)
+	if err != nil {
+		return fmt.Errorf("failed to read boot time from %s: %w", c.procPath, err)
+	}
+	c.bootTime = bootTime
+
+	c.wg.Add(1)
+	go c.pollLoop()
+
+	return nil
+}
+
+func (c *ProcessCollector) Stop() {
+	close(c.stopCh)
+	c.wg.Wait()
+	close(c.events)
+}
+
+func (c *ProcessCollector) Events() <-chan *types.Event {
+	return c.events
+}
+
+func (c *ProcessCollector) pollLoop() {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	c.poll()
+	for {
+		select {
+		case <-ticker.C:
+			c.poll()
+		case <-c.stopCh:
+			return
+		}
+	}
+}
+
+// poll делает снимок и отправляет события о новых и завершившихся процессах.
+// Для уже известных pid читается только stat, поэтому нагрузка зависит
+// от числа новых процессов, а не от общего
+func (c *ProcessCollector) poll() {
+	entries, err := os.ReadDir(c.procPath)
+	if err != nil {
+		log.Printf("Не удалось прочитать %s: %v", c.procPath, err)
+		return
+	}
+
+	first := c.processes == nil
+	current := make(map[int]*procInfo, len(entries))
+	var events []*types.Event
+	dropped := 0
+
+	emit := func(event *types.Event, suspicious bool) {
+		if len(events) >= c.maxEvents && !suspicious {
+			dropped++
+			return
+		}
+		events = append(events, event)
+	}
+
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+
+		ppid, comm, ticks, err := c.readStat(pid)
+		if err != nil {
+			// процесс успел завершиться
+			continue
+		}
+
+		if known, ok := c.processes[pid]; ok && known.ticks == ticks {
+			current[pid] = known
+			continue
+		}
+
+		info := c.readProcess(pid, ppid, comm, ticks)
+		if info == nil {
+			continue
+		}
+		current[pid] = info
+
+		if first && !c.reportExisting {
+			continue
+		}
+		event, suspicious := c.startedEvent(info, current)
+		emit(event, suspicious)
+	}
+
+	for pid, info := range c.processes {
+		if known, ok := current[pid]; ok && known == info {
+			continue
+		}
+		emit(c.exitedEvent(info), false)
+	}
+
+	c.processes = current
+
+	if dropped > 0 {
+		log.Printf("Превышен лимит событий процессов за снимок (%d), пропущено %d", c.maxEvents, dropped)
+	}
+
+	for _, event := range events {
+		select {
+		case c.events <- event:
+		case <-c.stopCh:
+			return
+		}
+	}
+}
+
+// readStat читает ppid, comm и starttime из /proc/<pid>/stat
+func (c *ProcessCollector) readStat(pid int) (int, string, uint64, error) {
+	data, err := os.ReadFile(filepath.Join(c.procPath, strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return 0, "", 0, err
+	}
+
+	// comm в скобках может содержать пробелы и скобки, ищем последнюю ")"
+	start := bytes.IndexByte(data, '(')
+	end := bytes.LastIndexByte(data, ')')
+	if start < 0 || end < start {
+		return 0, "", 0, fmt.Errorf("invalid stat format")
+	}
+	comm := string(data[start+1 : end])
+
+	// после comm: state ppid ... starttime (22-е поле всей строки)
+	fields := strings.Fields(string(data[end+1:]))
+	if len(fields) < 20 {
+		return 0, "", 0, fmt.Errorf("invalid stat format")
+	}
+	if fields[0] == "Z" {
+		// зомби уже завершился, осталась только запись для родителя
+		return 0, "", 0, fmt.Errorf("process is a zombie")
+	}
+	ppid, _ := strconv.Atoi(fields[1])
+	ticks, _ := strconv.ParseUint(fields[19], 10, 64)
+
+	return ppid, comm, ticks, nil
+}
+
+// readProcess собирает сведения о новом процессе; потоки ядра пропускаются
+func (c *ProcessCollector) readProcess(pid, ppid int, comm string, ticks uint64) *procInfo {
+	dir := filepath.Join(c.procPath, strconv.Itoa(pid))
+
+	cmdline, _ := os.ReadFile(filepath.Join(dir, "cmdline"))
+	if len(cmdline) == 0 && (pid == 2 || ppid == 2) {
+		return nil
+	}
+
+	info := &procInfo{
+		pid:       pid,
+		ppid:      ppid,
+		comm:      comm,
+		ticks:     ticks,
+		cmdline:   strings.TrimSpace(string(bytes.ReplaceAll(cmdline, []byte{0}, []byte{' '}))),
+		startTime: c.bootTime.Add(time.Duration(ticks) * time.Second / procClockTicks),
+	}
+	info.exe, _ = os.Readlink(filepath.Join(dir, "exe"))
+	info.cwd, _ = os.Readlink(filepath.Join(dir, "cwd"))
+	info.uid, info.euid, info.gid, info.egid = readProcIDs(filepath.Join(dir, "status"))
+
+	return info
+}
+
+func (c *ProcessCollector) startedEvent(info *procInfo, current map[int]*procInfo) (*types.Event, bool) {
+	event := c.newEvent(info, "process_started", "low")
+	event.SetTimestamp(info.startTime)
+
+	if parent, ok := current[info.ppid]; ok {
+		event.SetField("parent_process", parent.comm)
+		event.SetField("parent_exe", parent.exe)
+	}
+
+	reason := suspiciousExecReason(info.exe)
+	if reason != "" {
+		event.Severity = "high"
+		event.SetField("suspicious", reason)
+	}
+	return event, reason != ""
+}
+
+func (c *ProcessCollector) exitedEvent(info *procInfo) *types.Event {
+	event := c.newEvent(info, "process_exited", "low")
+	// точное время завершения неизвестно, только то, что процесса нет в снимке
+	event.SetField("lifetime", strconv.FormatInt(int64(time.Since(info.startTime).Seconds()), 10))
+	return event
+}
+
+func (c *ProcessCollector) newEvent(info *procInfo, eventType, severity string) *types.Event {
+	command := info.cmdline
+	if command == "" {
+		command = info.comm
+	}
+
+	raw := fmt.Sprintf("pid=%d ppid=%d uid=%s exe=%s cmdline=%s", info.pid, info.ppid, info.uid, info.exe, command)
+	event := types.NewEvent("process", eventType, severity, raw)
+	event.SetHostname(c.hostname)
+	event.Process = fmt.Sprintf("%s[%d]", info.comm, info.pid)
+	event.Command = command
+	if info.uid != "" {
+		event.User = c.ids.UserName(info.uid)
+	}
+
+	event.SetField("pid", strconv.Itoa(info.pid))
+	event.SetField("ppid", strconv.Itoa(info.ppid))
+	event.SetField("uid", info.uid)
+	if info.euid != info.uid {
+		event.SetField("euid", info.euid)
+		event.SetField("euid_name", c.ids.UserName(info.euid))
+	}
+	if info.gid != "" {
+		event.SetField("gid", info.gid)
+		event.SetField("gid_name", c.ids.GroupName(info.gid))
+	}
+	if info.egid != info.gid {
+		event.SetField("egid", info.egid)
+		event.SetField("egid_name", c.ids.GroupName(info.egid))
+	}
+	event.SetField("exe", info.exe)
+	event.SetField("cwd", info.cwd)
+	event.SetField("start_time", info.startTime.UTC().Format(time.RFC3339))
+	return event
+}
+
+// suspiciousExecReason проверяет, откуда запущен бинарник
+func suspiciousExecReason(exe string) string {
+	var reasons []string
+	if strings.HasSuffix(exe, " (deleted)") {
+		reasons = append(reasons, "deleted_binary")
+	}
+	for dir, reason := range suspiciousExecDirs {
+		if strings.HasPrefix(exe, dir) {
+			reasons = append(reasons, reason)
+		}
+	}
+	return strings.Join(reasons, ",")
+}
+
+// readProcIDs возвращает реальные и эффективные uid и gid из /proc/<pid>/status
+func readProcIDs(path string) (uid, euid, gid, egid string) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", "", "", ""
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		key, value, ok := strings.Cut(line, ":")
+		if !ok || (key != "Uid" && key != "Gid") {
+			continue
+		}
+		// реальный, эффективный, сохраненный, файловый
+		fields := strings.Fields(value)
+		if len(fields) < 2 {
+			continue
+		}
+		if key == "Uid" {
+			uid, euid = fields[0], fields[1]
+		} else {
+			gid, egid = fields[0], fields[1]
+		}
+	}
+	return uid, euid, gid, egid
+}
+
+// readBootTime читает время загрузки (btime) из /proc/stat
+func readBootTime(procPath string) (time.Time, error) {
+	file, err := os.Open(filepath.Join(procPath, "stat"))
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == "btime" {
+			sec, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return time.Time{}, err
+			}
+			return time.Unix(sec, 0), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("btime not found")
+}
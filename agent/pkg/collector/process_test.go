@@ -0,0 +1,37 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProcessEventGroupNames(t *testing.T) {
+	dir := t.TempDir()
+	passwd := filepath.Join(dir, "passwd")
+	group := filepath.Join(dir, "group")
+	status := filepath.Join(dir, "status")
+	os.WriteFile(passwd, []byte("root:x:0:0::/root:/bin/sh\nalice:x:1000:1000::/home/alice:/bin/sh\n"), 0644)
+	os.WriteFile(group, []byte("root:x:0:\nshadow:x:42:\nalice:x:1000:\n"), 0644)
+	// setgid-бинарник: эффективная группа отличается от реальной
+	os.WriteFile(status, []byte("Name:\tchage\nUid:\t1000\t1000\t1000\t1000\nGid:\t1000\t42\t42\t42\nGroups:\t1000\n"), 0644)
+
+	uid, euid, gid, egid := readProcIDs(status)
+	if uid != "1000" || euid != "1000" || gid != "1000" || egid != "42" {
+		t.Fatalf("readProcIDs() = %s, %s, %s, %s", uid, euid, gid, egid)
+	}
+
+	c := NewProcessCollector(dir, 0, 0, false, passwd, group, "web01")
+	info := &procInfo{pid: 10, ppid: 1, comm: "chage", uid: uid, euid: euid, gid: gid, egid: egid, exe: "/usr/bin/chage"}
+	event := c.newEvent(info, "process_started", "low")
+
+	want := map[string]string{"gid": "1000", "gid_name": "alice", "egid": "42", "egid_name": "shadow"}
+	for key, value := range want {
+		if event.Fields[key] != value {
+			t.Errorf("%s = %q, want %q", key, event.Fields[key], value)
+		}
+	}
+	if _, ok := event.Fields["euid"]; ok {
+		t.Errorf("euid set although it equals uid")
+	}
+}
@@ -0,0 +1,292 @@
+package collector
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"siem-project/agent/pkg/config"
+)
+
+// типы значений в схеме опций
+const (
+	OptionString   = "string"
+	OptionInt      = "int"
+	OptionBool     = "bool"
+	OptionDuration = "duration" // "2s" или число секунд
+	OptionList     = "list"
+	OptionMap      = "map"
+)
+
+// OptionSpec описывает одну опцию парсера в sources[].options
+type OptionSpec struct {
+	Type        string
+	Description string
+	Required    bool
+	Default     interface{}
+}
+
+// ParserFactory регистрируется каждым парсером. Файловые парсеры задают
+// NewParser и читаются через LogCollector, источники со своим способом
+// получения событий (сеть, несколько файлов) задают NewCollector
+type ParserFactory struct {
+	Type         string
+	Description  string
+	Options      map[string]OptionSpec
+	Validate     func(source config.SourceConfig, opts Options) error
+	NewParser    func(source config.SourceConfig, opts Options) (LogParser, error)
+	NewCollector func(source config.SourceConfig, opts Options, hostname string) (Collector, error)
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]ParserFactory)
+)
+
+// Register добавляет тип источника. Сторонние парсеры вызывают его из init()
+// своего пакета, который подключается в main через blank import
+func Register(factory ParserFactory) {
+	if factory.Type == "" {
+		panic("collector: parser type is required")
+	}
+	if factory.NewParser == nil && factory.NewCollector == nil {
+		panic(fmt.Sprintf("collector: parser %s has no constructor", factory.Type))
+	}
+
+	registryMu.Lock()
+	if _, exists := registry[factory.Type]; exists {
+		registryMu.Unlock()
+		panic(fmt.Sprintf("collector: parser %s registered twice", factory.Type))
+	}
+	registry[factory.Type] = factory
+	registryMu.Unlock()
+
+	config.RegisterSourceType(factory.Type, func(source config.SourceConfig) error {
+		_, err := factory.options(source)
+		return err
+	})
+}
+
+// Lookup возвращает фабрику по типу источника
+func Lookup(sourceType string) (ParserFactory, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	factory, ok := registry[sourceType]
+	return factory, ok
+}
+
+// Factories возвращает все зарегистрированные фабрики, отсортированные по типу
+func Factories() []ParserFactory {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	factories := make([]ParserFactory, 0, len(registry))
+	for _, factory := range registry {
+		factories = append(factories, factory)
+	}
+	sort.Slice(factories, func(i, j int) bool {
+		return factories[i].Type < factories[j].Type
+	})
+	return factories
+}
+
+// NewSourceCollector создает коллектор для источника из конфига
+func NewSourceCollector(source config.SourceConfig, hostname string) (Collector, error) {
+	factory, ok := Lookup(source.Type)
+	if !ok {
+		return nil, fmt.Errorf("unknown source type %q", source.Type)
+	}
+
+	opts, err := factory.options(source)
+	if err != nil {
+		return nil, err
+	}
+
+	if factory.NewCollector != nil {
+		return factory.NewCollector(source, opts, hostname)
+	}
+
+	parser, err := factory.NewParser(source, opts)
+	if err != nil {
+		return nil, err
+	}
+	return NewCollector(source, parser, hostname)
+}
+
+// options проверяет опции источника по схеме и дополняет значениями по умолчанию
+func (f ParserFactory) options(source config.SourceConfig) (Options, error) {
+	if f.NewCollector == nil && source.Path == "" {
+		return nil, fmt.Errorf("path is required")
+	}
+
+	opts := make(Options)
+	for name, spec := range f.Options {
+		if spec.Default != nil {
+			opts[name] = spec.Default
+		}
+	}
+
+	for name, value := range source.Options {
+		spec, ok := f.Options[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown option %q, valid options: %s", name, strings.Join(f.optionNames(), ", "))
+		}
+		if err := checkOptionType(spec.Type, value); err != nil {
+			return nil, fmt.Errorf("option %s: %w", name, err)
+		}
+		opts[name] = normalizeOption(value)
+	}
+
+	for name, spec := range f.Options {
+		if _, ok := opts[name]; spec.Required && !ok {
+			return nil, fmt.Errorf("option %s is required", name)
+		}
+	}
+
+	if f.Validate != nil {
+		if err := f.Validate(source, opts); err != nil {
+			return nil, err
+		}
+	}
+	return opts, nil
+}
+
+func (f ParserFactory) optionNames() []string {
+	names := make([]string, 0, len(f.Options))
+	for name := range f.Options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func checkOptionType(optionType string, value interface{}) error {
+	switch optionType {
+	case OptionString:
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("expected string")
+		}
+	case OptionInt:
+		if _, ok := value.(int); !ok {
+			return fmt.Errorf("expected integer")
+		}
+	case OptionBool:
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("expected true/false")
+		}
+	case OptionDuration:
+		if _, err := toDuration(value); err != nil {
+			return err
+		}
+	case OptionList:
+		if _, ok := value.([]interface{}); !ok {
+			return fmt.Errorf("expected list")
+		}
+	case OptionMap:
+		if _, ok := value.(map[interface{}]interface{}); !ok {
+			if _, ok := value.(map[string]interface{}); !ok {
+				return fmt.Errorf("expected map")
+			}
+		}
+	}
+	return nil
+}
+
+// normalizeOption приводит вложенные map из yaml.v2 (map[interface{}]interface{})
+// к map[string]interface{}
+func normalizeOption(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, val := range v {
+			m[fmt.Sprint(key)] = normalizeOption(val)
+		}
+		return m
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, val := range v {
+			list[i] = normalizeOption(val)
+		}
+		return list
+	default:
+		return value
+	}
+}
+
+func toDuration(value interface{}) (time.Duration, error) {
+	switch v := value.(type) {
+	case int:
+		return time.Duration(v) * time.Second, nil
+	case float64:
+		return time.Duration(v * float64(time.Second)), nil
+	case string:
+		if d, err := time.ParseDuration(v); err == nil {
+			return d, nil
+		}
+		if sec, err := strconv.Atoi(v); err == nil {
+			return time.Duration(sec) * time.Second, nil
+		}
+	}
+	return 0, fmt.Errorf("expected duration like \"5s\" or number of seconds")
+}
+
+// Options - проверенные опции источника со значениями по умолчанию
+type Options map[string]interface{}
+
+func (o Options) String(name string) string {
+	if v, ok := o[name].(string); ok {
+		return v
+	}
+	return ""
+}
+
+func (o Options) Int(name string) int {
+	if v, ok := o[name].(int); ok {
+		return v
+	}
+	return 0
+}
+
+func (o Options) Bool(name string) bool {
+	if v, ok := o[name].(bool); ok {
+		return v
+	}
+	return false
+}
+
+func (o Options) Duration(name string) time.Duration {
+	d, _ := toDuration(o[name])
+	return d
+}
+
+func (o Options) Strings(name string) []string {
+	switch v := o[name].(type) {
+	case []string:
+		return v
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			list = append(list, fmt.Sprint(item))
+		}
+		return list
+	}
+	return nil
+}
+
+// StringMap возвращает опцию-словарь со строковыми значениями
+func (o Options) StringMap(name string) map[string]string {
+	switch v := o[name].(type) {
+	case map[string]string:
+		return v
+	case map[string]interface{}:
+		m := make(map[string]string, len(v))
+		for key, val := range v {
+			m[key] = fmt.Sprint(val)
+		}
+		return m
+	}
+	return nil
+}
@@ -4,25 +4,78 @@ package collector
 import (
 	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
+	"siem-project/agent/pkg/config"
 	"siem-project/agent/pkg/types"
 )
 
+func init() {
+	for _, sourceType := range []string{"syslog", "auth"} {
+		sourceType := sourceType
+		Register(ParserFactory{
+			Type:        sourceType,
+			Description: "syslog/auth.log (RFC3164, RFC5424, rsyslog ISO8601)",
+			Options: map[string]OptionSpec{
+				"timezone": {Type: OptionString, Description: "зона для времени без смещения (по умолчанию локальная)"},
+			},
+			NewParser: func(source config.SourceConfig, opts Options) (LogParser, error) {
+				return newSyslogParserWithOptions(sourceType, opts)
+			},
+		})
+	}
+}
+
 // SyslogParser парсит /var/log/syslog и /var/log/auth.log
 type SyslogParser struct {
-	sourceType string
-	lineRegex  *regexp.Regexp
-	sudoRegex  *regexp.Regexp
+	sourceType   string
+	location     *time.Location
+	priRegex     *regexp.Regexp
+	lineRegex    *regexp.Regexp
+	rfc5424Regex *regexp.Regexp
+	sdRegex      *regexp.Regexp
+	sdParamRegex *regexp.Regexp
+	sudoRegex    *regexp.Regexp
+	auth         *authExtractor
+	firewall     *firewallExtractor
+	cron         *cronExtractor
 }
 
 func NewSyslogParser(sourceType string) *SyslogParser {
 	return &SyslogParser{
 		sourceType: sourceType,
-		lineRegex: regexp.MustCompile(`^(\S+)\s+(\S+)\s+([^:\[\s]+)(?:\[(\d+)\])?\s*:\s*(.+)$`),
+		// классический формат без зоны пишется в локальном времени хоста
+		location: time.Local,
+		// <PRI> в начале сетевых сообщений
+		priRegex: regexp.MustCompile(`^<(\d{1,3})>`),
+		// RFC3164 (Mmm dd HH:MM:SS) или rsyslog с одним токеном времени;
+		// (?s) - сообщение может быть многострочным (multiline в источнике)
+		lineRegex: regexp.MustCompile(`(?s)^([A-Z][a-z]{2}\s+\d{1,2}\s+\d{2}:\d{2}:\d{2}|\S+)\s+(\S+)\s+([^:\[\s]+)(?:\[(\d+)\])?\s*:\s*(.+)$`),
+		// RFC5424: VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID SD MSG
+		rfc5424Regex: regexp.MustCompile(`(?s)^1\s+(\S+)\s+(\S+)\s+(\S+)\s+(\S+)\s+(\S+)\s+(-|(?:\[(?:[^\]\\"]|\\.|"(?:[^"\\]|\\.)*")*\])+)(?:\s+(.*))?$`),
+		// [exampleSDID@32473 iut="3" eventSource="Application"]
+		sdRegex:      regexp.MustCompile(`\[([^\s\]=]+)((?:\s+[^\s=\]]+="(?:[^"\\]|\\.)*")*)\s*\]`),
+		sdParamRegex: regexp.MustCompile(`([^\s=\]]+)="((?:[^"\\]|\\.)*)"`),
 		// Для sudo логов: parallels : TTY=pts/0 ; PWD=/home/parallels ; USER=root ; COMMAND=/usr/bin/tail
 		sudoRegex: regexp.MustCompile(`(\w+)\s*:.*USER=(\w+)\s*;\s*COMMAND=(.+)$`),
+		auth:      newAuthExtractor(),
+		firewall:  newFirewallExtractor(),
+		cron:      newCronExtractor(),
+	}
+}
+
+func newSyslogParserWithOptions(sourceType string, opts Options) (*SyslogParser, error) {
+	parser := NewSyslogParser(sourceType)
+	if tz := opts.String("timezone"); tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timezone: %w", err)
+		}
+		parser.location = loc
 	}
+	return parser, nil
 }
 
 func (p *SyslogParser) GetSourceType() string {
@@ -35,23 +88,62 @@ func (p *SyslogParser) Parse(line string, hostname string) (*types.Event, error)
 		return nil, fmt.Errorf("empty line")
 	}
 
-	matches := p.lineRegex.FindStringSubmatch(line)
-	if len(matches) < 6 {
-		return nil, fmt.Errorf("failed to parse syslog line")
+	pri := -1
+	body := line
+	if m := p.priRegex.FindStringSubmatch(line); m != nil {
+		pri, _ = strconv.Atoi(m[1])
+		body = strings.TrimSpace(line[len(m[0]):])
 	}
 
-	process := matches[3]
-	pid := matches[4]
-	message := matches[5]
+	var timestamp, logHost, process, pid, message string
+	var structured map[string]string
+	if matches := p.rfc5424Regex.FindStringSubmatch(body); matches != nil {
+		timestamp = nilValue(matches[1])
+		logHost = nilValue(matches[2])
+		process = nilValue(matches[3])
+		pid = nilValue(matches[4])
+		structured = p.parseStructuredData(matches[6])
+		if msgID := nilValue(matches[5]); msgID != "" {
+			structured["msgid"] = msgID
+		}
+		message = strings.TrimPrefix(matches[7], "\ufeff")
+		if process == "" {
+			process = "-"
+		}
+	} else {
+		matches := p.lineRegex.FindStringSubmatch(body)
+		if len(matches) < 6 {
+			return nil, fmt.Errorf("failed to parse syslog line")
+		}
+		timestamp = matches[1]
+		logHost = matches[2]
+		process = matches[3]
+		pid = matches[4]
+		message = matches[5]
+	}
 
 	event := types.NewEvent(p.sourceType, "system_event", "low", line)
 	event.SetHostname(hostname)
+	if ts, ok := parseSyslogTimestamp(timestamp, time.Now(), p.location); ok {
+		event.SetTimestamp(ts)
+	}
+	event.SetField("log_hostname", logHost)
+	if pri >= 0 && pri <= 191 {
+		event.SetField("facility", strconv.Itoa(pri/8))
+		event.SetField("syslog_severity", strconv.Itoa(pri%8))
+	}
+	for k, v := range structured {
+		event.SetField(k, v)
+	}
 	event.Process = process
 	if pid != "" {
 		event.Process = fmt.Sprintf("%s[%s]", process, pid)
 	}
 
 	p.classifyEvent(event, process, message)
+	p.auth.extract(event, process, message)
+	p.firewall.extract(event, process, message)
+	p.cron.extract(event, process, message)
 
 	if process == "sudo" && strings.Contains(message, "COMMAND=") {
 		p.parseSudoLog(event, message)
@@ -111,6 +203,30 @@ func (p *SyslogParser) parseSudoLog(event *types.Event, message string) {
 	}
 }
 
+// parseStructuredData разбирает SD из RFC5424 в поля вида sd.<id>.<param>
+func (p *SyslogParser) parseStructuredData(sd string) map[string]string {
+	fields := make(map[string]string)
+	if sd == "-" {
+		return fields
+	}
+
+	for _, elem := range p.sdRegex.FindAllStringSubmatch(sd, -1) {
+		for _, param := range p.sdParamRegex.FindAllStringSubmatch(elem[2], -1) {
+			value := strings.NewReplacer(`\"`, `"`, `\\`, `\`, `\]`, `]`).Replace(param[2])
+			fields["sd."+elem[1]+"."+param[1]] = value
+		}
+	}
+	return fields
+}
+
+// "-" в RFC5424 означает отсутствующее значение
+func nilValue(v string) string {
+	if v == "-" {
+		return ""
+	}
+	return v
+}
+
 func containsDangerousCommand(message string) bool {
 	dangerous := []string{
 		"rm -rf",
@@ -0,0 +1,292 @@
+package collector
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"siem-project/agent/pkg/config"
+	"siem-project/agent/pkg/types"
+)
+
+// максимальный размер одного syslog сообщения
+const maxSyslogMessageSize = 64 * 1024
+
+func init() {
+	Register(ParserFactory{
+		Type:        "syslog_listener",
+		Description: "прием syslog по сети (udp, tcp, tls)",
+		Validate: func(source config.SourceConfig, opts Options) error {
+			if source.Listen == "" {
+				return fmt.Errorf("listen is required")
+			}
+			switch source.Protocol {
+			case "", "udp", "tcp":
+			case "tls":
+				if source.TLSCert == "" || source.TLSKey == "" {
+					return fmt.Errorf("tls_cert and tls_key are required for tls protocol")
+				}
+			default:
+				return fmt.Errorf("protocol must be udp, tcp or tls")
+			}
+			return nil
+		},
+		NewCollector: func(source config.SourceConfig, opts Options, hostname string) (Collector, error) {
+			return NewSyslogListener(source, NewSyslogParser("syslog_listener"), hostname)
+		},
+	})
+}
+
+// SyslogListener принимает syslog по сети (UDP, TCP, TLS по RFC5425),
+// чтобы агент мог работать ретранслятором для сетевых устройств
+type SyslogListener struct {
+	source   config.SourceConfig
+	parser   LogParser
+	hostname string
+
+	packetConn net.PacketConn
+	listener   net.Listener
+	conns      map[net.Conn]struct{}
+
+	events chan *types.Event
+	mu     sync.Mutex
+	wg     sync.WaitGroup
+	stopCh chan struct{}
+}
+
+func NewSyslogListener(source config.SourceConfig, parser LogParser, hostname string) (*SyslogListener, error) {
+	if source.Listen == "" {
+		return nil, fmt.Errorf("listen address is required")
+	}
+
+	return &SyslogListener{
+		source:   source,
+		parser:   parser,
+		hostname: hostname,
+		conns:    make(map[net.Conn]struct{}),
+		events:   make(chan *types.Event, 100),
+		stopCh:   make(chan struct{}),
+	}, nil
+}
+
+func (l *SyslogListener) Start() error {
+	switch l.source.Protocol {
+	case "", "udp":
+		conn, err := net.ListenPacket("udp", l.source.Listen)
+		if err != nil {
+			return fmt.Errorf("failed to listen udp %s: %w", l.source.Listen, err)
+		}
+		l.packetConn = conn
+		l.wg.Add(1)
+		go l.serveUDP()
+
+	case "tcp", "tls":
+		ln, err := net.Listen("tcp", l.source.Listen)
+		if err != nil {
+			return fmt.Errorf("failed to listen tcp %s: %w", l.source.Listen, err)
+		}
+		if l.source.Protocol == "tls" {
+			cert, err := tls.LoadX509KeyPair(l.source.TLSCert, l.source.TLSKey)
+			if err != nil {
+				ln.Close()
+				return fmt.Errorf("failed to load tls certificate: %w", err)
+			}
+			ln = tls.NewListener(ln, &tls.Config{
+				Certificates: []tls.Certificate{cert},
+				MinVersion:   tls.VersionTLS12,
+			})
+		}
+		l.listener = ln
+		l.wg.Add(1)
+		go l.serveTCP()
+
+	default:
+		return fmt.Errorf("unsupported protocol: %s", l.source.Protocol)
+	}
+
+	return nil
+}
+
+func (l *SyslogListener) Stop() {
+	close(l.stopCh)
+
+	l.mu.Lock()
+	if l.packetConn != nil {
+		l.packetConn.Close()
+	}
+	if l.listener != nil {
+		l.listener.Close()
+	}
+	for conn := range l.conns {
+		conn.Close()
+	}
+	l.mu.Unlock()
+
+	l.wg.Wait()
+	close(l.events)
+}
+
+func (l *SyslogListener) Events() <-chan *types.Event {
+	return l.events
+}
+
+func (l *SyslogListener) serveUDP() {
+	defer l.wg.Done()
+
+	buf := make([]byte, maxSyslogMessageSize)
+	for {
+		n, addr, err := l.packetConn.ReadFrom(buf)
+		if err != nil {
+			select {
+			case <-l.stopCh:
+				return
+			default:
+			}
+			log.Printf("Ошибка чтения syslog (udp): %v", err)
+			continue
+		}
+
+		// в одном датаграмме может быть несколько строк
+		for _, msg := range strings.Split(string(buf[:n]), "\n") {
+			l.handleMessage(msg, addr)
+		}
+	}
+}
+
+func (l *SyslogListener) serveTCP() {
+	defer l.wg.Done()
+
+	for {
+		conn, err := l.listener.Accept()
+		if err != nil {
+			select {
+			case <-l.stopCh:
+				return
+			default:
+			}
+			log.Printf("Ошибка приема соединения syslog: %v", err)
+			continue
+		}
+
+		l.mu.Lock()
+		select {
+		case <-l.stopCh:
+			l.mu.Unlock()
+			conn.Close()
+			return
+		default:
+		}
+		l.conns[conn] = struct{}{}
+		l.mu.Unlock()
+
+		l.wg.Add(1)
+		go l.handleConn(conn)
+	}
+}
+
+// читает поток сообщений, поддерживает octet-counting (RFC6587/RFC5425)
+// и разделение по переводу строки
+func (l *SyslogListener) handleConn(conn net.Conn) {
+	defer l.wg.Done()
+	defer func() {
+		l.mu.Lock()
+		delete(l.conns, conn)
+		l.mu.Unlock()
+		conn.Close()
+	}()
+
+	reader := bufio.NewReaderSize(conn, maxSyslogMessageSize)
+	for {
+		msg, err := readFramedMessage(reader)
+		if msg != "" {
+			l.handleMessage(msg, conn.RemoteAddr())
+		}
+		if err != nil {
+			if err != io.EOF {
+				select {
+				case <-l.stopCh:
+				default:
+					log.Printf("Ошибка чтения syslog от %s: %v", conn.RemoteAddr(), err)
+				}
+			}
+			return
+		}
+	}
+}
+
+// readFramedMessage читает одно сообщение: если кадр начинается с числа
+// и пробела ("LEN SP MSG") и длина в пределах maxSyslogMessageSize, это
+// octet-counting, иначе сообщение до '\n' (в том числе строки без PRI,
+// начинающиеся с даты)
+func readFramedMessage(r *bufio.Reader) (string, error) {
+	if size, n := peekOctetCount(r); size > 0 {
+		r.Discard(n)
+		data := make([]byte, size)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}
+
+	line, err := r.ReadString('\n')
+	return strings.TrimRight(line, "\r\n\x00"), err
+}
+
+// максимальное число цифр в длине кадра
+var maxOctetCountDigits = len(strconv.Itoa(maxSyslogMessageSize))
+
+// peekOctetCount смотрит начало кадра, не сдвигая reader. Возвращает длину
+// сообщения и размер префикса "LEN SP" или 0, если префикса нет. Байты
+// читаются по одному: Peek не ждет данных за пределами текущего кадра
+func peekOctetCount(r *bufio.Reader) (int, int) {
+	for n := 0; n <= maxOctetCountDigits; n++ {
+		buf, err := r.Peek(n + 1)
+		if err != nil {
+			return 0, 0
+		}
+		c := buf[n]
+		if c >= '0' && c <= '9' {
+			continue
+		}
+		if c != ' ' || n == 0 {
+			return 0, 0
+		}
+		size, err := strconv.Atoi(string(buf[:n]))
+		if err != nil || size <= 0 || size > maxSyslogMessageSize {
+			return 0, 0
+		}
+		return size, n + 1
+	}
+	return 0, 0
+}
+
+func (l *SyslogListener) handleMessage(msg string, addr net.Addr) {
+	msg = strings.TrimSpace(msg)
+	if msg == "" {
+		return
+	}
+
+	event, err := l.parser.Parse(msg, l.hostname)
+	if err != nil || event == nil {
+		return
+	}
+
+	if addr != nil {
+		host, _, err := net.SplitHostPort(addr.String())
+		if err != nil {
+			host = addr.String()
+		}
+		event.SetField("sender_addr", host)
+	}
+
+	select {
+	case l.events <- event:
+	case <-l.stopCh:
+	}
+}
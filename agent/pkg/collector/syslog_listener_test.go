@@ -0,0 +1,86 @@
+package collector
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReadFramedMessage(t *testing.T) {
+	tests := []struct {
+		name   string
+		stream string
+		want   []string
+	}{
+		{
+			name:   "octet counting",
+			stream: "34 <34>1 2024-01-15T10:00:00Z h app -15 <13>hello world",
+			want:   []string{"<34>1 2024-01-15T10:00:00Z h app -", "<13>hello world"},
+		},
+		{
+			name:   "octet counting with newline inside message",
+			stream: "9 line1\nl2\n",
+			want:   []string{"line1\nl2\n"},
+		},
+		{
+			name:   "newline framing with pri",
+			stream: "<13>Jan 15 10:00:00 host app: one\n<13>Jan 15 10:00:01 host app: two\r\n",
+			want:   []string{"<13>Jan 15 10:00:00 host app: one", "<13>Jan 15 10:00:01 host app: two"},
+		},
+		{
+			name:   "newline framing without pri starting with a date",
+			stream: "2024-01-15T10:00:00 host app: msg\n2024-01-15T10:00:01 host app: next\n",
+			want:   []string{"2024-01-15T10:00:00 host app: msg", "2024-01-15T10:00:01 host app: next"},
+		},
+		{
+			name:   "digits without space",
+			stream: "12345\n",
+			want:   []string{"12345"},
+		},
+		{
+			name:   "length above the limit",
+			stream: "9999999 not a length\n",
+			want:   []string{"9999999 not a length"},
+		},
+		{
+			name:   "mixed framing",
+			stream: "5 first2024-01-15 second\n5 third",
+			want:   []string{"first", "2024-01-15 second", "third"},
+		},
+		{
+			name:   "last line without newline",
+			stream: "1700000000 tail",
+			want:   []string{"1700000000 tail"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bufio.NewReader(strings.NewReader(tt.stream))
+			var got []string
+			for {
+				msg, err := readFramedMessage(r)
+				if msg != "" {
+					got = append(got, msg)
+				}
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("readFramedMessage() error = %v, messages %q", err, got)
+				}
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") || len(got) != len(tt.want) {
+				t.Errorf("messages = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadFramedMessageTruncatedFrame(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("20 short"))
+	if _, err := readFramedMessage(r); err == nil {
+		t.Error("truncated octet-counted frame read without error")
+	}
+}
@@ -0,0 +1,55 @@
+package collector
+
+import (
+	"strings"
+	"time"
+)
+
+// форматы времени с зоной: RFC3339/RFC5424 и высокоточный формат rsyslog
+var zonedTimestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999Z0700",
+}
+
+// форматы без зоны, интерпретируются в локальном времени хоста
+var localTimestampLayouts = []string{
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05", // dpkg.log, apt history.log
+	"Jan 2 15:04:05",
+	"Jan 2 15:04:05.999999999",
+}
+
+// parseSyslogTimestamp разбирает время из строки лога. Для классического
+// формата без года год берется текущий, а если время уходит в будущее
+// больше чем на сутки (декабрьские записи, прочитанные в январе) - прошлый
+func parseSyslogTimestamp(value string, now time.Time, loc *time.Location) (time.Time, bool) {
+	value = strings.Join(strings.Fields(value), " ")
+	if value == "" {
+		return time.Time{}, false
+	}
+	if loc == nil {
+		loc = time.Local
+	}
+
+	for _, layout := range zonedTimestampLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+
+	for _, layout := range localTimestampLayouts {
+		t, err := time.ParseInLocation(layout, value, loc)
+		if err != nil {
+			continue
+		}
+		if t.Year() == 0 {
+			t = time.Date(now.In(loc).Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
+			if t.After(now.Add(24 * time.Hour)) {
+				t = t.AddDate(-1, 0, 0)
+			}
+		}
+		return t, true
+	}
+
+	return time.Time{}, false
+}
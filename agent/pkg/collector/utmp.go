@@ -0,0 +1,513 @@
+package collector
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"siem-project/agent/pkg/config"
+	"siem-project/agent/pkg/types"
+)
+
+// размеры записей glibc на 64-битном Linux (struct utmp и struct lastlog)
+const (
+	utmpRecordSize    = 384
+	lastlogRecordSize = 292
+)
+
+// ut_type
+const (
+	utmpRunLevel    = 1
+	utmpBootTime    = 2
+	utmpUserProcess = 7
+	utmpDeadProcess = 8
+)
+
+var utmpTypeNames = map[int16]string{
+	0: "EMPTY",
+	1: "RUN_LVL",
+	2: "BOOT_TIME",
+	3: "NEW_TIME",
+	4: "OLD_TIME",
+	5: "INIT_PROCESS",
+	6: "LOGIN_PROCESS",
+	7: "USER_PROCESS",
+	8: "DEAD_PROCESS",
+	9: "ACCOUNTING",
+}
+
+func init() {
+	Register(ParserFactory{
+		Type:        "utmp",
+		Description: "бинарные wtmp/btmp/lastlog: входы, выходы, неудачные входы, загрузки",
+		Options: map[string]OptionSpec{
+			"format":        {Type: OptionString, Description: "wtmp, btmp или lastlog (по умолчанию по имени файла)"},
+			"poll_interval": {Type: OptionDuration, Description: "как часто проверять файл", Default: "5s"},
+			"passwd_path":   {Type: OptionString, Description: "файл для имен пользователей lastlog", Default: defaultPasswdPath},
+		},
+		Validate: func(source config.SourceConfig, opts Options) error {
+			if source.Path == "" {
+				return fmt.Errorf("path is required")
+			}
+			switch opts.String("format") {
+			case "", "wtmp", "btmp", "lastlog":
+				return nil
+			default:
+				return fmt.Errorf("format must be wtmp, btmp or lastlog")
+			}
+		},
+		NewCollector: func(source config.SourceConfig, opts Options, hostname string) (Collector, error) {
+			return NewUtmpCollector(source, opts.String("format"), opts.Duration("poll_interval"), opts.String("passwd_path"), hostname)
+		},
+	})
+}
+
+// UtmpCollector читает бинарные журналы входов. Текстовые логи можно
+// почистить, а wtmp/btmp обычно остаются. Смещение хранится в записях
+type UtmpCollector struct {
+	source     config.SourceConfig
+	format     string
+	hostname   string
+	interval   time.Duration
+	passwdPath string
+	offsetFile string
+
+	offset   int64  // номер следующей записи
+	inode    uint64 // для обнаружения ротации
+	sessions map[string]utmpSession
+	lastlog  map[string]utmpRecord // uid -> последний вход
+
+	events chan *types.Event
+	wg     sync.WaitGroup
+	stopCh chan struct{}
+}
+
+// открытая сессия из wtmp, нужна для пользователя и длительности при выходе
+type utmpSession struct {
+	user  string
+	host  string
+	login time.Time
+}
+
+type utmpRecord struct {
+	Type    int16
+	PID     int32
+	Line    string
+	User    string
+	Host    string
+	Session int32
+	Time    time.Time
+	Addr    net.IP
+}
+
+func NewUtmpCollector(source config.SourceConfig, format string, interval time.Duration, passwdPath, hostname string) (*UtmpCollector, error) {
+	if format == "" {
+		format = utmpFormat(source.Path)
+	}
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	if passwdPath == "" {
+		passwdPath = defaultPasswdPath
+	}
+
+	offsetKey := "utmp_" + strings.ReplaceAll(strings.Trim(source.Path, "/"), "/", "_")
+	os.MkdirAll(".offsets", 0755)
+
+	return &UtmpCollector{
+		source:     source,
+		format:     format,
+		hostname:   hostname,
+		interval:   interval,
+		passwdPath: passwdPath,
+		offsetFile: filepath.Join(".offsets", offsetKey+".offset"),
+		sessions:   make(map[string]utmpSession),
+		events:     make(chan *types.Event, 100),
+		stopCh:     make(chan struct{}),
+	}, nil
+}
+
+// utmpFormat определяет формат по имени файла (btmp.1, lastlog, wtmp)
+func utmpFormat(path string) string {
+	name := filepath.Base(path)
+	switch {
+	case strings.HasPrefix(name, "btmp"):
+		return "btmp"
+	case strings.HasPrefix(name, "lastlog"):
+		return "lastlog"
+	default:
+		return "wtmp"
+	}
+}
+
+func (c *UtmpCollector) Start() error {
+	file, err := os.Open(c.source.Path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", c.source.Path, err)
+	}
+	file.Close()
+
+	if c.format == "lastlog" {
+		// первое чтение только запоминает состояние
+		c.lastlog = c.readLastlog()
+	} else {
+		c.loadOffset()
+		c.restoreSessions()
+	}
+
+	c.wg.Add(1)
+	go c.pollLoop()
+
+	return nil
+}
+
+func (c *UtmpCollector) Stop() {
+	close(c.stopCh)
+	c.wg.Wait()
+	close(c.events)
+}
+
+func (c *UtmpCollector) Events() <-chan *types.Event {
+	return c.events
+}
+
+func (c *UtmpCollector) pollLoop() {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	c.poll()
+	for {
+		select {
+		case <-ticker.C:
+			c.poll()
+		case <-c.stopCh:
+			return
+		}
+	}
+}
+
+func (c *UtmpCollector) poll() {
+	if c.format == "lastlog" {
+		c.pollLastlog()
+		return
+	}
+
+	file, err := os.Open(c.source.Path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return
+	}
+	inode := fileInode(stat)
+	if (c.inode != 0 && inode != c.inode) || stat.Size() < c.offset*utmpRecordSize {
+		// logrotate создал новый файл; открытые сессии переходят в него
+		c.offset = 0
+	}
+	c.inode = inode
+
+	file.Seek(c.offset*utmpRecordSize, io.SeekStart)
+	buf := make([]byte, utmpRecordSize)
+	start := c.offset
+	for {
+		if _, err := io.ReadFull(file, buf); err != nil {
+			break
+		}
+
+		rec := parseUtmpRecord(buf)
+		if event := c.recordEvent(rec); event != nil {
+			select {
+			case c.events <- event:
+			case <-c.stopCh:
+				c.saveOffset()
+				return
+			}
+		}
+		c.offset++
+	}
+
+	if c.offset != start {
+		c.saveOffset()
+	}
+}
+
+// restoreSessions проходит уже прочитанные записи без отправки событий,
+// чтобы после перезапуска знать пользователей открытых сессий
+func (c *UtmpCollector) restoreSessions() {
+	if c.format != "wtmp" || c.offset == 0 {
+		return
+	}
+
+	file, err := os.Open(c.source.Path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	if stat, err := file.Stat(); err == nil {
+		c.inode = fileInode(stat)
+		if stat.Size() < c.offset*utmpRecordSize {
+			c.offset = 0
+			return
+		}
+	}
+
+	buf := make([]byte, utmpRecordSize)
+	for i := int64(0); i < c.offset; i++ {
+		if _, err := io.ReadFull(file, buf); err != nil {
+			return
+		}
+		c.recordEvent(parseUtmpRecord(buf))
+	}
+}
+
+// recordEvent обновляет состояние сессий и возвращает событие для записи
+func (c *UtmpCollector) recordEvent(rec utmpRecord) *types.Event {
+	if c.format == "btmp" {
+		if rec.User == "" {
+			return nil
+		}
+		event := c.newEvent(rec, "login_failed", "high")
+		event.User = rec.User
+		event.SetField("target_user", rec.User)
+		return event
+	}
+
+	switch rec.Type {
+	case utmpUserProcess:
+		if rec.User == "" {
+			return nil
+		}
+		c.sessions[rec.Line] = utmpSession{user: rec.User, host: rec.Host, login: rec.Time}
+
+		event := c.newEvent(rec, "user_login", "medium")
+		event.User = rec.User
+		event.SetField("target_user", rec.User)
+		return event
+
+	case utmpDeadProcess:
+		session, ok := c.sessions[rec.Line]
+		if !ok {
+			// getty и прочие процессы без входа пользователя
+			return nil
+		}
+		delete(c.sessions, rec.Line)
+
+		event := c.newEvent(rec, "user_logout", "low")
+		event.User = session.user
+		event.SetField("remote_host", session.host)
+		if duration := rec.Time.Sub(session.login); duration >= 0 {
+			event.SetField("session_duration", strconv.FormatInt(int64(duration.Seconds()), 10))
+		}
+		return event
+
+	case utmpBootTime:
+		// после перезагрузки старых сессий нет
+		c.sessions = make(map[string]utmpSession)
+		return c.newEvent(rec, "system_boot", "medium")
+
+	case utmpRunLevel:
+		event := c.newEvent(rec, "runlevel_change", "low")
+		if rec.User == "shutdown" {
+			c.sessions = make(map[string]utmpSession)
+			event.SetField("shutdown", "true")
+		}
+		// ut_pid = новый уровень + 256 * предыдущий
+		if level := byte(rec.PID % 256); level >= '0' && level <= 'z' {
+			event.SetField("runlevel", string(level))
+		}
+		if prev := byte(rec.PID / 256); prev >= '0' && prev <= 'z' {
+			event.SetField("previous_runlevel", string(prev))
+		}
+		return event
+	}
+
+	return nil
+}
+
+func (c *UtmpCollector) newEvent(rec utmpRecord, eventType, severity string) *types.Event {
+	raw := fmt.Sprintf("%s user=%s line=%s host=%s pid=%d time=%s",
+		utmpTypeNames[rec.Type], rec.User, rec.Line, rec.Host, rec.PID, rec.Time.UTC().Format(time.RFC3339))
+
+	event := types.NewEvent(c.format, eventType, severity, raw)
+	event.SetHostname(c.hostname)
+	if !rec.Time.IsZero() {
+		event.SetTimestamp(rec.Time)
+	}
+
+	if rec.Type == utmpBootTime || rec.Type == utmpRunLevel {
+		// в ut_host этих записей версия ядра
+		event.SetField("kernel", rec.Host)
+		return event
+	}
+
+	event.SetField("tty", rec.Line)
+	event.SetField("remote_host", rec.Host)
+	if rec.Addr != nil {
+		event.SetField("src_ip", rec.Addr.String())
+	} else if ip := net.ParseIP(rec.Host); ip != nil {
+		event.SetField("src_ip", ip.String())
+	}
+	if rec.PID > 0 {
+		event.SetField("pid", strconv.Itoa(int(rec.PID)))
+	}
+	if rec.Session > 0 {
+		event.SetField("session_id", strconv.Itoa(int(rec.Session)))
+	}
+	return event
+}
+
+// parseUtmpRecord разбирает struct utmp (little-endian, glibc x86_64/arm64)
+func parseUtmpRecord(buf []byte) utmpRecord {
+	le := binary.LittleEndian
+
+	rec := utmpRecord{
+		Type:    int16(le.Uint16(buf[0:2])),
+		PID:     int32(le.Uint32(buf[4:8])),
+		Line:    cString(buf[8:40]),
+		User:    cString(buf[44:76]),
+		Host:    cString(buf[76:332]),
+		Session: int32(le.Uint32(buf[336:340])),
+	}
+
+	if sec := int64(int32(le.Uint32(buf[340:344]))); sec > 0 {
+		usec := int64(int32(le.Uint32(buf[344:348])))
+		rec.Time = time.Unix(sec, usec*1000)
+	}
+
+	// ut_addr_v6: IPv4 занимает только первое слово
+	addr := buf[348:364]
+	switch {
+	case isZero(addr):
+	case isZero(addr[4:]):
+		rec.Addr = net.IP(append([]byte(nil), addr[:4]...))
+	default:
+		rec.Addr = net.IP(append([]byte(nil), addr...))
+	}
+
+	return rec
+}
+
+// pollLastlog сравнивает время последнего входа каждого пользователя
+// с предыдущим чтением
+func (c *UtmpCollector) pollLastlog() {
+	current := c.readLastlog()
+	if c.lastlog == nil {
+		c.lastlog = current
+		return
+	}
+
+	for uid, rec := range current {
+		if prev, ok := c.lastlog[uid]; ok && prev.Time.Equal(rec.Time) {
+			continue
+		}
+
+		event := c.newEvent(rec, "user_login", "medium")
+		event.User = rec.User
+		event.SetField("target_user", rec.User)
+		event.SetField("uid", uid)
+
+		select {
+		case c.events <- event:
+		case <-c.stopCh:
+			return
+		}
+	}
+	c.lastlog = current
+}
+
+// readLastlog читает записи только для uid из passwd: файл разреженный,
+// и его размер определяется максимальным uid
+func (c *UtmpCollector) readLastlog() map[string]utmpRecord {
+	entries, err := readPasswd(c.passwdPath)
+	if err != nil {
+		log.Printf("Не удалось прочитать %s: %v", c.passwdPath, err)
+		return nil
+	}
+
+	file, err := os.Open(c.source.Path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	records := make(map[string]utmpRecord)
+	buf := make([]byte, lastlogRecordSize)
+	for _, entry := range entries {
+		uid, err := strconv.ParseInt(entry.UID, 10, 64)
+		if err != nil {
+			continue
+		}
+		if _, err := file.ReadAt(buf, uid*lastlogRecordSize); err != nil {
+			continue
+		}
+
+		// struct lastlog: int32 ll_time, char ll_line[32], char ll_host[256]
+		sec := int64(int32(binary.LittleEndian.Uint32(buf[0:4])))
+		if sec <= 0 {
+			continue
+		}
+		records[entry.UID] = utmpRecord{
+			Type: utmpUserProcess,
+			User: entry.Name,
+			Line: cString(buf[4:36]),
+			Host: cString(buf[36:292]),
+			Time: time.Unix(sec, 0),
+		}
+	}
+	return records
+}
+
+func (c *UtmpCollector) loadOffset() {
+	data, err := os.ReadFile(c.offsetFile)
+	if err != nil {
+		c.offset = 0
+		return
+	}
+	fmt.Sscanf(string(data), "%d", &c.offset)
+}
+
+func (c *UtmpCollector) saveOffset() {
+	os.WriteFile(c.offsetFile, []byte(fmt.Sprintf("%d", c.offset)), 0644)
+}
+
+func fileInode(stat os.FileInfo) uint64 {
+	if sys, ok := stat.Sys().(*syscall.Stat_t); ok {
+		return sys.Ino
+	}
+	return 0
+}
+
+// cString обрезает строку фиксированной длины по первому NUL
+func cString(b []byte) string {
+	for i, ch := range b {
+		if ch == 0 {
+			b = b[:i]
+			break
+		}
+	}
+	return strings.TrimSpace(string(b))
+}
+
+func isZero(b []byte) bool {
+	for _, v := range b {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
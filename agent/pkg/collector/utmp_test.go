@@ -0,0 +1,180 @@
+package collector
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+// testUtmpRecord собирает struct utmp glibc (x86_64):
+//
+//	0   int16 ut_type (+2 выравнивание)
+//	4   int32 ut_pid
+//	8   char  ut_line[32]
+//	40  char  ut_id[4]
+//	44  char  ut_user[32]
+//	76  char  ut_host[256]
+//	332 int16 ut_exit.e_termination, e_exit
+//	336 int32 ut_session
+//	340 int32 ut_tv.tv_sec, 344 int32 ut_tv.tv_usec
+//	348 int32 ut_addr_v6[4]
+//	364 char  __unused[20]
+type testUtmpRecord struct {
+	typ     int16
+	pid     int32
+	line    string
+	user    string
+	host    string
+	session int32
+	sec     int32
+	usec    int32
+	addr    []byte
+}
+
+func (r testUtmpRecord) bytes() []byte {
+	buf := make([]byte, utmpRecordSize)
+	le := binary.LittleEndian
+	le.PutUint16(buf[0:2], uint16(r.typ))
+	le.PutUint32(buf[4:8], uint32(r.pid))
+	copy(buf[8:40], r.line)
+	copy(buf[44:76], r.user)
+	copy(buf[76:332], r.host)
+	le.PutUint32(buf[336:340], uint32(r.session))
+	le.PutUint32(buf[340:344], uint32(r.sec))
+	le.PutUint32(buf[344:348], uint32(r.usec))
+	copy(buf[348:364], r.addr)
+	return buf
+}
+
+func TestParseUtmpRecord(t *testing.T) {
+	tests := []struct {
+		name string
+		in   testUtmpRecord
+		want utmpRecord
+	}{
+		{
+			name: "ssh login with ipv4",
+			in: testUtmpRecord{
+				typ: utmpUserProcess, pid: 4242, line: "pts/0", user: "alice",
+				host: "203.0.113.7", session: 17, sec: 1700000000, usec: 250000,
+				addr: []byte{203, 0, 113, 7},
+			},
+			want: utmpRecord{
+				Type: utmpUserProcess, PID: 4242, Line: "pts/0", User: "alice",
+				Host: "203.0.113.7", Session: 17, Time: time.Unix(1700000000, 250000000),
+				Addr: net.IPv4(203, 0, 113, 7).To4(),
+			},
+		},
+		{
+			name: "ssh login with ipv6",
+			in: testUtmpRecord{
+				typ: utmpUserProcess, pid: 10, line: "pts/1", user: "bob",
+				host: "2001:db8::1", sec: 1700000100,
+				addr: net.ParseIP("2001:db8::1"),
+			},
+			want: utmpRecord{
+				Type: utmpUserProcess, PID: 10, Line: "pts/1", User: "bob",
+				Host: "2001:db8::1", Time: time.Unix(1700000100, 0),
+				Addr: net.ParseIP("2001:db8::1"),
+			},
+		},
+		{
+			name: "fields filling the whole buffer",
+			in: testUtmpRecord{
+				typ: utmpDeadProcess, line: "0123456789abcdef0123456789abcdef",
+				user: "u0123456789abcdef0123456789abcde", sec: 1,
+			},
+			want: utmpRecord{
+				Type: utmpDeadProcess, Line: "0123456789abcdef0123456789abcdef",
+				User: "u0123456789abcdef0123456789abcde", Time: time.Unix(1, 0),
+			},
+		},
+		{
+			name: "boot record without time",
+			in:   testUtmpRecord{typ: utmpBootTime, user: "reboot", host: "6.1.0-18-amd64"},
+			want: utmpRecord{Type: utmpBootTime, User: "reboot", Host: "6.1.0-18-amd64"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseUtmpRecord(tt.in.bytes())
+			if got.Type != tt.want.Type || got.PID != tt.want.PID || got.Line != tt.want.Line ||
+				got.User != tt.want.User || got.Host != tt.want.Host || got.Session != tt.want.Session {
+				t.Errorf("parseUtmpRecord() = %+v, want %+v", got, tt.want)
+			}
+			if !got.Time.Equal(tt.want.Time) {
+				t.Errorf("Time = %v, want %v", got.Time, tt.want.Time)
+			}
+			if !got.Addr.Equal(tt.want.Addr) {
+				t.Errorf("Addr = %v, want %v", got.Addr, tt.want.Addr)
+			}
+		})
+	}
+}
+
+func TestUtmpRecordEvents(t *testing.T) {
+	c := &UtmpCollector{format: "wtmp", hostname: "web01", sessions: make(map[string]utmpSession)}
+
+	records := []testUtmpRecord{
+		{typ: utmpBootTime, user: "reboot", host: "6.1.0-18-amd64", sec: 1700000000},
+		{typ: 6, pid: 900, line: "tty1", user: "LOGIN", sec: 1700000001}, // LOGIN_PROCESS
+		{typ: utmpUserProcess, pid: 1000, line: "pts/0", user: "alice", host: "198.51.100.4", sec: 1700000010, addr: []byte{198, 51, 100, 4}},
+		{typ: utmpDeadProcess, pid: 901, line: "tty1", sec: 1700000020},
+		{typ: utmpDeadProcess, pid: 1000, line: "pts/0", sec: 1700000310},
+		{typ: utmpRunLevel, pid: '0' + 256*'5', user: "shutdown", host: "6.1.0-18-amd64", sec: 1700000400},
+	}
+	want := []struct {
+		eventType string
+		fields    map[string]string
+	}{
+		{"system_boot", map[string]string{"kernel": "6.1.0-18-amd64"}},
+		{"user_login", map[string]string{"target_user": "alice", "src_ip": "198.51.100.4", "tty": "pts/0"}},
+		{"user_logout", map[string]string{"remote_host": "198.51.100.4", "session_duration": "300"}},
+		{"runlevel_change", map[string]string{"shutdown": "true", "runlevel": "0", "previous_runlevel": "5"}},
+	}
+
+	var got []string
+	i := 0
+	for _, rec := range records {
+		event := c.recordEvent(parseUtmpRecord(rec.bytes()))
+		if event == nil {
+			continue
+		}
+		got = append(got, event.EventType)
+		if i >= len(want) {
+			continue
+		}
+		if event.EventType != want[i].eventType {
+			t.Errorf("event %d: type %s, want %s", i, event.EventType, want[i].eventType)
+		}
+		for key, value := range want[i].fields {
+			if event.Fields[key] != value {
+				t.Errorf("event %d (%s): %s = %q, want %q", i, event.EventType, key, event.Fields[key], value)
+			}
+		}
+		i++
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got events %v, want %d events", got, len(want))
+	}
+}
+
+func TestUtmpBtmpEvent(t *testing.T) {
+	c := &UtmpCollector{format: "btmp", hostname: "web01", sessions: make(map[string]utmpSession)}
+
+	rec := testUtmpRecord{typ: 6, pid: 77, line: "ssh:notty", user: "admin", host: "192.0.2.50", sec: 1700000000, addr: []byte{192, 0, 2, 50}}
+	event := c.recordEvent(parseUtmpRecord(rec.bytes()))
+	if event == nil {
+		t.Fatal("recordEvent() = nil, want login_failed")
+	}
+	if event.EventType != "login_failed" || event.Severity != "high" || event.User != "admin" || event.Fields["src_ip"] != "192.0.2.50" {
+		t.Errorf("unexpected event %+v", event)
+	}
+
+	empty := testUtmpRecord{typ: 6, line: "ssh:notty", sec: 1700000000}
+	if event := c.recordEvent(parseUtmpRecord(empty.bytes())); event != nil {
+		t.Errorf("record without user produced %+v", event)
+	}
+}
@@ -0,0 +1,385 @@
+package collector
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"siem-project/agent/pkg/config"
+	"siem-project/agent/pkg/types"
+)
+
+// именованные форматы access логов
+var (
+	nginxLogFormats = map[string]string{
+		"combined": `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent"`,
+		"main":     `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent" "$http_x_forwarded_for"`,
+	}
+	apacheLogFormats = map[string]string{
+		"common":         `%h %l %u %t "%r" %>s %b`,
+		"combined":       `%h %l %u %t "%r" %>s %b "%{Referer}i" "%{User-Agent}i"`,
+		"vhost_combined": `%v:%p %h %l %u %t "%r" %>s %b "%{Referer}i" "%{User-Agent}i"`,
+	}
+)
+
+// переменные nginx -> поля события
+var nginxVariables = map[string]string{
+	"remote_addr":            "src_ip",
+	"binary_remote_addr":     "src_ip",
+	"realip_remote_addr":     "src_ip",
+	"remote_user":            "user",
+	"time_local":             "time_local",
+	"time_iso8601":           "time_iso",
+	"msec":                   "time_unix",
+	"request":                "request",
+	"request_method":         "http_method",
+	"request_uri":            "url",
+	"uri":                    "url_path",
+	"args":                   "query",
+	"query_string":           "query",
+	"server_protocol":        "http_version",
+	"status":                 "http_status",
+	"body_bytes_sent":        "bytes",
+	"bytes_sent":             "bytes",
+	"http_referer":           "referrer",
+	"http_user_agent":        "user_agent",
+	"http_x_forwarded_for":   "forwarded_for",
+	"request_time":           "request_time",
+	"upstream_response_time": "upstream_response_time",
+	"upstream_addr":          "upstream_addr",
+	"host":                   "vhost",
+	"server_name":            "vhost",
+	"server_port":            "server_port",
+}
+
+// директивы Apache LogFormat -> поля события
+var apacheDirectives = map[string]string{
+	"h":                  "src_ip",
+	"a":                  "src_ip",
+	"l":                  "ident",
+	"u":                  "user",
+	"t":                  "time_apache",
+	"r":                  "request",
+	"m":                  "http_method",
+	"U":                  "url_path",
+	"q":                  "query",
+	"H":                  "http_version",
+	"s":                  "http_status",
+	"b":                  "bytes",
+	"B":                  "bytes",
+	"O":                  "bytes",
+	"D":                  "request_time_us",
+	"T":                  "request_time",
+	"v":                  "vhost",
+	"V":                  "vhost",
+	"p":                  "server_port",
+	"{Referer}i":         "referrer",
+	"{User-Agent}i":      "user_agent",
+	"{X-Forwarded-For}i": "forwarded_for",
+}
+
+// $variable в nginx log_format и %directive в Apache LogFormat
+var (
+	nginxVarRegex  = regexp.MustCompile(`\$(\w+)`)
+	apacheDirRegex = regexp.MustCompile(`%[<>]?(\{[^}]*\}[a-zA-Z]|[a-zA-Z])`)
+	// имя группы регулярного выражения из имени переменной/заголовка
+	webGroupNameRegex = regexp.MustCompile(`\W+`)
+)
+
+func init() {
+	for _, server := range []string{"nginx", "apache"} {
+		server := server
+		formatHelp := "log_format nginx ($remote_addr ...) или имя: combined, main"
+		if server == "apache" {
+			formatHelp = "LogFormat Apache (%h %l %u ...) или имя: common, combined, vhost_combined"
+		}
+
+		Register(ParserFactory{
+			Type:        server + "_access",
+			Description: "access лог " + server + ": запросы, статусы, сканеры и веб-атаки",
+			Options: map[string]OptionSpec{
+				"log_format":      {Type: OptionString, Description: formatHelp, Default: "combined"},
+				"burst_threshold": {Type: OptionInt, Description: "сколько ответов 4xx с одного IP (или 5xx всего) за burst_window считать всплеском", Default: 20},
+				"burst_window":    {Type: OptionDuration, Description: "окно подсчета всплесков 4xx/5xx", Default: "1m"},
+			},
+			Validate: func(source config.SourceConfig, opts Options) error {
+				_, err := compileAccessFormat(server, opts.String("log_format"))
+				return err
+			},
+			NewParser: func(source config.SourceConfig, opts Options) (LogParser, error) {
+				return NewWebAccessParser(server, opts.String("log_format"), opts.Int("burst_threshold"), opts.Duration("burst_window"))
+			},
+		})
+	}
+}
+
+// WebAccessParser разбирает access логи nginx и Apache по формату из
+// конфига и классифицирует запросы (сканеры, атаки, всплески ошибок)
+type WebAccessParser struct {
+	server     string
+	lineRegex  *regexp.Regexp
+	classifier *webClassifier
+}
+
+func NewWebAccessParser(server, logFormat string, burstThreshold int, burstWindow time.Duration) (*WebAccessParser, error) {
+	lineRegex, err := compileAccessFormat(server, logFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	return &WebAccessParser{
+		server:     server,
+		lineRegex:  lineRegex,
+		classifier: newWebClassifier(burstThreshold, burstWindow),
+	}, nil
+}
+
+func (p *WebAccessParser) GetSourceType() string {
+	return p.server + "_access"
+}
+
+func (p *WebAccessParser) Parse(line string, hostname string) (*types.Event, error) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return nil, fmt.Errorf("empty line")
+	}
+
+	m := p.lineRegex.FindStringSubmatch(line)
+	if m == nil {
+		return nil, fmt.Errorf("line does not match log format")
+	}
+
+	values := make(map[string]string)
+	for i, name := range p.lineRegex.SubexpNames() {
+		// "-" означает пустое значение в обоих серверах
+		if name != "" && m[i] != "" && m[i] != "-" {
+			values[name] = unescapeWebValue(m[i])
+		}
+	}
+
+	event := types.NewEvent(p.GetSourceType(), "http_request", "low", line)
+	event.SetHostname(hostname)
+	event.Process = p.server
+
+	splitHTTPRequest(values)
+	p.setTimestamp(event, values)
+	if ms, ok := responseTimeMillis(values); ok {
+		event.SetField("response_time_ms", ms)
+	}
+	event.User = values["user"]
+
+	for name, value := range values {
+		switch name {
+		case "user", "request", "time_local", "time_iso", "time_unix", "time_apache", "request_time", "request_time_us", "ident":
+			continue
+		}
+		event.SetField(name, value)
+	}
+
+	p.classifier.classify(event, values)
+
+	return event, nil
+}
+
+// splitHTTPRequest раскладывает строку запроса "GET /path?q=1 HTTP/1.1"
+func splitHTTPRequest(values map[string]string) {
+	if request, ok := values["request"]; ok {
+		parts := strings.Fields(request)
+		if len(parts) == 3 {
+			setDefault(values, "http_method", parts[0])
+			setDefault(values, "url", parts[1])
+			setDefault(values, "http_version", parts[2])
+		} else {
+			// мусор вместо HTTP (TLS на http порт, сканеры)
+			values["malformed_request"] = request
+		}
+	}
+
+	if url, ok := values["url"]; ok {
+		path, query, _ := strings.Cut(url, "?")
+		setDefault(values, "url_path", path)
+		if query != "" {
+			setDefault(values, "query", query)
+		}
+		delete(values, "url")
+	}
+}
+
+func (p *WebAccessParser) setTimestamp(event *types.Event, values map[string]string) {
+	if value, ok := values["time_local"]; ok {
+		if ts, err := time.Parse("02/Jan/2006:15:04:05 -0700", value); err == nil {
+			event.SetTimestamp(ts)
+		}
+	} else if value, ok := values["time_apache"]; ok {
+		if ts, err := time.Parse("[02/Jan/2006:15:04:05 -0700]", value); err == nil {
+			event.SetTimestamp(ts)
+		}
+	} else if value, ok := values["time_iso"]; ok {
+		if ts, ok := parseSyslogTimestamp(value, time.Now(), time.Local); ok {
+			event.SetTimestamp(ts)
+		}
+	} else if value, ok := values["time_unix"]; ok {
+		if sec, err := strconv.ParseFloat(value, 64); err == nil {
+			event.SetTimestamp(time.UnixMilli(int64(sec * 1000)))
+		}
+	}
+}
+
+// responseTimeMillis приводит $request_time (секунды), %T (секунды)
+// и %D (микросекунды) к миллисекундам
+func responseTimeMillis(values map[string]string) (string, bool) {
+	if value, ok := values["request_time_us"]; ok {
+		if us, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return strconv.FormatInt(us/1000, 10), true
+		}
+	}
+	if value, ok := values["request_time"]; ok {
+		if sec, err := strconv.ParseFloat(value, 64); err == nil {
+			return strconv.FormatInt(int64(sec*1000), 10), true
+		}
+	}
+	return "", false
+}
+
+func setDefault(values map[string]string, key, value string) {
+	if _, ok := values[key]; !ok && value != "" && value != "-" {
+		values[key] = value
+	}
+}
+
+// nginx экранирует кавычки как \x22, Apache - как \"
+func unescapeWebValue(value string) string {
+	if !strings.Contains(value, `\`) {
+		return value
+	}
+	return strings.NewReplacer(`\x22`, `"`, `\"`, `"`, `\\`, `\`).Replace(value)
+}
+
+// compileAccessFormat строит регулярное выражение по формату лога.
+// Для встроенных форматов допускается дописанное в конец время ответа
+func compileAccessFormat(server, logFormat string) (*regexp.Regexp, error) {
+	if logFormat == "" {
+		logFormat = "combined"
+	}
+
+	var (
+		expr  string
+		err   error
+		named bool
+	)
+	if server == "apache" {
+		format, ok := apacheLogFormats[logFormat]
+		named = ok
+		if ok {
+			logFormat = format
+		}
+		expr, err = apacheFormatRegex(logFormat)
+	} else {
+		format, ok := nginxLogFormats[logFormat]
+		named = ok
+		if ok {
+			logFormat = format
+		}
+		expr, err = nginxFormatRegex(logFormat)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if named {
+		// часто в конец combined дописывают $request_time или %D
+		timeField := "request_time"
+		if server == "apache" {
+			timeField = "request_time_us"
+		}
+		expr += `(?:\s+(?P<` + timeField + `>\d+(?:\.\d+)?))?`
+	}
+
+	re, err := regexp.Compile("^" + expr + `\s*$`)
+	if err != nil {
+		return nil, fmt.Errorf("invalid log_format: %w", err)
+	}
+	return re, nil
+}
+
+func nginxFormatRegex(format string) (string, error) {
+	var sb strings.Builder
+	used := make(map[string]bool)
+	last := 0
+
+	for _, loc := range nginxVarRegex.FindAllStringSubmatchIndex(format, -1) {
+		sb.WriteString(regexp.QuoteMeta(format[last:loc[0]]))
+		last = loc[1]
+
+		variable := format[loc[2]:loc[3]]
+		field, ok := nginxVariables[variable]
+		if !ok {
+			field = variable
+		}
+		sb.WriteString(webValueRegex(field, format[last:], used))
+	}
+	sb.WriteString(regexp.QuoteMeta(format[last:]))
+
+	if len(used) == 0 {
+		return "", fmt.Errorf("log_format has no variables")
+	}
+	return sb.String(), nil
+}
+
+func apacheFormatRegex(format string) (string, error) {
+	var sb strings.Builder
+	used := make(map[string]bool)
+	last := 0
+
+	literal := func(text string) string {
+		return regexp.QuoteMeta(strings.ReplaceAll(text, "%%", "%"))
+	}
+
+	for _, loc := range apacheDirRegex.FindAllStringSubmatchIndex(format, -1) {
+		sb.WriteString(literal(format[last:loc[0]]))
+		last = loc[1]
+
+		directive := format[loc[2]:loc[3]]
+		field, ok := apacheDirectives[directive]
+		if !ok {
+			// %{Cookie}i -> cookie
+			if end := strings.Index(directive, "}"); end > 0 {
+				directive = directive[1:end]
+			}
+			field = strings.ToLower(strings.Trim(webGroupNameRegex.ReplaceAllString(directive, "_"), "_"))
+		}
+		sb.WriteString(webValueRegex(field, format[last:], used))
+	}
+	sb.WriteString(literal(format[last:]))
+
+	if len(used) == 0 {
+		return "", fmt.Errorf("log_format has no directives")
+	}
+	return sb.String(), nil
+}
+
+// webValueRegex возвращает группу для значения: в кавычках - до закрывающей
+// кавычки, время Apache - в скобках, остальное - до пробела
+func webValueRegex(field, rest string, used map[string]bool) string {
+	var value string
+	switch {
+	case field == "time_apache":
+		value = `\[[^\]]+\]`
+	case field == "time_local":
+		value = `[^\]]+`
+	case strings.HasPrefix(rest, `"`):
+		value = `(?:[^"\\]|\\.)*`
+	default:
+		value = `\S+`
+	}
+
+	name := webGroupNameRegex.ReplaceAllString(field, "_")
+	if used[name] {
+		// повторная переменная в формате: значение берется из первой
+		return "(?:" + value + ")"
+	}
+	used[name] = true
+	return "(?P<" + name + ">" + value + ")"
+}
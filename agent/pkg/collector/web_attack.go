@@ -0,0 +1,179 @@
+package collector
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"siem-project/agent/pkg/types"
+)
+
+// сигнатуры веб-атак проверяются по раскодированному пути и query
+var (
+	webScannerRegex   = regexp.MustCompile(`(?i)(sqlmap|nikto|nmap|masscan|zgrab|nuclei|dirbuster|gobuster|dirb/|wpscan|acunetix|nessus|openvas|w3af|wfuzz|ffuf|feroxbuster|havij|zmeu|jorgee|whatweb|netsparker|appscan|burp)`)
+	webTraversalRegex = regexp.MustCompile(`(?i)(\.\./|\.\.\\|/etc/(passwd|shadow)|/proc/self/|c:\\windows|win\.ini|boot\.ini)`)
+	webSQLiRegex      = regexp.MustCompile(`(?i)(union(\s|\+|/\*.*?\*/)+(all(\s|\+)+)?select\b|'\s*(or|and)\s+'?\d+'?\s*=\s*'?\d+|\b(or|and)\s+\d+\s*=\s*\d+|sleep\(\s*\d+\s*\)|benchmark\(|waitfor\s+delay|information_schema|pg_sleep|extractvalue\(|updatexml\(|'\s*;?\s*--|;\s*(drop|shutdown|exec)\s)`)
+	webXSSRegex       = regexp.MustCompile(`(?i)(<\s*script|javascript:|\bon(error|load|mouseover|focus)\s*=|<\s*(img|svg|iframe|body)[^>]*\bon\w+|document\.(cookie|location)|alert\s*\(|<\s*iframe)`)
+)
+
+// webClassifier определяет тип и severity HTTP запроса. Всплески считаются
+// по времени из лога, поэтому старые логи при первом чтении не дают ложных
+// срабатываний
+type webClassifier struct {
+	threshold int
+	window    time.Duration
+
+	mu           sync.Mutex
+	clientErrors map[string]*webBurst // 4xx по IP клиента
+	serverErrors webBurst             // 5xx по всему серверу
+}
+
+type webBurst struct {
+	start time.Time
+	count int
+}
+
+func newWebClassifier(threshold int, window time.Duration) *webClassifier {
+	if threshold <= 0 {
+		threshold = 20
+	}
+	if window <= 0 {
+		window = time.Minute
+	}
+	return &webClassifier{
+		threshold:    threshold,
+		window:       window,
+		clientErrors: make(map[string]*webBurst),
+	}
+}
+
+func (c *webClassifier) classify(event *types.Event, values map[string]string) {
+	status, _ := strconv.Atoi(values["http_status"])
+	target := decodeWebTarget(values["url_path"] + "?" + values["query"] + " " + values["malformed_request"])
+
+	switch {
+	case webSQLiRegex.MatchString(target):
+		setWebAttack(event, "web_sqli", "sqli", "high")
+	case webXSSRegex.MatchString(target):
+		setWebAttack(event, "web_xss", "xss", "high")
+	case webTraversalRegex.MatchString(target):
+		setWebAttack(event, "web_path_traversal", "path_traversal", "high")
+	case webScannerRegex.MatchString(values["user_agent"]):
+		setWebAttack(event, "web_scanner", "scanner", "medium")
+	case status >= 500:
+		event.Severity = "medium"
+	}
+
+	if status >= 400 {
+		c.countError(event, values["src_ip"], status)
+	}
+}
+
+// countError помечает запрос, на котором число ошибок достигло порога
+func (c *webClassifier) countError(event *types.Event, ip string, status int) {
+	ts, err := time.Parse(time.RFC3339Nano, event.Timestamp)
+	if err != nil {
+		ts = time.Now()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if status >= 500 {
+		if c.serverErrors.add(ts, c.window) == c.threshold && event.EventType == "http_request" {
+			setWebBurst(event, "web_server_error_burst", "high", c.threshold)
+		}
+		return
+	}
+
+	burst, ok := c.clientErrors[ip]
+	if !ok {
+		if len(c.clientErrors) >= 10000 {
+			c.expire(ts)
+		}
+		burst = &webBurst{}
+		c.clientErrors[ip] = burst
+	}
+	if burst.add(ts, c.window) == c.threshold && event.EventType == "http_request" {
+		setWebBurst(event, "web_client_error_burst", "medium", c.threshold)
+	}
+}
+
+// expire удаляет счетчики IP, окно которых закончилось
+func (c *webClassifier) expire(now time.Time) {
+	for ip, burst := range c.clientErrors {
+		if now.Sub(burst.start) > c.window {
+			delete(c.clientErrors, ip)
+		}
+	}
+}
+
+func (b *webBurst) add(ts time.Time, window time.Duration) int {
+	if b.count == 0 || ts.Sub(b.start) > window || ts.Before(b.start) {
+		b.start = ts
+		b.count = 0
+	}
+	b.count++
+	return b.count
+}
+
+func setWebAttack(event *types.Event, eventType, attack, severity string) {
+	event.EventType = eventType
+	event.Severity = severity
+	event.SetField("attack", attack)
+}
+
+func setWebBurst(event *types.Event, eventType, severity string, count int) {
+	event.EventType = eventType
+	event.Severity = severity
+	event.SetField("burst_count", strconv.Itoa(count))
+}
+
+// decodeWebTarget раскрывает URL-кодирование, в том числе двойное (%252e).
+// Неверные последовательности (%zz) остаются как есть, а не отменяют
+// декодирование всей строки
+func decodeWebTarget(target string) string {
+	for i := 0; i < 2 && strings.ContainsAny(target, "%+"); i++ {
+		decoded := unescapeWebTarget(target)
+		if decoded == target {
+			break
+		}
+		target = decoded
+	}
+	return target
+}
+
+// unescapeWebTarget - url.QueryUnescape, который пропускает ошибки
+func unescapeWebTarget(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '%' && i+2 < len(s) && isHexDigit(s[i+1]) && isHexDigit(s[i+2]):
+			b.WriteByte(unhexDigit(s[i+1])<<4 | unhexDigit(s[i+2]))
+			i += 2
+		case c == '+':
+			b.WriteByte(' ')
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+func isHexDigit(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhexDigit(c byte) byte {
+	switch {
+	case c >= 'a':
+		return c - 'a' + 10
+	case c >= 'A':
+		return c - 'A' + 10
+	default:
+		return c - '0'
+	}
+}
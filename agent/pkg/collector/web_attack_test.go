@@ -0,0 +1,54 @@
+package collector
+
+import (
+	"testing"
+	"time"
+
+	"siem-project/agent/pkg/types"
+)
+
+func TestDecodeWebTarget(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"/search?q=%27%20OR%201=1", "/search?q=' OR 1=1"},
+		{"/a?q=hello+world", "/a?q=hello world"},
+		{"/%252e%252e/%252e%252e/etc/passwd", "/../../etc/passwd"},
+		{"/?q=%zz%27%20OR%201=1", "/?q=%zz' OR 1=1"},
+		{"/?q=%%27%20OR%201=1", "/?q=%' OR 1=1"},
+		{"/?q=50%", "/?q=50%"},
+		{"/?q=%2", "/?q=%2"},
+		{"/plain/path", "/plain/path"},
+	}
+	for _, tt := range tests {
+		if got := decodeWebTarget(tt.in); got != tt.want {
+			t.Errorf("decodeWebTarget(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestWebClassifierMalformedEscapeEvasion(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		query  string
+		attack string
+	}{
+		{"sqli after invalid escape", "/search", "q=%zz%27%20OR%201=1", "sqli"},
+		{"xss after truncated escape", "/page", "x=%G1%3Cscript%3Ealert(1)%3C/script%3E", "xss"},
+		{"traversal after stray percent", "/static/%/..%2f..%2fetc%2fpasswd", "", "path_traversal"},
+		{"clean request with stray percent", "/discount", "v=50%", ""},
+	}
+
+	c := newWebClassifier(0, 0)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := types.NewEvent("nginx", "http_request", "low", "")
+			event.SetTimestamp(time.Now())
+			c.classify(event, map[string]string{"url_path": tt.path, "query": tt.query, "http_status": "200", "src_ip": "192.0.2.1"})
+			if got := event.Fields["attack"]; got != tt.attack {
+				t.Errorf("attack = %q, want %q", got, tt.attack)
+			}
+		})
+	}
+}
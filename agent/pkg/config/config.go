@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"time"
 
 	"gopkg.in/yaml.v2"
 )
@@ -17,6 +19,9 @@ type Config struct {
 	Sources []SourceConfig `yaml:"sources"`
 	Buffer  BufferConfig   `yaml:"buffer"`
 	Sender  SenderConfig   `yaml:"sender"`
+
+	Pipeline   PipelineConfig   `yaml:"pipeline"`
+	Enrichment EnrichmentConfig `yaml:"enrichment"`
 }
 
 type ServerConfig struct {
@@ -39,6 +44,136 @@ type SourceConfig struct {
 	Type    string `yaml:"type"`
 	Path    string `yaml:"path"`
 	Enabled bool   `yaml:"enabled"`
+
+	// для сетевых источников (syslog_listener)
+	Listen   string `yaml:"listen"`   // адрес, например ":5514"
+	Protocol string `yaml:"protocol"` // udp, tcp или tls
+	TLSCert  string `yaml:"tls_cert"`
+	TLSKey   string `yaml:"tls_key"`
+
+	// параметры конкретного парсера, схема задается при регистрации типа
+	Options map[string]interface{} `yaml:"options"`
+
+	// склейка многострочных записей (stack trace, kernel oops)
+	Multiline *MultilineConfig `yaml:"multiline"`
+	// строки длиннее обрезаются и помечаются, по умолчанию 64 KB
+	MaxLineLength int `yaml:"max_line_length"`
+
+	// для type: custom - парсер, описанный в конфиге
+	Parser *CustomParserConfig `yaml:"parser"`
+}
+
+// MultilineConfig: строка, подходящая под start_pattern, начинает новую
+// запись, под continuation_pattern - продолжает текущую
+type MultilineConfig struct {
+	StartPattern        string `yaml:"start_pattern"`
+	ContinuationPattern string `yaml:"continuation_pattern"`
+	MaxLines            int    `yaml:"max_lines"`
+	FlushTimeout        string `yaml:"flush_timeout"` // например "1s"
+}
+
+// CustomParserConfig описывает парсер без кода: шаблоны grok (%{IP:src})
+// или регулярные выражения с именованными группами пробуются по порядку
+type CustomParserConfig struct {
+	Name            string             `yaml:"name"` // попадает в Event.Source
+	Patterns        []string           `yaml:"patterns"`
+	Definitions     map[string]string  `yaml:"definitions"` // свои grok шаблоны
+	Fields          map[string]string  `yaml:"fields"`      // поле события -> имя группы
+	TimestampFormat string             `yaml:"timestamp_format"`
+	EventType       string             `yaml:"event_type"`
+	Severity        string             `yaml:"severity"`
+	Rules           []CustomRuleConfig `yaml:"rules"`
+}
+
+// CustomRuleConfig меняет тип/severity, если поле совпало (первое подходящее правило)
+type CustomRuleConfig struct {
+	Field     string `yaml:"field"`
+	Equals    string `yaml:"equals"`
+	Matches   string `yaml:"matches"`
+	EventType string `yaml:"event_type"`
+	Severity  string `yaml:"severity"`
+}
+
+// PipelineConfig - обработка событий между коллекторами и буфером:
+// фильтры, ограничение частоты по источникам и выборка
+type PipelineConfig struct {
+	Filters       []FilterRuleConfig `yaml:"filters"`
+	RateLimits    []RateLimitConfig  `yaml:"rate_limits"`
+	Sampling      []SamplingConfig   `yaml:"sampling"`
+	Aggregate     []AggregateConfig  `yaml:"aggregate"`
+	Redaction     RedactionConfig    `yaml:"redaction"`
+	StatsInterval string             `yaml:"stats_interval"` // как часто отправлять счетчики отброшенного, "60s"
+}
+
+// FilterRuleConfig: решает первое правило, у которого выполнены все условия.
+// keep пропускает событие мимо ограничений частоты и выборки
+type FilterRuleConfig struct {
+	Action     string                  `yaml:"action"` // drop или keep
+	Conditions []FilterConditionConfig `yaml:"conditions"`
+}
+
+// FilterConditionConfig проверяет поле события (source, event_type, severity,
+// user, process, command, raw_log, hostname) или поле из details
+type FilterConditionConfig struct {
+	Field   string   `yaml:"field"`
+	Equals  string   `yaml:"equals"`
+	In      []string `yaml:"in"`
+	Matches string   `yaml:"matches"`
+	Not     bool     `yaml:"not"`
+}
+
+// RateLimitConfig - token bucket на источник; source "*" задает лимит для
+// остальных источников (у каждого свой bucket)
+type RateLimitConfig struct {
+	Source string  `yaml:"source"`
+	Rate   float64 `yaml:"rate"`  // событий в секунду
+	Burst  int     `yaml:"burst"` // запас, по умолчанию rate
+}
+
+// SamplingConfig оставляет долю rate событий (0..1); применяется первое
+// подходящее правило
+type SamplingConfig struct {
+	Source    string  `yaml:"source"`
+	EventType string  `yaml:"event_type"`
+	Severity  string  `yaml:"severity"` // по умолчанию low
+	Rate      float64 `yaml:"rate"`
+}
+
+// AggregateConfig схлопывает события одного типа с одинаковыми key_fields,
+// пришедшие за window, в одно событие с count, first_seen и last_seen
+type AggregateConfig struct {
+	EventType string   `yaml:"event_type"`
+	Source    string   `yaml:"source"`     // пусто - любой источник
+	KeyFields []string `yaml:"key_fields"` // по умолчанию user и src_ip
+	Window    string   `yaml:"window"`     // по умолчанию "1m"
+}
+
+// RedactionConfig - маскирование паролей, ключей и токенов в command, raw_log
+// и текстовых полях до попадания в буфер. Включено по умолчанию
+type RedactionConfig struct {
+	Disable        bool                     `yaml:"disable"`
+	Replacement    string                   `yaml:"replacement"`     // по умолчанию [REDACTED]
+	DisableEntropy bool                     `yaml:"disable_entropy"` // не искать случайные строки
+	MinEntropy     float64                  `yaml:"min_entropy"`     // бит на символ, по умолчанию 4.2
+	Fields         []string                 `yaml:"fields"`          // поля details, которые тоже проверяются
+	Patterns       []RedactionPatternConfig `yaml:"patterns"`
+}
+
+// RedactionPatternConfig: если в выражении есть группа, заменяется только
+// она, иначе все совпадение
+type RedactionPatternConfig struct {
+	Name    string `yaml:"name"`
+	Pattern string `yaml:"pattern"`
+}
+
+// EnrichmentConfig - сведения о хосте (адреса, ОС, ядро, облако) и
+// статические метки, которые агент добавляет к каждому событию
+type EnrichmentConfig struct {
+	Disable         bool              `yaml:"disable"`
+	Tags            map[string]string `yaml:"tags"`             // env: prod -> details.tag_env
+	RefreshInterval string            `yaml:"refresh_interval"` // по умолчанию "5m"
+	RootDir         string            `yaml:"root_dir"`         // корень ФС хоста для os-release, DMI и MAC в контейнере
+	NetPath         string            `yaml:"net_path"`         // таблицы сети хоста, по умолчанию /proc/1/net
 }
 
 type BufferConfig struct {
@@ -77,9 +212,13 @@ func Load(path string) (*Config, error) {
 
 	for i := range cfg.Sources {
 		cfg.Sources[i].Path = expandPath(cfg.Sources[i].Path)
+		cfg.Sources[i].TLSCert = expandPath(cfg.Sources[i].TLSCert)
+		cfg.Sources[i].TLSKey = expandPath(cfg.Sources[i].TLSKey)
 	}
 	cfg.Logging.File = expandPath(cfg.Logging.File)
 	cfg.Buffer.DiskPath = expandPath(cfg.Buffer.DiskPath)
+	cfg.Enrichment.RootDir = expandPath(cfg.Enrichment.RootDir)
+	cfg.Enrichment.NetPath = expandPath(cfg.Enrichment.NetPath)
 
 	if err := cfg.Validate(); err != nil {
 		return nil, err
@@ -121,6 +260,132 @@ func (c *Config) Validate() error {
 	if len(c.Sources) == 0 {
 		return fmt.Errorf("at least one source must be configured")
 	}
+	for i, src := range c.Sources {
+		if src.MaxLineLength < 0 {
+			return fmt.Errorf("sources[%d].max_line_length must not be negative", i)
+		}
+		if err := src.Multiline.validate(); err != nil {
+			return fmt.Errorf("sources[%d].multiline: %w", i, err)
+		}
+		if err := validateSource(src); err != nil {
+			return fmt.Errorf("sources[%d] (%s): %w", i, src.Type, err)
+		}
+	}
+	if err := c.Pipeline.validate(); err != nil {
+		return fmt.Errorf("pipeline: %w", err)
+	}
+	if err := c.Enrichment.validate(); err != nil {
+		return fmt.Errorf("enrichment: %w", err)
+	}
+	return nil
+}
+
+var tagNameRegex = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+func (e *EnrichmentConfig) validate() error {
+	for name := range e.Tags {
+		if !tagNameRegex.MatchString(name) {
+			return fmt.Errorf("invalid tag name %q: only letters, digits and _ are allowed", name)
+		}
+	}
+	if e.RefreshInterval != "" {
+		interval, err := time.ParseDuration(e.RefreshInterval)
+		if err != nil {
+			return fmt.Errorf("invalid refresh_interval: %w", err)
+		}
+		if interval <= 0 {
+			return fmt.Errorf("refresh_interval must be positive")
+		}
+	}
+	return nil
+}
+
+func (p *PipelineConfig) validate() error {
+	for i, rule := range p.Filters {
+		if rule.Action != "drop" && rule.Action != "keep" {
+			return fmt.Errorf("filters[%d]: action must be drop or keep", i)
+		}
+		if len(rule.Conditions) == 0 {
+			return fmt.Errorf("filters[%d]: at least one condition is required", i)
+		}
+		for j, cond := range rule.Conditions {
+			if cond.Field == "" {
+				return fmt.Errorf("filters[%d].conditions[%d]: field is required", i, j)
+			}
+			if cond.Equals == "" && len(cond.In) == 0 && cond.Matches == "" {
+				return fmt.Errorf("filters[%d].conditions[%d]: equals, in or matches is required", i, j)
+			}
+			if _, err := regexp.Compile(cond.Matches); err != nil {
+				return fmt.Errorf("filters[%d].conditions[%d]: invalid pattern %q: %w", i, j, cond.Matches, err)
+			}
+		}
+	}
+	for i, limit := range p.RateLimits {
+		if limit.Source == "" {
+			return fmt.Errorf("rate_limits[%d]: source is required", i)
+		}
+		if limit.Rate <= 0 || limit.Burst < 0 {
+			return fmt.Errorf("rate_limits[%d]: rate must be positive and burst must not be negative", i)
+		}
+	}
+	for i, sample := range p.Sampling {
+		if sample.Rate <= 0 || sample.Rate > 1 {
+			return fmt.Errorf("sampling[%d]: rate must be in (0, 1]", i)
+		}
+	}
+	for i, agg := range p.Aggregate {
+		if agg.EventType == "" {
+			return fmt.Errorf("aggregate[%d]: event_type is required", i)
+		}
+		if agg.Window != "" {
+			if window, err := time.ParseDuration(agg.Window); err != nil || window <= 0 {
+				return fmt.Errorf("aggregate[%d]: invalid window %q", i, agg.Window)
+			}
+		}
+	}
+	for i, pattern := range p.Redaction.Patterns {
+		if pattern.Name == "" || pattern.Pattern == "" {
+			return fmt.Errorf("redaction.patterns[%d]: name and pattern are required", i)
+		}
+		if _, err := regexp.Compile(pattern.Pattern); err != nil {
+			return fmt.Errorf("redaction.patterns[%d]: invalid pattern: %w", i, err)
+		}
+	}
+	if p.Redaction.MinEntropy < 0 {
+		return fmt.Errorf("redaction.min_entropy must not be negative")
+	}
+	if p.StatsInterval != "" {
+		interval, err := time.ParseDuration(p.StatsInterval)
+		if err != nil {
+			return fmt.Errorf("invalid stats_interval: %w", err)
+		}
+		if interval <= 0 {
+			return fmt.Errorf("stats_interval must be positive")
+		}
+	}
+	return nil
+}
+
+func (m *MultilineConfig) validate() error {
+	if m == nil {
+		return nil
+	}
+	if m.StartPattern == "" && m.ContinuationPattern == "" {
+		return fmt.Errorf("start_pattern or continuation_pattern is required")
+	}
+	for _, pattern := range []string{m.StartPattern, m.ContinuationPattern} {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	if m.FlushTimeout != "" {
+		if _, err := time.ParseDuration(m.FlushTimeout); err != nil {
+			return fmt.Errorf("invalid flush_timeout: %w", err)
+		}
+	}
+	if m.MaxLines < 0 {
+		return fmt.Errorf("max_lines must not be negative")
+	}
 	return nil
 }
 
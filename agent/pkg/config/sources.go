@@ -0,0 +1,57 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// SourceValidator проверяет настройки источника конкретного типа
+type SourceValidator func(src SourceConfig) error
+
+// известные типы источников; заполняется реестром парсеров (pkg/collector),
+// config не может импортировать collector напрямую
+var (
+	sourceTypesMu sync.RWMutex
+	sourceTypes   = make(map[string]SourceValidator)
+)
+
+// RegisterSourceType добавляет тип источника, допустимый в sources[].type
+func RegisterSourceType(name string, validate SourceValidator) {
+	sourceTypesMu.Lock()
+	defer sourceTypesMu.Unlock()
+	sourceTypes[name] = validate
+}
+
+// SourceTypes возвращает отсортированный список зарегистрированных типов
+func SourceTypes() []string {
+	sourceTypesMu.RLock()
+	defer sourceTypesMu.RUnlock()
+
+	names := make([]string, 0, len(sourceTypes))
+	for name := range sourceTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func validateSource(src SourceConfig) error {
+	sourceTypesMu.RLock()
+	validate, ok := sourceTypes[src.Type]
+	registered := len(sourceTypes)
+	sourceTypesMu.RUnlock()
+
+	// реестр пуст, если пакет с парсерами не подключен - проверять нечем
+	if registered == 0 {
+		return nil
+	}
+	if !ok {
+		return fmt.Errorf("unknown source type %q, valid types: %s", src.Type, strings.Join(SourceTypes(), ", "))
+	}
+	if !src.Enabled || validate == nil {
+		return nil
+	}
+	return validate(src)
+}
@@ -0,0 +1,161 @@
+package pipeline
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"siem-project/agent/pkg/config"
+	"siem-project/agent/pkg/types"
+)
+
+// окно агрегации, если в правиле не задано
+const defaultAggregateWindow = time.Minute
+
+// ключевые поля по умолчанию: кто и откуда
+var defaultAggregateKeys = []string{"user", "src_ip"}
+
+// больше групп одновременно не открывается, события идут без агрегации
+const maxAggregateGroups = 10000
+
+// aggregator пропускает первое событие группы сразу, а повторы за окно
+// считает и по его окончании отправляет одним итоговым событием
+type aggregator struct {
+	rules  []aggregateRule
+	groups map[string]*aggregateGroup
+}
+
+type aggregateRule struct {
+	eventType string
+	source    string
+	keys      []string
+	window    time.Duration
+}
+
+type aggregateGroup struct {
+	first    *types.Event // копия первого события, основа итогового
+	repeats  int
+	severity string // максимальная важность повторов
+	lastSeen string
+	lastNs   string // доли секунды lastSeen (timestamp_ns)
+	lastRaw  string
+	deadline time.Time
+}
+
+func newAggregator(cfg []config.AggregateConfig) (*aggregator, error) {
+	a := &aggregator{groups: make(map[string]*aggregateGroup)}
+
+	for i, rule := range cfg {
+		r := aggregateRule{
+			eventType: rule.EventType,
+			source:    rule.Source,
+			keys:      rule.KeyFields,
+			window:    defaultAggregateWindow,
+		}
+		if len(r.keys) == 0 {
+			r.keys = defaultAggregateKeys
+		}
+		if rule.Window != "" {
+			window, err := time.ParseDuration(rule.Window)
+			if err != nil {
+				return nil, fmt.Errorf("aggregate %d: %w", i, err)
+			}
+			r.window = window
+		}
+		a.rules = append(a.rules, r)
+	}
+	return a, nil
+}
+
+// add возвращает true, если событие - повтор и учтено в группе; первое
+// событие группы не задерживается, чтобы не опаздывали оповещения
+func (a *aggregator) add(event *types.Event, now time.Time) bool {
+	for _, rule := range a.rules {
+		if rule.eventType != event.EventType || (rule.source != "" && rule.source != event.Source) {
+			continue
+		}
+
+		key := rule.key(event)
+		if group, ok := a.groups[key]; ok {
+			group.repeats++
+			group.lastSeen = event.Timestamp
+			group.lastNs = event.Fields["timestamp_ns"]
+			group.lastRaw = event.RawLog
+			if severityRank[event.Severity] > severityRank[group.severity] {
+				group.severity = event.Severity
+			}
+			return true
+		}
+
+		if len(a.groups) >= maxAggregateGroups {
+			return false
+		}
+		a.groups[key] = &aggregateGroup{
+			first:    cloneEvent(event),
+			deadline: now.Add(rule.window),
+		}
+		return false
+	}
+	return false
+}
+
+// flush закрывает группы с истекшим окном (при force - все) и возвращает
+// итоговые события для групп с повторами в порядке открытия. В итоговом
+// событии count - число повторов, которые оно заменяет (первое событие
+// уже отправлено), total_count - всего событий за окно
+func (a *aggregator) flush(now time.Time, force bool) []*types.Event {
+	var expired []*aggregateGroup
+	for key, group := range a.groups {
+		if force || !now.Before(group.deadline) {
+			expired = append(expired, group)
+			delete(a.groups, key)
+		}
+	}
+	sort.Slice(expired, func(i, j int) bool {
+		return expired[i].deadline.Before(expired[j].deadline)
+	})
+
+	events := make([]*types.Event, 0, len(expired))
+	for _, group := range expired {
+		if group.repeats == 0 {
+			continue
+		}
+		event := group.first
+		event.SetField("aggregated", "true")
+		event.SetField("count", strconv.Itoa(group.repeats))
+		event.SetField("total_count", strconv.Itoa(group.repeats+1))
+		event.SetField("first_seen", event.Timestamp)
+		event.SetField("last_seen", group.lastSeen)
+		event.Timestamp = group.lastSeen
+		delete(event.Fields, "timestamp_ns")
+		event.SetField("timestamp_ns", group.lastNs)
+		event.RawLog = group.lastRaw
+		if severityRank[group.severity] > severityRank[event.Severity] {
+			event.Severity = group.severity
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+func cloneEvent(event *types.Event) *types.Event {
+	clone := *event
+	clone.Fields = make(map[string]string, len(event.Fields))
+	for key, value := range event.Fields {
+		clone.Fields[key] = value
+	}
+	return &clone
+}
+
+// key - тип события и значения ключевых полей
+func (r aggregateRule) key(event *types.Event) string {
+	parts := []string{event.Source, event.EventType}
+	for _, field := range r.keys {
+		parts = append(parts, fieldValue(event, field))
+	}
+	return strings.Join(parts, "\x00")
+}
+
+var severityRank = map[string]int{"low": 1, "medium": 2, "high": 3, "critical": 4}
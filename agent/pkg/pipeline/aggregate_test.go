@@ -0,0 +1,176 @@
+package pipeline
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"siem-project/agent/pkg/config"
+	"siem-project/agent/pkg/types"
+)
+
+func newTestAggregator(t *testing.T, cfg ...config.AggregateConfig) *aggregator {
+	t.Helper()
+	a, err := newAggregator(cfg)
+	if err != nil {
+		t.Fatalf("newAggregator: %v", err)
+	}
+	return a
+}
+
+func loginFailed(ip, severity string, ts time.Time) *types.Event {
+	event := types.NewEvent("auth", "login_failed", severity, "Failed password for root from "+ip)
+	event.User = "root"
+	event.SetField("src_ip", ip)
+	event.SetTimestamp(ts)
+	return event
+}
+
+func TestAggregatorWindow(t *testing.T) {
+	a := newTestAggregator(t, config.AggregateConfig{EventType: "login_failed", Window: "30s"})
+	start := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	steps := []struct {
+		name     string
+		event    *types.Event
+		at       time.Duration
+		absorbed bool
+	}{
+		{"first event passes through", loginFailed("192.0.2.1", "medium", start), 0, false},
+		{"repeat is absorbed", loginFailed("192.0.2.1", "medium", start.Add(time.Second)), time.Second, true},
+		{"other key opens its own group", loginFailed("192.0.2.2", "medium", start.Add(2*time.Second)), 2 * time.Second, false},
+		{"escalated repeat is absorbed", loginFailed("192.0.2.1", "critical", start.Add(3*time.Second)), 3 * time.Second, true},
+		{"lower repeat is absorbed", loginFailed("192.0.2.1", "low", start.Add(4*time.Second+500*time.Millisecond)), 4 * time.Second, true},
+		{"other event type is not aggregated", types.NewEvent("auth", "user_login", "low", ""), 5 * time.Second, false},
+	}
+	for _, step := range steps {
+		if got := a.add(step.event, start.Add(step.at)); got != step.absorbed {
+			t.Errorf("%s: add() = %v, want %v", step.name, got, step.absorbed)
+		}
+	}
+
+	if events := a.flush(start.Add(29*time.Second), false); len(events) != 0 {
+		t.Fatalf("flush before window end returned %d events", len(events))
+	}
+
+	// группа 192.0.2.2 без повторов закрывается без итогового события
+	events := a.flush(start.Add(40*time.Second), false)
+	if len(events) != 1 {
+		t.Fatalf("flush after window returned %d events, want 1", len(events))
+	}
+	if len(a.groups) != 0 {
+		t.Errorf("%d groups left after window end", len(a.groups))
+	}
+
+	event := events[0]
+	want := map[string]string{
+		"aggregated":   "true",
+		"count":        "3",
+		"total_count":  "4",
+		"first_seen":   "2024-01-15T10:00:00Z",
+		"last_seen":    "2024-01-15T10:00:04Z",
+		"timestamp_ns": fmt.Sprint(start.Add(4*time.Second + 500*time.Millisecond).UnixNano()),
+		"src_ip":       "192.0.2.1",
+	}
+	for key, value := range want {
+		if event.Fields[key] != value {
+			t.Errorf("%s = %q, want %q", key, event.Fields[key], value)
+		}
+	}
+	if event.Timestamp != "2024-01-15T10:00:04Z" {
+		t.Errorf("timestamp = %s, want last_seen", event.Timestamp)
+	}
+	if event.Severity != "critical" {
+		t.Errorf("severity = %s, want the highest of the repeats", event.Severity)
+	}
+	if event.User != "root" || event.RawLog != "Failed password for root from 192.0.2.1" {
+		t.Errorf("user/raw_log = %q/%q", event.User, event.RawLog)
+	}
+
+	// окно закрыто: следующее событие снова проходит сразу
+	if a.add(loginFailed("192.0.2.1", "medium", start.Add(41*time.Second)), start.Add(41*time.Second)) {
+		t.Error("event after window end was absorbed")
+	}
+}
+
+func TestAggregatorFirstEventUnchanged(t *testing.T) {
+	a := newTestAggregator(t, config.AggregateConfig{EventType: "login_failed"})
+	now := time.Now()
+
+	first := loginFailed("192.0.2.1", "medium", now)
+	a.add(first, now)
+	a.add(loginFailed("192.0.2.1", "high", now), now)
+	a.flush(now, true)
+
+	// итоговое событие строится из копии, отправленное первое не меняется
+	if _, ok := first.Fields["aggregated"]; ok || first.Severity != "medium" {
+		t.Errorf("first event modified by flush: %s %v", first.Severity, first.Fields)
+	}
+}
+
+func TestAggregatorForceFlush(t *testing.T) {
+	a := newTestAggregator(t,
+		config.AggregateConfig{EventType: "login_failed", Window: "1h"},
+		config.AggregateConfig{EventType: "http_client_error", Source: "nginx", KeyFields: []string{"details.src_ip"}, Window: "10m"},
+	)
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 3; i++ {
+		a.add(loginFailed("192.0.2.1", "medium", now), now)
+	}
+	for i := 0; i < 2; i++ {
+		event := types.NewEvent("nginx", "http_client_error", "low", "GET /x 404")
+		event.SetField("src_ip", "198.51.100.5")
+		a.add(event, now.Add(time.Second))
+	}
+	// правило nginx не относится к другому источнику
+	apache := types.NewEvent("apache", "http_client_error", "low", "GET /x 404")
+	if a.add(apache, now) || a.add(apache, now) {
+		t.Error("event of another source was aggregated")
+	}
+
+	if events := a.flush(now.Add(time.Minute), false); len(events) != 0 {
+		t.Fatalf("flush before deadlines returned %d events", len(events))
+	}
+	events := a.flush(now.Add(time.Minute), true)
+	if len(events) != 2 {
+		t.Fatalf("force flush returned %d events, want 2", len(events))
+	}
+	// по порядку окончания окна: сначала nginx (10m), затем login_failed (1h)
+	if events[0].Source != "nginx" || events[0].Fields["count"] != "1" {
+		t.Errorf("events[0] = %s count %s", events[0].Source, events[0].Fields["count"])
+	}
+	if events[1].Source != "auth" || events[1].Fields["count"] != "2" {
+		t.Errorf("events[1] = %s count %s", events[1].Source, events[1].Fields["count"])
+	}
+	if len(a.groups) != 0 {
+		t.Errorf("%d groups left after force flush", len(a.groups))
+	}
+}
+
+func TestAggregatorGroupLimit(t *testing.T) {
+	a := newTestAggregator(t, config.AggregateConfig{EventType: "login_failed"})
+	now := time.Now()
+
+	for i := 0; i < maxAggregateGroups; i++ {
+		ip := fmt.Sprintf("10.%d.%d.%d", i>>16&255, i>>8&255, i&255)
+		if a.add(loginFailed(ip, "medium", now), now) {
+			t.Fatalf("first event of group %d absorbed", i)
+		}
+	}
+	if len(a.groups) != maxAggregateGroups {
+		t.Fatalf("%d groups open, want %d", len(a.groups), maxAggregateGroups)
+	}
+
+	// новые ключи сверх лимита идут без агрегации, открытые группы работают
+	extra := loginFailed("203.0.113.1", "medium", now)
+	if a.add(extra, now) || a.add(extra, now) {
+		t.Error("event over the group limit was absorbed")
+	}
+	if len(a.groups) != maxAggregateGroups {
+		t.Errorf("%d groups open after limit, want %d", len(a.groups), maxAggregateGroups)
+	}
+	if !a.add(loginFailed("10.0.0.0", "medium", now), now) {
+		t.Error("repeat of an open group not absorbed at the limit")
+	}
+}
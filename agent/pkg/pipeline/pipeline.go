@@ -0,0 +1,356 @@
+package pipeline
+
+import (
+	"fmt"
+	"math/rand"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"siem-project/agent/pkg/config"
+	"siem-project/agent/pkg/types"
+)
+
+// счетчики отправляются раз в минуту, если в конфиге не задано иное
+const defaultStatsInterval = time.Minute
+
+// сколько пар источник/тип попадает в отчет об отброшенных событиях
+const statsTopTypes = 20
+
+// причины, по которым событие не попало в буфер
+const (
+	reasonFilter    = "filter"
+	reasonRateLimit = "rate_limit"
+	reasonSampling  = "sampling"
+)
+
+// Pipeline решает, какие события попадут в буфер. Вызывается из одной
+// горутины (Agent.processEvents), поэтому без блокировок
+type Pipeline struct {
+	filters       []filterRule
+	limits        map[string]config.RateLimitConfig
+	buckets       map[string]*tokenBucket
+	sampling      []config.SamplingConfig
+	aggregator    *aggregator
+	redactor      *redactor // nil, если маскирование отключено
+	random        *rand.Rand
+	statsInterval time.Duration
+
+	processed  int64
+	aggregated int64            // повторы, схлопнутые агрегацией
+	dropped    map[string]int64 // причина -> количество
+	byType     map[string]int64 // источник/тип -> количество
+}
+
+type filterRule struct {
+	keep       bool
+	conditions []condition
+}
+
+type condition struct {
+	cfg     config.FilterConditionConfig
+	in      map[string]bool
+	matches *regexp.Regexp
+}
+
+// tokenBucket пополняется на rate токенов в секунду до burst
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func New(cfg config.PipelineConfig) (*Pipeline, error) {
+	p := &Pipeline{
+		limits:        make(map[string]config.RateLimitConfig),
+		buckets:       make(map[string]*tokenBucket),
+		sampling:      cfg.Sampling,
+		random:        rand.New(rand.NewSource(time.Now().UnixNano())),
+		statsInterval: defaultStatsInterval,
+		dropped:       make(map[string]int64),
+		byType:        make(map[string]int64),
+	}
+
+	if cfg.StatsInterval != "" {
+		interval, err := time.ParseDuration(cfg.StatsInterval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid stats_interval: %w", err)
+		}
+		if interval <= 0 {
+			return nil, fmt.Errorf("stats_interval must be positive")
+		}
+		p.statsInterval = interval
+	}
+
+	for i, rule := range cfg.Filters {
+		r := filterRule{keep: rule.Action == "keep"}
+		for _, cond := range rule.Conditions {
+			c := condition{cfg: cond}
+			if len(cond.In) > 0 {
+				c.in = make(map[string]bool, len(cond.In))
+				for _, value := range cond.In {
+					c.in[value] = true
+				}
+			}
+			if cond.Matches != "" {
+				re, err := regexp.Compile(cond.Matches)
+				if err != nil {
+					return nil, fmt.Errorf("filter %d: %w", i, err)
+				}
+				c.matches = re
+			}
+			r.conditions = append(r.conditions, c)
+		}
+		p.filters = append(p.filters, r)
+	}
+
+	for _, limit := range cfg.RateLimits {
+		if limit.Burst == 0 {
+			limit.Burst = int(limit.Rate)
+			if limit.Burst < 1 {
+				limit.Burst = 1
+			}
+		}
+		p.limits[limit.Source] = limit
+	}
+
+	aggregator, err := newAggregator(cfg.Aggregate)
+	if err != nil {
+		return nil, err
+	}
+	p.aggregator = aggregator
+
+	redactor, err := newRedactor(cfg.Redaction)
+	if err != nil {
+		return nil, err
+	}
+	p.redactor = redactor
+
+	for i := range p.sampling {
+		if p.sampling[i].Severity == "" {
+			p.sampling[i].Severity = "low"
+		}
+	}
+
+	return p, nil
+}
+
+// Process возвращает false, если событие нужно отбросить или это повтор,
+// учтенный агрегацией (итог вернется из Flush). События high и critical
+// не ограничиваются по частоте и не участвуют в выборке
+func (p *Pipeline) Process(event *types.Event) bool {
+	p.processed++
+
+	keep := false
+	for _, rule := range p.filters {
+		if !rule.match(event) {
+			continue
+		}
+		if !rule.keep {
+			p.drop(event, reasonFilter)
+			return false
+		}
+		keep = true
+		break
+	}
+
+	// маскирование до агрегации: в группе хранится уже очищенное событие
+	if p.redactor != nil {
+		p.redactor.redact(event)
+	}
+
+	if p.aggregator.add(event, time.Now()) {
+		p.aggregated++
+		return false
+	}
+
+	if keep || event.Severity == "high" || event.Severity == "critical" {
+		return true
+	}
+
+	if !p.allow(event.Source) {
+		p.drop(event, reasonRateLimit)
+		return false
+	}
+
+	for _, sample := range p.sampling {
+		if !sampleMatch(sample, event) {
+			continue
+		}
+		if p.random.Float64() >= sample.Rate {
+			p.drop(event, reasonSampling)
+			return false
+		}
+		// по sample_rate на сервере можно восстановить исходное количество
+		event.SetField("sample_rate", strconv.FormatFloat(sample.Rate, 'f', -1, 64))
+		break
+	}
+
+	return true
+}
+
+// Flush возвращает итоговые события агрегации, окно которых истекло;
+// force - все открытые группы (при остановке агента)
+func (p *Pipeline) Flush(force bool) []*types.Event {
+	return p.aggregator.flush(time.Now(), force)
+}
+
+// StatsInterval - период отправки StatsEvent
+func (p *Pipeline) StatsInterval() time.Duration {
+	return p.statsInterval
+}
+
+// StatsEvent возвращает событие со счетчиками отброшенного с прошлого
+// вызова и обнуляет их; nil, если ничего не отброшено и не схлопнуто
+func (p *Pipeline) StatsEvent(hostname string) *types.Event {
+	var total int64
+	for _, n := range p.dropped {
+		total += n
+	}
+	if total == 0 && p.aggregated == 0 {
+		p.processed = 0
+		return nil
+	}
+
+	type typeCount struct {
+		key   string
+		count int64
+	}
+	counts := make([]typeCount, 0, len(p.byType))
+	for key, n := range p.byType {
+		counts = append(counts, typeCount{key, n})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].count != counts[j].count {
+			return counts[i].count > counts[j].count
+		}
+		return counts[i].key < counts[j].key
+	})
+	if len(counts) > statsTopTypes {
+		counts = counts[:statsTopTypes]
+	}
+	top := make([]string, 0, len(counts))
+	for _, c := range counts {
+		top = append(top, fmt.Sprintf("%s=%d", c.key, c.count))
+	}
+
+	raw := fmt.Sprintf("pipeline dropped %d and aggregated %d of %d events", total, p.aggregated, p.processed)
+	event := types.NewEvent("agent", "pipeline_stats", "low", raw)
+	event.SetHostname(hostname)
+	event.SetField("processed", strconv.FormatInt(p.processed, 10))
+	event.SetField("dropped", strconv.FormatInt(total, 10))
+	for _, reason := range []string{reasonFilter, reasonRateLimit, reasonSampling} {
+		if n := p.dropped[reason]; n > 0 {
+			event.SetField("dropped_"+reason, strconv.FormatInt(n, 10))
+		}
+	}
+	event.SetField("aggregated", strconv.FormatInt(p.aggregated, 10))
+	event.SetField("top_dropped", strings.Join(top, ","))
+	event.SetField("interval", p.statsInterval.String())
+
+	p.processed = 0
+	p.aggregated = 0
+	p.dropped = make(map[string]int64)
+	p.byType = make(map[string]int64)
+	return event
+}
+
+func (p *Pipeline) drop(event *types.Event, reason string) {
+	p.dropped[reason]++
+	p.byType[event.Source+"/"+event.EventType]++
+}
+
+// allow берет токен из bucket источника; без лимита событие проходит
+func (p *Pipeline) allow(source string) bool {
+	bucket, ok := p.buckets[source]
+	if !ok {
+		limit, ok := p.limits[source]
+		if !ok {
+			limit, ok = p.limits["*"]
+		}
+		if !ok {
+			return true
+		}
+		bucket = &tokenBucket{
+			rate:   limit.Rate,
+			burst:  float64(limit.Burst),
+			tokens: float64(limit.Burst),
+			last:   time.Now(),
+		}
+		p.buckets[source] = bucket
+	}
+	return bucket.take(time.Now())
+}
+
+func (b *tokenBucket) take(now time.Time) bool {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+func (r filterRule) match(event *types.Event) bool {
+	for _, c := range r.conditions {
+		if !c.match(event) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c condition) match(event *types.Event) bool {
+	value := fieldValue(event, c.cfg.Field)
+
+	ok := true
+	if c.cfg.Equals != "" && value != c.cfg.Equals {
+		ok = false
+	}
+	if c.in != nil && !c.in[value] {
+		ok = false
+	}
+	if c.matches != nil && !c.matches.MatchString(value) {
+		ok = false
+	}
+	return ok != c.cfg.Not
+}
+
+// sampleMatch: пустые source и event_type подходят к любому событию
+func sampleMatch(sample config.SamplingConfig, event *types.Event) bool {
+	return (sample.Source == "" || sample.Source == event.Source) &&
+		(sample.EventType == "" || sample.EventType == event.EventType) &&
+		sample.Severity == event.Severity
+}
+
+// fieldValue возвращает поле события по имени из конфига; details.x и
+// просто x для полей парсеров равнозначны
+func fieldValue(event *types.Event, name string) string {
+	switch name {
+	case "source":
+		return event.Source
+	case "event_type":
+		return event.EventType
+	case "severity":
+		return event.Severity
+	case "user":
+		return event.User
+	case "process":
+		return event.Process
+	case "command":
+		return event.Command
+	case "raw_log":
+		return event.RawLog
+	case "hostname":
+		return event.Hostname
+	}
+	return event.Fields[strings.TrimPrefix(name, "details.")]
+}
@@ -0,0 +1,296 @@
+package pipeline
+
+import (
+	"testing"
+	"time"
+
+	"siem-project/agent/pkg/config"
+	"siem-project/agent/pkg/types"
+)
+
+func newTestPipeline(t *testing.T, cfg config.PipelineConfig) *Pipeline {
+	t.Helper()
+	// маскирование проверяется отдельно, здесь оно только мешает
+	cfg.Redaction.Disable = true
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return p
+}
+
+func testEvent(source, eventType, severity string, fields map[string]string) *types.Event {
+	event := types.NewEvent(source, eventType, severity, source+" "+eventType)
+	for key, value := range fields {
+		event.SetField(key, value)
+	}
+	return event
+}
+
+func TestPipelineFilters(t *testing.T) {
+	p := newTestPipeline(t, config.PipelineConfig{
+		Filters: []config.FilterRuleConfig{
+			// первое подходящее правило решает: root из cron сохраняется
+			{Action: "keep", Conditions: []config.FilterConditionConfig{
+				{Field: "source", Equals: "syslog"},
+				{Field: "user", Equals: "root"},
+			}},
+			{Action: "drop", Conditions: []config.FilterConditionConfig{
+				{Field: "source", Equals: "syslog"},
+				{Field: "process", In: []string{"CRON", "systemd"}},
+			}},
+			{Action: "drop", Conditions: []config.FilterConditionConfig{
+				{Field: "details.src_ip", Matches: `^10\.`},
+				{Field: "event_type", Equals: "login_failed", Not: true},
+			}},
+		},
+	})
+
+	tests := []struct {
+		name    string
+		event   func() *types.Event
+		want    bool
+		dropped int64
+	}{
+		{
+			name: "dropped by process list",
+			event: func() *types.Event {
+				e := testEvent("syslog", "syslog_message", "low", nil)
+				e.Process = "CRON"
+				return e
+			},
+			want:    false,
+			dropped: 1,
+		},
+		{
+			name: "kept by earlier rule",
+			event: func() *types.Event {
+				e := testEvent("syslog", "syslog_message", "low", nil)
+				e.Process, e.User = "CRON", "root"
+				return e
+			},
+			want: true,
+		},
+		{
+			name: "process outside the list",
+			event: func() *types.Event {
+				e := testEvent("syslog", "syslog_message", "low", nil)
+				e.Process = "sshd"
+				return e
+			},
+			want: true,
+		},
+		{
+			name: "internal address, not a failed login",
+			event: func() *types.Event {
+				return testEvent("auth", "user_login", "low", map[string]string{"src_ip": "10.0.0.8"})
+			},
+			want:    false,
+			dropped: 1,
+		},
+		{
+			name: "negated condition keeps failed logins",
+			event: func() *types.Event {
+				return testEvent("auth", "login_failed", "low", map[string]string{"src_ip": "10.0.0.8"})
+			},
+			want: true,
+		},
+		{
+			name: "external address",
+			event: func() *types.Event {
+				return testEvent("auth", "user_login", "low", map[string]string{"src_ip": "203.0.113.9"})
+			},
+			want: true,
+		},
+		{
+			name: "high severity is still filtered",
+			event: func() *types.Event {
+				e := testEvent("syslog", "syslog_message", "high", nil)
+				e.Process = "systemd"
+				return e
+			},
+			want:    false,
+			dropped: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := p.dropped[reasonFilter]
+			if got := p.Process(tt.event()); got != tt.want {
+				t.Errorf("Process() = %v, want %v", got, tt.want)
+			}
+			if got := p.dropped[reasonFilter] - before; got != tt.dropped {
+				t.Errorf("dropped by filter = %d, want %d", got, tt.dropped)
+			}
+		})
+	}
+}
+
+func TestPipelineRateLimit(t *testing.T) {
+	p := newTestPipeline(t, config.PipelineConfig{
+		Filters: []config.FilterRuleConfig{
+			{Action: "keep", Conditions: []config.FilterConditionConfig{{Field: "event_type", Equals: "user_login"}}},
+		},
+		RateLimits: []config.RateLimitConfig{
+			{Source: "nginx", Rate: 0.001, Burst: 2},
+			{Source: "*", Rate: 0.001, Burst: 1},
+		},
+	})
+
+	tests := []struct {
+		name  string
+		event *types.Event
+		want  bool
+	}{
+		{"nginx burst 1", testEvent("nginx", "http_request", "low", nil), true},
+		{"nginx burst 2", testEvent("nginx", "http_request", "low", nil), true},
+		{"nginx over the limit", testEvent("nginx", "http_request", "low", nil), false},
+		{"high bypasses the limit", testEvent("nginx", "web_sqli", "high", nil), true},
+		{"critical bypasses the limit", testEvent("nginx", "web_sqli", "critical", nil), true},
+		{"medium is limited", testEvent("nginx", "web_scanner", "medium", nil), false},
+		{"keep rule bypasses the limit", testEvent("nginx", "user_login", "low", nil), true},
+		{"default limit, own bucket", testEvent("docker", "container_log", "low", nil), true},
+		{"default limit exhausted", testEvent("docker", "container_log", "low", nil), false},
+		{"another source gets its own bucket", testEvent("kmsg", "kernel_message", "low", nil), true},
+	}
+	for _, tt := range tests {
+		if got := p.Process(tt.event); got != tt.want {
+			t.Errorf("%s: Process() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	if p.dropped[reasonRateLimit] != 3 {
+		t.Errorf("dropped by rate limit = %d, want 3", p.dropped[reasonRateLimit])
+	}
+}
+
+func TestTokenBucketRefill(t *testing.T) {
+	start := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	b := &tokenBucket{rate: 2, burst: 3, tokens: 3, last: start}
+
+	steps := []struct {
+		after time.Duration
+		want  bool
+	}{
+		{0, true},
+		{0, true},
+		{0, true},
+		{0, false},                      // запас исчерпан
+		{250 * time.Millisecond, false}, // 0.5 токена
+		{500 * time.Millisecond, true},  // 1 токен
+		{500 * time.Millisecond, false},
+		{time.Hour, true}, // пополняется не больше burst
+		{time.Hour, true},
+		{time.Hour, true},
+		{time.Hour, false},
+	}
+	for i, step := range steps {
+		if got := b.take(start.Add(step.after)); got != step.want {
+			t.Fatalf("step %d (+%v): take() = %v, want %v (tokens %.2f)", i, step.after, got, step.want, b.tokens)
+		}
+	}
+}
+
+func TestPipelineSampling(t *testing.T) {
+	p := newTestPipeline(t, config.PipelineConfig{
+		Sampling: []config.SamplingConfig{
+			{Source: "nginx", EventType: "http_request", Rate: 0},
+			{Source: "docker", Rate: 1},
+			{EventType: "kernel_message", Severity: "medium", Rate: 0},
+		},
+	})
+
+	tests := []struct {
+		name       string
+		event      *types.Event
+		want       bool
+		sampleRate string
+	}{
+		{"sampled out", testEvent("nginx", "http_request", "low", nil), false, ""},
+		{"other event type", testEvent("nginx", "http_client_error", "low", nil), true, ""},
+		{"kept with rate", testEvent("docker", "container_log", "low", nil), true, "1"},
+		{"severity defaults to low", testEvent("docker", "container_log", "medium", nil), true, ""},
+		{"explicit severity", testEvent("kmsg", "kernel_message", "medium", nil), false, ""},
+		{"high is not sampled", testEvent("kmsg", "kernel_message", "high", nil), true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.Process(tt.event); got != tt.want {
+				t.Errorf("Process() = %v, want %v", got, tt.want)
+			}
+			if got := tt.event.Fields["sample_rate"]; got != tt.sampleRate {
+				t.Errorf("sample_rate = %q, want %q", got, tt.sampleRate)
+			}
+		})
+	}
+}
+
+func TestPipelineStatsEvent(t *testing.T) {
+	p := newTestPipeline(t, config.PipelineConfig{
+		Filters: []config.FilterRuleConfig{
+			{Action: "drop", Conditions: []config.FilterConditionConfig{{Field: "event_type", Equals: "noise"}}},
+		},
+		Sampling:  []config.SamplingConfig{{Source: "nginx", Rate: 0}},
+		Aggregate: []config.AggregateConfig{{EventType: "login_failed"}},
+	})
+
+	if event := p.StatsEvent("web01"); event != nil {
+		t.Fatalf("StatsEvent() without drops = %+v, want nil", event)
+	}
+
+	p.Process(testEvent("syslog", "noise", "low", nil))
+	p.Process(testEvent("syslog", "noise", "low", nil))
+	p.Process(testEvent("nginx", "http_request", "low", nil))
+	p.Process(testEvent("auth", "login_failed", "medium", map[string]string{"src_ip": "192.0.2.1"}))
+	p.Process(testEvent("auth", "login_failed", "medium", map[string]string{"src_ip": "192.0.2.1"}))
+	p.Process(testEvent("auth", "user_login", "low", nil))
+
+	event := p.StatsEvent("web01")
+	if event == nil {
+		t.Fatal("StatsEvent() = nil")
+	}
+	want := map[string]string{
+		"processed":          "6",
+		"dropped":            "3",
+		"dropped_filter":     "2",
+		"dropped_sampling":   "1",
+		"aggregated":         "1",
+		"top_dropped":        "syslog/noise=2,nginx/http_request=1",
+		"interval":           "1m0s",
+		"dropped_rate_limit": "",
+	}
+	for key, value := range want {
+		if event.Fields[key] != value {
+			t.Errorf("%s = %q, want %q", key, event.Fields[key], value)
+		}
+	}
+	if event.Source != "agent" || event.EventType != "pipeline_stats" || event.Hostname != "web01" {
+		t.Errorf("unexpected stats event %s/%s from %s", event.Source, event.EventType, event.Hostname)
+	}
+
+	// счетчики обнуляются после отчета
+	if event := p.StatsEvent("web01"); event != nil {
+		t.Errorf("second StatsEvent() = %v, want nil", event.Fields)
+	}
+	p.Process(testEvent("syslog", "noise", "low", nil))
+	if event := p.StatsEvent("web01"); event == nil || event.Fields["processed"] != "1" || event.Fields["dropped"] != "1" {
+		t.Errorf("StatsEvent() after reset = %v", event)
+	}
+}
+
+func TestPipelineInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.PipelineConfig
+	}{
+		{"bad regexp", config.PipelineConfig{Filters: []config.FilterRuleConfig{{Action: "drop", Conditions: []config.FilterConditionConfig{{Field: "user", Matches: "("}}}}}},
+		{"zero stats interval", config.PipelineConfig{StatsInterval: "0s"}},
+		{"negative stats interval", config.PipelineConfig{StatsInterval: "-1m"}},
+		{"bad aggregate window", config.PipelineConfig{Aggregate: []config.AggregateConfig{{EventType: "x", Window: "soon"}}}},
+	}
+	for _, tt := range tests {
+		if _, err := New(tt.cfg); err == nil {
+			t.Errorf("%s: New() succeeded, want error", tt.name)
+		}
+	}
+}
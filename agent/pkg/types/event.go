@@ -2,6 +2,7 @@
 package types
 
 import (
+	"strconv"
 	"time"
 )
 
@@ -15,6 +16,8 @@ type Event struct {
 	Process   string `json:"process,omitempty"`
 	Command   string `json:"command,omitempty"`
 	RawLog    string `json:"raw_log"`
+	// дополнительные поля парсеров (адрес отправителя, порт и т.д.)
+	Fields map[string]string `json:"details,omitempty"`
 }
 
 func NewEvent(source, eventType, severity, rawLog string) *Event {
@@ -31,6 +34,34 @@ func (e *Event) SetHostname(hostname string) {
 	e.Hostname = hostname
 }
 
+// SetTimestamp задает время события из самого лога,
+// время приема агентом сохраняется в поле ingest_time.
+// Timestamp всегда в RFC3339 с точностью до секунды: backend сортирует
+// и фильтрует его как строку. Доли секунды - в поле timestamp_ns (unix ns)
+func (e *Event) SetTimestamp(t time.Time) {
+	if e.Fields["ingest_time"] == "" {
+		e.SetField("ingest_time", e.Timestamp)
+	}
+	e.Timestamp = t.UTC().Format(time.RFC3339)
+	if e.Fields != nil {
+		delete(e.Fields, "timestamp_ns")
+	}
+	if t.Nanosecond() != 0 {
+		e.SetField("timestamp_ns", strconv.FormatInt(t.UnixNano(), 10))
+	}
+}
+
+// SetField добавляет доп. поле, пустые значения пропускаются
+func (e *Event) SetField(key, value string) {
+	if value == "" {
+		return
+	}
+	if e.Fields == nil {
+		e.Fields = make(map[string]string)
+	}
+	e.Fields[key] = value
+}
+
 type Message struct {
 	AgentID   string   `json:"agent_id"`
 	Timestamp string   `json:"timestamp"`
@@ -0,0 +1,65 @@
+package types
+
+import (
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestSetTimestampFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		t      time.Time
+		want   string
+		wantNs string
+	}{
+		{"whole second", time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC), "2024-01-15T10:00:00Z", ""},
+		{"milliseconds", time.Date(2024, 1, 15, 10, 0, 0, 5e6, time.UTC), "2024-01-15T10:00:00Z", "1705312800005000000"},
+		{"local zone", time.Date(2024, 1, 15, 13, 0, 0, 1, time.FixedZone("MSK", 3*3600)), "2024-01-15T10:00:00Z", "1705312800000000001"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := NewEvent("test", "test", "low", "")
+			event.SetTimestamp(tt.t)
+			if event.Timestamp != tt.want || event.Fields["timestamp_ns"] != tt.wantNs {
+				t.Errorf("timestamp = %s (%s ns), want %s (%s ns)", event.Timestamp, event.Fields["timestamp_ns"], tt.want, tt.wantNs)
+			}
+			if len(event.Timestamp) != len("2006-01-02T15:04:05Z") {
+				t.Errorf("timestamp %s is not fixed width", event.Timestamp)
+			}
+		})
+	}
+}
+
+func TestSetTimestampSortsAsString(t *testing.T) {
+	base := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	times := []time.Time{base.Add(1500 * time.Millisecond), base, base.Add(999 * time.Millisecond), base.Add(2 * time.Second)}
+
+	var stamps []string
+	for _, ts := range times {
+		event := NewEvent("test", "test", "low", "")
+		event.SetTimestamp(ts)
+		stamps = append(stamps, event.Timestamp)
+	}
+	sort.Strings(stamps)
+	want := []string{"2024-01-15T10:00:00Z", "2024-01-15T10:00:00Z", "2024-01-15T10:00:01Z", "2024-01-15T10:00:02Z"}
+	for i := range want {
+		if stamps[i] != want[i] {
+			t.Fatalf("sorted timestamps = %v, want %v", stamps, want)
+		}
+	}
+}
+
+func TestSetTimestampKeepsIngestTime(t *testing.T) {
+	event := NewEvent("test", "test", "low", "")
+	received := event.Timestamp
+	event.SetTimestamp(time.Date(2024, 1, 15, 10, 0, 0, 250e6, time.UTC))
+	event.SetTimestamp(time.Date(2024, 1, 15, 10, 0, 1, 0, time.UTC))
+
+	if event.Fields["ingest_time"] != received {
+		t.Errorf("ingest_time = %s, want %s", event.Fields["ingest_time"], received)
+	}
+	if _, ok := event.Fields["timestamp_ns"]; ok {
+		t.Errorf("stale timestamp_ns %s left after whole-second timestamp", event.Fields["timestamp_ns"])
+	}
+}
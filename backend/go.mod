@@ -2,4 +2,4 @@ module siem-project/backend
 
 go 1.21
 
-require github.com/golang-jwt/jwt/v5 v5.3.0 // indirect
+require github.com/golang-jwt/jwt/v5 v5.3.0
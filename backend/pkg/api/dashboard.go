@@ -53,13 +53,13 @@ func (s *Server) handleDashboardLogins(w http.ResponseWriter, r *http.Request) {
 	var logins []map[string]interface{}
 	for _, e := range events {
 		// Очень простой фильтр для демо
-		if e.Type == "user_session_start" || e.Type == "login" {
+		if e.Type == "user_session_start" || e.Type == "login" || e.Type == "user_login" || e.Type == "login_failed" {
 			logins = append(logins, map[string]interface{}{
 				"timestamp":  e.Timestamp,
 				"user":       e.User,
 				"host":       e.Host,
-				"success":    true, 
-				"ip_address": "unknown",
+				"success":    e.Type != "login_failed",
+				"ip_address": detailString(e, "src_ip", "unknown"),
 			})
 		}
 	}
@@ -80,6 +80,14 @@ func (s *Server) handleDashboardLogins(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(logins)
 }
 
+// detailString возвращает строковое поле из details события (src_ip и т.д.)
+func detailString(e *storage.Event, key, fallback string) string {
+	if v, ok := e.Details[key].(string); ok && v != "" {
+		return v
+	}
+	return fallback
+}
+
 func (s *Server) handleDashboardHosts(w http.ResponseWriter, r *http.Request) {
 	events, _, err := s.storage.GetEvents(storage.EventFilter{})
 	if err != nil {
@@ -99,7 +107,7 @@ func (s *Server) handleDashboardHosts(w http.ResponseWriter, r *http.Request) {
 		}
 		
 		h := hostsMap[e.Host]
-		h["event_count"] = h["event_count"].(int) + 1
+		h["event_count"] = h["event_count"].(int) + e.Count()
 		if e.Timestamp > h["last_event"].(string) {
 			h["last_event"] = e.Timestamp
 		}
@@ -156,7 +164,7 @@ func (s *Server) handleDashboardTopUsers(w http.ResponseWriter, r *http.Request)
 	
 	for _, e := range events {
 		if e.User != "" {
-			userCounts[e.User]++
+			userCounts[e.User] += e.Count()
 		}
 	}
 
@@ -190,7 +198,7 @@ func (s *Server) handleDashboardTopProcesses(w http.ResponseWriter, r *http.Requ
 			procName = e.Source
 		}
 		if procName != "" {
-			procCounts[procName]++
+			procCounts[procName] += e.Count()
 		}
 	}
 
@@ -245,7 +253,7 @@ func (s *Server) handleDashboardTimeline(w http.ResponseWriter, r *http.Request)
 			if diff > 0 && diff <= 24*time.Hour {
 				hour := t.Format("15:00")
 				if _, ok := timelineMap[hour]; ok {
-					timelineMap[hour]++
+					timelineMap[hour] += e.Count()
 				}
 			}
 		}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"sync"
 	"time"
 )
@@ -54,6 +55,26 @@ func (e *Event) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// Count возвращает число исходных событий, которые представляет запись.
+// Итоговое событие агрегации агента (details.aggregated) заменяет
+// details.count повторов, остальные записи считаются за одно событие
+func (e *Event) Count() int {
+	if e.Details["aggregated"] != "true" {
+		return 1
+	}
+	switch v := e.Details["count"].(type) {
+	case string:
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return n
+		}
+	case float64:
+		if v >= 1 {
+			return int(v)
+		}
+	}
+	return 1
+}
+
 type Storage struct {
 	dataDir string
 	events  []*Event
@@ -147,18 +168,21 @@ func (s *Storage) GetStats() map[string]interface{} {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	stats := map[string]interface{}{
-		"total_events": len(s.events),
-	}
-
 	severityCount := make(map[string]int)
 	sourceCount := make(map[string]int)
 	typeCount := make(map[string]int)
+	total := 0
 
 	for _, event := range s.events {
-		severityCount[event.Severity]++
-		sourceCount[event.Source]++
-		typeCount[event.Type]++
+		n := event.Count()
+		total += n
+		severityCount[event.Severity] += n
+		sourceCount[event.Source] += n
+		typeCount[event.Type] += n
+	}
+
+	stats := map[string]interface{}{
+		"total_events": total,
 	}
 
 	stats["by_severity"] = severityCount